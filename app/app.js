@@ -161,6 +161,7 @@ async function uploadVideoFile(videoID) {
 
   uploadBtnSelector = 'upload-video-btn';
   setUploadButtonState(true, uploadBtnSelector);
+  const progress = watchVideoProgress(videoID, uploadBtnSelector);
 
   try {
     const res = await fetch(`/api/video_upload/${videoID}`, {
@@ -170,20 +171,114 @@ async function uploadVideoFile(videoID) {
       },
       body: formData,
     });
+    const data = await res.json();
     if (!res.ok) {
-      const data = await res.json();
       throw new Error(`Failed to upload video file. Error: ${data.error}`);
     }
 
-    console.log('Video uploaded!');
+    console.log('Video uploaded, processing...');
+    // the event stream usually reports the result first, polling covers
+    // a dropped connection
+    await Promise.race([progress.waitForJob(data.id), waitForJob(data.id)]);
     await getVideo(videoID);
   } catch (error) {
     alert(`Error: ${error.message}`);
   }
 
+  progress.close();
   setUploadButtonState(false, uploadBtnSelector);
 }
 
+const progressLabels = {
+  receiving: 'Uploading',
+  queued: 'Queued',
+  processing: 'Processing',
+  storing: 'Storing',
+  encoding: 'Encoding',
+  ready: 'Ready',
+  failed: 'Failed',
+};
+
+function watchVideoProgress(videoID, selector) {
+  const finished = new Map();
+  let waiting = null;
+  let source = null;
+  let closed = false;
+
+  const onProgress = (e) => {
+    const event = JSON.parse(e.data);
+    const uploadBtn = document.getElementById(selector);
+    const label = progressLabels[event.stage] || event.stage;
+    uploadBtn.textContent = event.percent ? `${label} ${Math.floor(event.percent)}%` : `${label}...`;
+
+    if ((event.stage === 'ready' || event.stage === 'failed') && event.job_id) {
+      finished.set(event.job_id, event);
+      if (waiting && waiting.jobID === event.job_id) {
+        waiting.settle(event);
+      }
+    }
+  };
+
+  // the stream can't send the access token, it gets its own short-lived one
+  fetch(`/api/videos/${videoID}/events/token`, {
+    method: 'POST',
+    headers: {
+      Authorization: `Bearer ${localStorage.getItem('token')}`,
+    },
+  })
+    .then((res) => (res.ok ? res.json() : Promise.reject(new Error(`status ${res.status}`))))
+    .then(({ token }) => {
+      if (closed) return;
+      source = new EventSource(`/api/videos/${videoID}/events?token=${encodeURIComponent(token)}`);
+      source.addEventListener('progress', onProgress);
+    })
+    .catch((error) => console.error('Could not watch progress, polling instead:', error));
+
+  return {
+    waitForJob(jobID) {
+      return new Promise((resolve, reject) => {
+        const settle = (event) => {
+          if (event.stage === 'ready') {
+            resolve(event);
+          } else {
+            reject(new Error(`Processing failed: ${event.error}`));
+          }
+        };
+        if (finished.has(jobID)) {
+          settle(finished.get(jobID));
+          return;
+        }
+        waiting = { jobID, settle };
+      });
+    },
+    close() {
+      closed = true;
+      if (source) source.close();
+    },
+  };
+}
+
+async function waitForJob(jobID) {
+  while (true) {
+    const res = await fetch(`/api/jobs/${jobID}`, {
+      headers: {
+        Authorization: `Bearer ${localStorage.getItem('token')}`,
+      },
+    });
+    const job = await res.json();
+    if (!res.ok) {
+      throw new Error(`Failed to get processing status. Error: ${job.error}`);
+    }
+    if (job.status === 'ready') {
+      return job;
+    }
+    if (job.status === 'failed') {
+      throw new Error(`Processing failed: ${job.error}`);
+    }
+    await new Promise((resolve) => setTimeout(resolve, 5000));
+  }
+}
+
 const videoStateHandler = createVideoStateHandler();
 
 async function getVideos() {
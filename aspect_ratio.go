@@ -0,0 +1,85 @@
+package main
+
+import (
+	"math"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/media"
+)
+
+type aspectRatio int
+
+const (
+	aspectRatioOther aspectRatio = iota
+	aspectRatio16x9
+	aspectRatio9x16
+	aspectRatio4x3
+	aspectRatio1x1
+	aspectRatio21x9
+)
+
+// aspectRatioTolerance is how far, relative to the bucket's ratio, a
+// video's ratio may be off and still land in the bucket. It absorbs odd
+// encoder dimensions like 1280x722 and cinema ratios like 2.37:1.
+const aspectRatioTolerance = 0.03
+
+var aspectRatioBuckets = []struct {
+	aspectRatio aspectRatio
+	ratio       float64
+}{
+	{aspectRatio16x9, 16.0 / 9},
+	{aspectRatio9x16, 9.0 / 16},
+	{aspectRatio4x3, 4.0 / 3},
+	{aspectRatio1x1, 1},
+	{aspectRatio21x9, 21.0 / 9},
+}
+
+func (a aspectRatio) String() string {
+	switch a {
+	case aspectRatio16x9:
+		return "16:9"
+	case aspectRatio9x16:
+		return "9:16"
+	case aspectRatio4x3:
+		return "4:3"
+	case aspectRatio1x1:
+		return "1:1"
+	case aspectRatio21x9:
+		return "21:9"
+	}
+	return "other"
+}
+
+// keyPrefix is the storage prefix videos with this aspect ratio are put
+// under.
+func (a aspectRatio) keyPrefix() string {
+	switch a {
+	case aspectRatio16x9:
+		return "landscape"
+	case aspectRatio9x16:
+		return "portrait"
+	case aspectRatio4x3:
+		return "standard"
+	case aspectRatio1x1:
+		return "square"
+	case aspectRatio21x9:
+		return "ultrawide"
+	}
+	return "other"
+}
+
+// classifyAspectRatio buckets the video by its displayed aspect ratio,
+// i.e. with width and height swapped for videos rotated by 90 degrees.
+func classifyAspectRatio(stream media.Stream) aspectRatio {
+	width, height := stream.DisplaySize()
+	if width <= 0 || height <= 0 {
+		return aspectRatioOther
+	}
+
+	ratio := float64(width) / float64(height)
+	for _, bucket := range aspectRatioBuckets {
+		if math.Abs(ratio/bucket.ratio-1) <= aspectRatioTolerance {
+			return bucket.aspectRatio
+		}
+	}
+	return aspectRatioOther
+}
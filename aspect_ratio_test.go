@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/media"
+)
+
+func TestClassifyAspectRatio(t *testing.T) {
+	rotated := func(width, height int, rotate string) media.Stream {
+		stream := media.Stream{Width: width, Height: height}
+		stream.Tags.Rotate = rotate
+		return stream
+	}
+	displayMatrix := func(width, height int, rotation float64) media.Stream {
+		stream := media.Stream{Width: width, Height: height}
+		stream.SideDataList = append(stream.SideDataList, struct {
+			Rotation float64 `json:"rotation"`
+		}{rotation})
+		return stream
+	}
+
+	tests := []struct {
+		name   string
+		stream media.Stream
+		want   aspectRatio
+	}{
+		{"16:9", media.Stream{Width: 1920, Height: 1080}, aspectRatio16x9},
+		{"9:16", media.Stream{Width: 1080, Height: 1920}, aspectRatio9x16},
+		{"4:3", media.Stream{Width: 640, Height: 480}, aspectRatio4x3},
+		{"square", media.Stream{Width: 1080, Height: 1080}, aspectRatio1x1},
+		{"21:9", media.Stream{Width: 2560, Height: 1080}, aspectRatio21x9},
+		{"cinema 2.37:1", media.Stream{Width: 1920, Height: 810}, aspectRatio21x9},
+		{"odd encoder height", media.Stream{Width: 1280, Height: 722}, aspectRatio16x9},
+		{"just inside the tolerance", media.Stream{Width: 1831, Height: 1000}, aspectRatio16x9},
+		{"just outside the tolerance", media.Stream{Width: 1832, Height: 1000}, aspectRatioOther},
+		{"between buckets", media.Stream{Width: 1500, Height: 1000}, aspectRatioOther},
+		{"rotate tag 90", rotated(1920, 1080, "90"), aspectRatio9x16},
+		{"rotate tag 270", rotated(1920, 1080, "270"), aspectRatio9x16},
+		{"rotate tag 180", rotated(1920, 1080, "180"), aspectRatio16x9},
+		{"display matrix -90", displayMatrix(1920, 1080, -90), aspectRatio9x16},
+		{"portrait rotated to landscape", displayMatrix(1080, 1920, 90), aspectRatio16x9},
+		{"no size", media.Stream{}, aspectRatioOther},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := classifyAspectRatio(tt.stream)
+			if got != tt.want {
+				t.Errorf("classifyAspectRatio(%dx%d) = %s, want %s", tt.stream.Width, tt.stream.Height, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAspectRatioKeyPrefix(t *testing.T) {
+	tests := []struct {
+		aspectRatio aspectRatio
+		want        string
+	}{
+		{aspectRatio16x9, "landscape"},
+		{aspectRatio9x16, "portrait"},
+		{aspectRatio4x3, "standard"},
+		{aspectRatio1x1, "square"},
+		{aspectRatio21x9, "ultrawide"},
+		{aspectRatioOther, "other"},
+	}
+	for _, tt := range tests {
+		if got := tt.aspectRatio.keyPrefix(); got != tt.want {
+			t.Errorf("%s keyPrefix = %q, want %q", tt.aspectRatio, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/media"
+)
+
+// packageDASH writes an MPD manifest with fMP4 segments for all renditions.
+// Every rendition carries the same audio, so only the first one's audio
+// track is packaged. Segments are listed one by one rather than through a
+// template, so each of them can get its own signed URL.
+func (cfg *apiConfig) packageDASH(ctx context.Context, renditions []encodedRendition, hasAudio bool, outDir string) error {
+	err := os.MkdirAll(outDir, 0755)
+	if err != nil {
+		return err
+	}
+
+	args := []string{"-y"}
+	for _, r := range renditions {
+		args = append(args, "-i", r.Path)
+	}
+	for i := range renditions {
+		args = append(args, "-map", fmt.Sprintf("%d:v:0", i))
+	}
+	adaptationSets := "id=0,streams=v"
+	if hasAudio {
+		args = append(args, "-map", "0:a:0")
+		adaptationSets += " id=1,streams=a"
+	}
+	args = append(args,
+		"-c", "copy",
+		"-f", "dash",
+		"-seg_duration", fmt.Sprint(segmentSeconds),
+		"-use_template", "0",
+		"-init_seg_name", "init-$RepresentationID$.m4s",
+		"-media_seg_name", "chunk-$RepresentationID$-$Number%05d$.m4s",
+		"-adaptation_sets", adaptationSets,
+		filepath.Join(outDir, "manifest.mpd"),
+	)
+
+	err = cfg.mediaProcessor.Run(ctx, media.OpPackage, args, nil)
+	if err != nil {
+		return fmt.Errorf("couldn't package DASH: %w", err)
+	}
+	return nil
+}
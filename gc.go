@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+)
+
+const defaultGCGracePeriod = 24 * time.Hour
+
+type gcOptions struct {
+	GracePeriod time.Duration
+	DryRun      bool
+}
+
+type gcObject struct {
+	Storage string
+	storage.ObjectInfo
+}
+
+type gcReport struct {
+	Scanned      int
+	Unreferenced []gcObject
+	Deleted      int
+	BytesFreed   int64
+	Retried      int
+	Failed       int
+	TusExpired   int
+	// multipart direct uploads that were never completed
+	MultipartAborted int
+}
+
+type referencedAssets struct {
+	keys     map[string]map[string]bool
+	prefixes map[string][]string
+}
+
+func (ra referencedAssets) contains(storageName, key string) bool {
+	if ra.keys[storageName][key] {
+		return true
+	}
+	for _, prefix := range ra.prefixes[storageName] {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// collectGarbage deletes (or, in dry-run mode, only reports) stored objects
+// that no video references and that are older than the grace period. That
+// includes files in ASSETS_ROOT, where thumbnails used to be kept. It
+// also retries deletions that failed earlier.
+func (cfg *apiConfig) collectGarbage(ctx context.Context, opts gcOptions) (gcReport, error) {
+	report := gcReport{}
+
+	if !opts.DryRun {
+		err := cfg.retryFailedDeletions(ctx, &report)
+		if err != nil {
+			return report, err
+		}
+	}
+
+	cutoff := time.Now().Add(-opts.GracePeriod)
+	if !opts.DryRun && cfg.tusUploads != nil {
+		expired, err := cfg.tusUploads.removeExpired(cutoff)
+		if err != nil {
+			return report, err
+		}
+		report.TusExpired = expired
+	}
+	if !opts.DryRun {
+		aborted, err := cfg.abortStaleMultipartUploads(ctx, cutoff)
+		if err != nil {
+			return report, err
+		}
+		report.MultipartAborted = aborted
+	}
+
+	refs, err := cfg.referencedAssets(ctx)
+	if err != nil {
+		return report, err
+	}
+
+	targets := []struct {
+		storage  string
+		prefixes []string
+	}{
+		{storageNameVideo, slices.Concat(videoKeyPrefixes, []string{directUploadPrefix, originalsPrefix})},
+		{storageNameThumbnail, []string{""}},
+		{storageNameAssets, []string{""}},
+	}
+	for _, target := range targets {
+		store, err := cfg.storageByName(target.storage)
+		if err != nil {
+			return report, err
+		}
+		for _, prefix := range target.prefixes {
+			objects, err := store.List(ctx, prefix)
+			if err != nil {
+				return report, fmt.Errorf("couldn't list %s storage prefix %q: %w", target.storage, prefix, err)
+			}
+			for _, obj := range objects {
+				report.Scanned++
+				if cfg.isReferenced(ctx, refs, target.storage, obj.Key) || obj.LastModified.After(cutoff) {
+					continue
+				}
+				report.Unreferenced = append(report.Unreferenced, gcObject{Storage: target.storage, ObjectInfo: obj})
+				if opts.DryRun {
+					continue
+				}
+				err := store.Delete(ctx, obj.Key)
+				if err != nil && !errors.Is(err, storage.ErrNotFound) {
+					log.Printf("gc: couldn't delete %s object %q: %v", target.storage, obj.Key, err)
+					report.Failed++
+					continue
+				}
+				report.Deleted++
+				report.BytesFreed += obj.Size
+			}
+		}
+	}
+
+	return report, nil
+}
+
+// isReferenced reports whether a stored object is still needed. A
+// thumbnail in ASSETS_ROOT is only needed until migrate-thumbnails has
+// copied it to thumbnail storage.
+func (cfg *apiConfig) isReferenced(ctx context.Context, refs referencedAssets, storageName, key string) bool {
+	if !refs.contains(storageName, key) {
+		return false
+	}
+	if storageName != storageNameAssets {
+		return true
+	}
+	_, err := cfg.thumbnailStorage.Head(ctx, key)
+	return err != nil
+}
+
+// abortStaleMultipartUploads aborts direct uploads started before cutoff
+// that the client never completed, which would otherwise keep their parts
+// in the bucket. Completing an upload takes at most directUploadExpiry, so
+// a grace period longer than that doesn't cut any short.
+func (cfg *apiConfig) abortStaleMultipartUploads(ctx context.Context, cutoff time.Time) (int, error) {
+	uploader, ok := cfg.videoStorage.(storage.DirectUploader)
+	if !ok {
+		return 0, nil
+	}
+	uploads, err := uploader.ListMultipartUploads(ctx, directUploadPrefix)
+	if err != nil {
+		return 0, fmt.Errorf("couldn't list multipart uploads: %w", err)
+	}
+
+	aborted := 0
+	for _, upload := range uploads {
+		if upload.Initiated.After(cutoff) {
+			continue
+		}
+		err := uploader.AbortMultipartUpload(ctx, upload.Key, upload.UploadID)
+		if err != nil {
+			log.Printf("gc: couldn't abort multipart upload of %q: %v", upload.Key, err)
+			continue
+		}
+		aborted++
+	}
+	return aborted, nil
+}
+
+func (cfg *apiConfig) referencedAssets(ctx context.Context) (referencedAssets, error) {
+	videos, err := cfg.db.GetAllVideos(ctx)
+	if err != nil {
+		return referencedAssets{}, err
+	}
+
+	refs := referencedAssets{
+		keys: map[string]map[string]bool{
+			storageNameVideo:     {},
+			storageNameThumbnail: {},
+			storageNameAssets:    {},
+		},
+		prefixes: map[string][]string{},
+	}
+	for _, video := range videos {
+		if video.VideoKey != nil {
+			refs.keys[storageNameVideo][*video.VideoKey] = true
+			refs.prefixes[storageNameVideo] = append(refs.prefixes[storageNameVideo], videoAssetPrefix(*video.VideoKey))
+		}
+		if video.OriginalKey != nil {
+			refs.keys[storageNameVideo][*video.OriginalKey] = true
+		}
+		if video.ThumbnailKey != nil {
+			refs.keys[storageNameThumbnail][*video.ThumbnailKey] = true
+			refs.keys[storageNameAssets][*video.ThumbnailKey] = true
+		}
+	}
+
+	candidates, err := cfg.db.GetAllThumbnailCandidates(ctx)
+	if err != nil {
+		return referencedAssets{}, err
+	}
+	for _, candidate := range candidates {
+		refs.keys[storageNameThumbnail][candidate.Key] = true
+	}
+
+	// uploads waiting to be processed can sit in the queue for a while
+	jobs, err := cfg.db.GetUnfinishedJobs(ctx)
+	if err != nil {
+		return referencedAssets{}, err
+	}
+	for _, job := range jobs {
+		if job.SourceKey != "" {
+			refs.keys[storageNameVideo][job.SourceKey] = true
+		}
+	}
+	return refs, nil
+}
+
+func (cfg *apiConfig) retryFailedDeletions(ctx context.Context, report *gcReport) error {
+	deletions, err := cfg.db.GetFailedDeletions(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, fd := range deletions {
+		report.Retried++
+		store, err := cfg.storageByName(fd.Storage)
+		if err != nil {
+			log.Printf("gc: skipping failed deletion %s: %v", fd.ID, err)
+			continue
+		}
+
+		deleted, err := deleteRecordedObjects(ctx, store, fd)
+		if err != nil {
+			report.Failed++
+			fd.Attempts++
+			fd.Error = err.Error()
+			if updateErr := cfg.db.UpdateFailedDeletion(ctx, fd); updateErr != nil {
+				log.Printf("gc: couldn't update failed deletion %s: %v", fd.ID, updateErr)
+			}
+			continue
+		}
+		report.Deleted += deleted
+		err = cfg.db.DeleteFailedDeletion(ctx, fd.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func deleteRecordedObjects(ctx context.Context, store storage.ObjectStore, fd database.FailedDeletion) (int, error) {
+	keys := []string{fd.Key}
+	if fd.IsPrefix {
+		objects, err := store.List(ctx, fd.Key)
+		if err != nil {
+			return 0, err
+		}
+		keys = keys[:0]
+		for _, obj := range objects {
+			keys = append(keys, obj.Key)
+		}
+	}
+
+	for _, key := range keys {
+		err := store.Delete(ctx, key)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return 0, err
+		}
+	}
+	return len(keys), nil
+}
+
+func (cfg *apiConfig) startGarbageCollector(ctx context.Context, interval time.Duration, opts gcOptions) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				report, err := cfg.collectGarbage(ctx, opts)
+				if err != nil {
+					log.Printf("gc: run failed: %v", err)
+					continue
+				}
+				logGCReport(report, opts)
+			}
+		}
+	}()
+}
+
+func logGCReport(report gcReport, opts gcOptions) {
+	for _, obj := range report.Unreferenced {
+		log.Printf("gc: unreferenced %s object %q (%d bytes, modified %s)",
+			obj.Storage, obj.Key, obj.Size, obj.LastModified.Format(time.RFC3339))
+	}
+	log.Printf("gc: scanned %d objects, %d unreferenced, %d deleted (%d bytes), %d failed deletions retried, %d failures, %d expired tus uploads, %d abandoned multipart uploads aborted, dry run: %t",
+		report.Scanned, len(report.Unreferenced), report.Deleted, report.BytesFreed, report.Retried, report.Failed, report.TusExpired, report.MultipartAborted, opts.DryRun)
+}
+
+// runGCCommand implements the one-shot `gc` admin command.
+func runGCCommand(cfg *apiConfig, args []string) error {
+	flags := flag.NewFlagSet("gc", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "only report unreferenced objects")
+	grace := flags.Duration("grace", defaultGCGracePeriod, "minimum age of objects to collect")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	opts := gcOptions{
+		GracePeriod: *grace,
+		DryRun:      *dryRun,
+	}
+	report, err := cfg.collectGarbage(context.Background(), opts)
+	if err != nil {
+		return err
+	}
+	logGCReport(report, opts)
+	return nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestCollectGarbageAssets checks files left in ASSETS_ROOT are only
+// collected once no video uses them or migrate-thumbnails has copied them.
+func TestCollectGarbageAssets(t *testing.T) {
+	cfg, db, _ := newTestConfig(t)
+	ctx := context.Background()
+	user, _ := createTestUser(t, cfg, "user@example.com")
+	for _, key := range []string{"copied.png", "pending.png"} {
+		video := createTestVideo(t, cfg, user.ID)
+		if err := db.SetVideoThumbnail(ctx, video.ID, key); err != nil {
+			t.Fatalf("SetVideoThumbnail: %v", err)
+		}
+	}
+	for _, key := range []string{"copied.png", "pending.png", "orphan.png"} {
+		if err := cfg.assetStorage.Put(ctx, key, strings.NewReader(key), "image/png"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := cfg.thumbnailStorage.Put(ctx, "copied.png", strings.NewReader("copied.png"), "image/png"); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := cfg.collectGarbage(ctx, gcOptions{})
+	if err != nil {
+		t.Fatalf("collectGarbage: %v", err)
+	}
+
+	collected := map[string]bool{}
+	for _, obj := range report.Unreferenced {
+		if obj.Storage == storageNameAssets {
+			collected[obj.Key] = true
+		}
+	}
+	tests := []struct {
+		key           string
+		wantCollected bool
+	}{
+		{"copied.png", true},
+		{"pending.png", false},
+		{"orphan.png", true},
+	}
+	for _, tt := range tests {
+		_, err := cfg.assetStorage.Head(ctx, tt.key)
+		if collected[tt.key] != tt.wantCollected || (err != nil) != tt.wantCollected {
+			t.Errorf("%s collected = %t (head: %v), want %t", tt.key, collected[tt.key], err, tt.wantCollected)
+		}
+	}
+	if _, err := cfg.thumbnailStorage.Head(ctx, "copied.png"); err != nil {
+		t.Errorf("copied thumbnail was collected: %v", err)
+	}
+}
+
+// TestCollectGarbageMultipartUploads checks direct uploads abandoned before
+// they were completed are aborted, and ones still in progress aren't.
+func TestCollectGarbageMultipartUploads(t *testing.T) {
+	cfg, _, _ := newTestConfig(t)
+	store := newDirectUploadStore()
+	cfg.videoStorage = store
+	ctx := context.Background()
+
+	abandoned, err := store.CreateMultipartUpload(ctx, directUploadPrefix+"abandoned.mp4", "video/mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	upload := store.multipart[abandoned]
+	upload.Initiated = time.Now().Add(-2 * defaultGCGracePeriod)
+	store.multipart[abandoned] = upload
+	inProgress, err := store.CreateMultipartUpload(ctx, directUploadPrefix+"in-progress.mp4", "video/mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := cfg.collectGarbage(ctx, gcOptions{GracePeriod: defaultGCGracePeriod, DryRun: true})
+	if err != nil {
+		t.Fatalf("collectGarbage: %v", err)
+	}
+	if report.MultipartAborted != 0 || len(store.multipart) != 2 {
+		t.Errorf("dry run aborted %d uploads, %d left, want none aborted", report.MultipartAborted, len(store.multipart))
+	}
+
+	report, err = cfg.collectGarbage(ctx, gcOptions{GracePeriod: defaultGCGracePeriod})
+	if err != nil {
+		t.Fatalf("collectGarbage: %v", err)
+	}
+	if report.MultipartAborted != 1 {
+		t.Errorf("aborted %d multipart uploads, want 1", report.MultipartAborted)
+	}
+	if _, ok := store.multipart[abandoned]; ok {
+		t.Error("abandoned upload wasn't aborted")
+	}
+	if _, ok := store.multipart[inProgress]; !ok {
+		t.Error("upload in progress was aborted")
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+)
+
+func TestHandlerLogin(t *testing.T) {
+	cfg, _, _ := newTestConfig(t)
+	user, _ := createTestUser(t, cfg, "user@example.com")
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{"correct password", `{"email": "user@example.com", "password": "password"}`, http.StatusOK},
+		{"wrong password", `{"email": "user@example.com", "password": "wrong"}`, http.StatusUnauthorized},
+		{"unknown email", `{"email": "nobody@example.com", "password": "password"}`, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			cfg.handlerLogin(w, httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(tt.body)))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var resp struct {
+				Token        string `json:"token"`
+				RefreshToken string `json:"refresh_token"`
+			}
+			decodeTestResponse(t, w, &resp)
+			userID, err := auth.ValidateJWT(resp.Token, cfg.jwtSecret)
+			if err != nil || userID != user.ID {
+				t.Errorf("access token is for %s, %v, want %s", userID, err, user.ID)
+			}
+			refreshed, err := cfg.db.GetUserByRefreshToken(context.Background(), resp.RefreshToken)
+			if err != nil || refreshed.ID != user.ID {
+				t.Errorf("refresh token wasn't stored for the user: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func (cfg *apiConfig) handlerThumbnailCandidatesGet(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.authorizeVideoOwner(w, r)
+	if !ok {
+		return
+	}
+
+	candidates, err := cfg.db.GetThumbnailCandidates(r.Context(), video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get thumbnail candidates", err)
+		return
+	}
+	for i := range candidates {
+		candidates[i].URL, err = cfg.thumbnailObjectURL(r.Context(), candidates[i].Key)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't sign thumbnail URL", err)
+			return
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, candidates)
+}
+
+func (cfg *apiConfig) handlerThumbnailSelect(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		CandidateID uuid.UUID `json:"candidate_id"`
+	}
+
+	video, ok := cfg.authorizeVideoOwner(w, r)
+	if !ok {
+		return
+	}
+
+	params := parameters{}
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	candidate, err := cfg.db.GetThumbnailCandidate(r.Context(), params.CandidateID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Thumbnail candidate not found", nil)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get thumbnail candidate", err)
+		return
+	}
+	if candidate.VideoID != video.ID {
+		respondWithError(w, http.StatusNotFound, "Thumbnail candidate not found", nil)
+		return
+	}
+
+	err = cfg.db.SetVideoThumbnail(r.Context(), video.ID, candidate.Key)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update video", err)
+		return
+	}
+	video, err = cfg.db.GetVideo(r.Context(), video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	video = cfg.updateVideoUsage(r.Context(), video)
+
+	video, err = cfg.videoWithURLs(r.Context(), video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video URLs", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, video)
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+	"github.com/google/uuid"
+)
+
+const (
+	directUploadPrefix             = "uploads/"
+	directUploadExpiry             = time.Hour
+	directUploadMultipartThreshold = 100 << 20
+	directUploadPartSize           = 64 << 20
+)
+
+type presignedPart struct {
+	PartNumber int32  `json:"part_number"`
+	URL        string `json:"url"`
+}
+
+func (cfg *apiConfig) handlerPresignVideoUpload(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		ContentType string `json:"content_type"`
+		Size        int64  `json:"size"`
+	}
+	type response struct {
+		Key       string          `json:"key"`
+		URL       string          `json:"url,omitempty"`
+		UploadID  string          `json:"upload_id,omitempty"`
+		PartSize  int64           `json:"part_size,omitempty"`
+		Parts     []presignedPart `json:"parts,omitempty"`
+		ExpiresAt time.Time       `json:"expires_at"`
+	}
+
+	uploader, ok := cfg.videoStorage.(storage.DirectUploader)
+	if !ok {
+		respondWithError(w, http.StatusNotImplemented, "Direct uploads aren't supported by this storage backend", nil)
+		return
+	}
+
+	video, ok := cfg.authorizeVideoOwner(w, r)
+	if !ok {
+		return
+	}
+
+	params := parameters{}
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	medType, err := cfg.validateVideoMediaType(params.ContentType)
+	if err != nil {
+		respondWithUnsupportedMedia(w, cfg.acceptedVideoTypes, err)
+		return
+	}
+	if params.Size <= 0 || params.Size > maxVideoUploadSize {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("size must be between 1 and %d bytes", int64(maxVideoUploadSize)), nil)
+		return
+	}
+	if !cfg.checkQuota(w, r, video.UserID, params.Size, video.VideoBytes) {
+		return
+	}
+
+	key := generateDirectUploadKey(video.ID, videoContainers[medType].ext)
+	resp := response{
+		Key:       key,
+		ExpiresAt: time.Now().UTC().Add(directUploadExpiry),
+	}
+
+	if params.Size <= directUploadMultipartThreshold {
+		resp.URL, err = uploader.PresignPut(r.Context(), key, medType, directUploadExpiry)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't presign upload", err)
+			return
+		}
+		respondWithJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	resp.UploadID, err = uploader.CreateMultipartUpload(r.Context(), key, medType)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't start multipart upload", err)
+		return
+	}
+	resp.PartSize = directUploadPartSize
+	partCount := (params.Size + directUploadPartSize - 1) / directUploadPartSize
+	for partNumber := int32(1); int64(partNumber) <= partCount; partNumber++ {
+		url, err := uploader.PresignUploadPart(r.Context(), key, resp.UploadID, partNumber, directUploadExpiry)
+		if err != nil {
+			uploader.AbortMultipartUpload(context.WithoutCancel(r.Context()), key, resp.UploadID)
+			respondWithError(w, http.StatusInternalServerError, "Couldn't presign upload part", err)
+			return
+		}
+		resp.Parts = append(resp.Parts, presignedPart{PartNumber: partNumber, URL: url})
+	}
+
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+func (cfg *apiConfig) handlerCompleteVideoUpload(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Key      string                  `json:"key"`
+		UploadID string                  `json:"upload_id"`
+		Parts    []storage.CompletedPart `json:"parts"`
+	}
+
+	uploader, ok := cfg.videoStorage.(storage.DirectUploader)
+	if !ok {
+		respondWithError(w, http.StatusNotImplemented, "Direct uploads aren't supported by this storage backend", nil)
+		return
+	}
+
+	video, ok := cfg.authorizeVideoOwner(w, r)
+	if !ok {
+		return
+	}
+
+	params := parameters{}
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if !strings.HasPrefix(params.Key, directUploadPrefix+video.ID.String()+"/") {
+		respondWithError(w, http.StatusBadRequest, "Key doesn't belong to this video", nil)
+		return
+	}
+	// completing again, e.g. a retry after a dropped response, mustn't
+	// queue the upload twice or delete it from under its job
+	_, err = cfg.db.GetUnfinishedJobBySourceKey(r.Context(), params.Key)
+	if err == nil {
+		respondWithError(w, http.StatusConflict, "Upload is already queued for processing", nil)
+		return
+	}
+	if !errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check for a queued upload", err)
+		return
+	}
+
+	if params.UploadID != "" {
+		err = uploader.CompleteMultipartUpload(r.Context(), params.Key, params.UploadID, params.Parts)
+		if err != nil {
+			uploader.AbortMultipartUpload(context.WithoutCancel(r.Context()), params.Key, params.UploadID)
+			respondWithError(w, http.StatusBadRequest, "Couldn't complete multipart upload", err)
+			return
+		}
+	}
+
+	info, err := cfg.videoStorage.Head(r.Context(), params.Key)
+	if errors.Is(err, storage.ErrNotFound) {
+		respondWithError(w, http.StatusBadRequest, "Uploaded object not found", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check uploaded object", err)
+		return
+	}
+	if info.Size <= 0 || info.Size > maxVideoUploadSize {
+		respondWithError(w, http.StatusBadRequest, "Uploaded object has an invalid size", nil)
+		return
+	}
+	// the size given when presigning isn't binding
+	if !cfg.checkQuota(w, r, video.UserID, info.Size, video.VideoBytes) {
+		cfg.deleteObject(context.WithoutCancel(r.Context()), storageNameVideo, params.Key)
+		return
+	}
+	medType, err := cfg.validateVideoMediaType(info.ContentType)
+	if err == nil {
+		err = cfg.sniffStoredVideo(r.Context(), params.Key, medType)
+	}
+	if errors.As(err, &unsupportedMediaError{}) {
+		cfg.deleteObject(context.WithoutCancel(r.Context()), storageNameVideo, params.Key)
+		respondWithUnsupportedMedia(w, cfg.acceptedVideoTypes, err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't check uploaded object", err)
+		return
+	}
+
+	job, err := cfg.enqueueVideoJob(r.Context(), video, database.CreateJobParams{
+		VideoID:   video.ID,
+		UserID:    video.UserID,
+		SourceKey: params.Key,
+		MediaType: medType,
+		Size:      info.Size,
+	})
+	if errors.Is(err, database.ErrConflict) {
+		respondWithError(w, http.StatusConflict, "Upload is already queued for processing", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't queue video for processing", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusAccepted, job)
+}
+
+func generateDirectUploadKey(videoID uuid.UUID, ext string) string {
+	random := make([]byte, 32)
+	rand.Read(random)
+	b64Str := base64.RawURLEncoding.EncodeToString(random)
+
+	return fmt.Sprintf("%s%s/%s%s", directUploadPrefix, videoID, b64Str, ext)
+}
+
+// sniffStoredVideo checks the start of an uploaded object with
+// checkVideoContent. ffprobe runs once the job has downloaded it.
+func (cfg *apiConfig) sniffStoredVideo(ctx context.Context, key, mediaType string) error {
+	body, _, err := cfg.videoStorage.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	return sniffVideo(body, mediaType)
+}
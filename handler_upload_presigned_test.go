@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+	"github.com/google/uuid"
+)
+
+// directUploadStore lets tests use direct uploads with an in-memory store.
+// Clients "upload" by putting the object themselves. Multipart uploads that
+// haven't been completed or aborted are kept in multipart by upload ID.
+type directUploadStore struct {
+	*storage.MemoryStore
+	multipart map[string]storage.MultipartUpload
+}
+
+func newDirectUploadStore() directUploadStore {
+	return directUploadStore{
+		MemoryStore: storage.NewMemoryStore("http://localhost/objects"),
+		multipart:   map[string]storage.MultipartUpload{},
+	}
+}
+
+func (s directUploadStore) PresignPut(ctx context.Context, key, contentType string, expires time.Duration) (string, error) {
+	return s.URL(key), nil
+}
+
+func (s directUploadStore) CreateMultipartUpload(ctx context.Context, key, contentType string) (string, error) {
+	uploadID := uuid.NewString()
+	s.multipart[uploadID] = storage.MultipartUpload{Key: key, UploadID: uploadID, Initiated: time.Now()}
+	return uploadID, nil
+}
+
+func (s directUploadStore) PresignUploadPart(ctx context.Context, key, uploadID string, partNumber int32, expires time.Duration) (string, error) {
+	return s.URL(key), nil
+}
+
+func (s directUploadStore) CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []storage.CompletedPart) error {
+	delete(s.multipart, uploadID)
+	return nil
+}
+
+func (s directUploadStore) AbortMultipartUpload(ctx context.Context, key, uploadID string) error {
+	delete(s.multipart, uploadID)
+	return nil
+}
+
+func (s directUploadStore) ListMultipartUploads(ctx context.Context, prefix string) ([]storage.MultipartUpload, error) {
+	uploads := []storage.MultipartUpload{}
+	for _, upload := range s.multipart {
+		if strings.HasPrefix(upload.Key, prefix) {
+			uploads = append(uploads, upload)
+		}
+	}
+	return uploads, nil
+}
+
+func newCompleteUploadRequest(t *testing.T, videoID uuid.UUID, token, key string) *http.Request {
+	t.Helper()
+	body, err := json.Marshal(map[string]string{"key": key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/api/video_upload/"+videoID.String()+"/complete", bytes.NewReader(body))
+	r.Header.Set("Authorization", "Bearer "+token)
+	r.SetPathValue("videoID", videoID.String())
+	return r
+}
+
+// TestHandlerCompleteVideoUploadTwice checks completing an upload again
+// while its job is waiting neither queues it twice nor deletes it.
+func TestHandlerCompleteVideoUploadTwice(t *testing.T) {
+	cfg, db, _ := newTestConfig(t)
+	cfg.videoStorage = newDirectUploadStore()
+	user, token := createTestUser(t, cfg, "user@example.com")
+	video := createTestVideo(t, cfg, user.ID)
+	ctx := context.Background()
+
+	key := generateDirectUploadKey(video.ID, ".mp4")
+	err := cfg.videoStorage.Put(ctx, key, bytes.NewReader(testMP4()), "video/mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantStatuses := []int{http.StatusAccepted, http.StatusConflict}
+	for _, want := range wantStatuses {
+		w := httptest.NewRecorder()
+		cfg.handlerCompleteVideoUpload(w, newCompleteUploadRequest(t, video.ID, token, key))
+		if w.Code != want {
+			t.Errorf("status = %d, want %d: %s", w.Code, want, w.Body)
+		}
+	}
+
+	jobs, err := db.GetUnfinishedJobs(ctx)
+	if err != nil {
+		t.Fatalf("GetUnfinishedJobs: %v", err)
+	}
+	if len(jobs) != 1 {
+		t.Errorf("%d jobs queued, want 1", len(jobs))
+	}
+	if _, err := cfg.videoStorage.Head(ctx, key); err != nil {
+		t.Errorf("uploaded object was deleted: %v", err)
+	}
+}
@@ -1,22 +1,33 @@
 package main
 
 import (
+	"bytes"
 	"crypto/rand"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 	"mime"
 	"mime/multipart"
 	"net/http"
-	"os"
-	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
 	"github.com/google/uuid"
 )
 
+const (
+	maxThumbnailUploadSize = 10 << 20
+	// maxThumbnailPixels bounds how much memory decoding a thumbnail can
+	// take, a small file can still claim huge dimensions.
+	maxThumbnailPixels = 4096 * 4096
+)
+
 func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxThumbnailUploadSize)
+
 	videoIDString := r.PathValue("videoID")
 	videoID, err := uuid.Parse(videoIDString)
 	if err != nil {
@@ -38,8 +49,27 @@ func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Requ
 
 	fmt.Println("uploading thumbnail for video", videoID, "by user", userID)
 
+	videoDb, err := cfg.db.GetVideo(r.Context(), videoID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not get video data", err)
+		return
+	}
+	if videoDb.UserID != userID {
+		respondWithError(w, http.StatusUnauthorized, "unautherized user", err)
+		return
+	}
+
 	const maxMemory = 10 << 20
 	err = r.ParseMultipartForm(maxMemory)
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		respondWithError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("thumbnail must be at most %d bytes", maxThumbnailUploadSize), err)
+		return
+	}
 	if err != nil {
 		respondWithError(w, http.StatusBadRequest, "could not parse multipart form", err)
 		return
@@ -57,18 +87,26 @@ func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Requ
 		respondWithError(w, http.StatusBadRequest, "could not parse media type", err)
 		return
 	}
-	if medType != "image/png" && medType != "image/jpeg" {
-		respondWithError(w, http.StatusBadRequest, "unsupported file type", err)
+	if !slices.Contains(acceptedImageTypes, medType) {
+		respondWithUnsupportedMedia(w, acceptedImageTypes, errUnsupportedMedia("unsupported media type %s", medType))
 		return
 	}
 
-	videoDb, err := cfg.db.GetVideo(videoID)
+	data, err := io.ReadAll(file)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "could not get video data", err)
+		respondWithError(w, http.StatusBadRequest, "Unable to read form file", err)
 		return
 	}
-	if videoDb.UserID != userID {
-		respondWithError(w, http.StatusUnauthorized, "unautherized user", err)
+	decodedType, err := decodeImage(data, maxThumbnailPixels)
+	if err == nil && decodedType != medType {
+		err = errUnsupportedMedia("file content is %s, not %s", decodedType, medType)
+	}
+	if err != nil {
+		respondWithUnsupportedMedia(w, acceptedImageTypes, err)
+		return
+	}
+
+	if !cfg.checkQuota(w, r, userID, int64(len(data)), 0) {
 		return
 	}
 
@@ -78,52 +116,39 @@ func (cfg *apiConfig) handlerUploadThumbnail(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	thUrl, err := createThumbnailFileName(file, ext, cfg.assetsRoot, cfg.port)
+	thKey := generateThumbnailKey(ext)
+	err = cfg.thumbnailStorage.Put(r.Context(), thKey, bytes.NewReader(data), medType)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "could not create file", err)
 		return
 	}
-	videoDb.ThumbnailURL = &thUrl
-
-	err = cfg.db.UpdateVideo(videoDb)
+	err = cfg.db.SetVideoThumbnail(r.Context(), videoDb.ID, thKey)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "could not save video data to database", err)
 		return
 	}
+	videoDb, err = cfg.db.GetVideo(r.Context(), videoDb.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not get video data", err)
+		return
+	}
+	videoDb = cfg.updateVideoUsage(r.Context(), videoDb)
+
+	videoDb, err = cfg.videoWithURLs(r.Context(), videoDb)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video URLs", err)
+		return
+	}
 
 	respondWithJSON(w, http.StatusOK, videoDb)
 }
 
-func createThumbnailFileName(file io.Reader, ext, assetsRoot, port string) (string, error) {
+func generateThumbnailKey(ext string) string {
 	random := make([]byte, 32)
 	rand.Read(random)
 	b64Str := base64.RawURLEncoding.EncodeToString(random)
 
-	thPath := fmt.Sprintf("%s.%s", b64Str, ext)
-	thPath = filepath.Join(assetsRoot, thPath)
-
-	err := createThumbnailFile(thPath, file)
-	if err != nil {
-		return "", err
-	}
-
-	return fmt.Sprintf("http://localhost:%s/assets/%s.%s", port, b64Str, ext), err
-}
-
-func createThumbnailFile(thPath string, file io.Reader) error {
-	osFile, err := os.Create(thPath)
-	if err != nil {
-		return nil
-	}
-	defer osFile.Close()
-
-	_, err = io.Copy(osFile, file)
-	if err != nil {
-		return nil
-	}
-	fmt.Printf("Created file at: %s\n", thPath)
-
-	return nil
+	return fmt.Sprintf("%s.%s", b64Str, ext)
 }
 
 func getFileExtension(header *multipart.FileHeader) (string, error) {
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+func setTusHeaders(w http.ResponseWriter) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Cache-Control", "no-store")
+}
+
+func checkTusResumable(w http.ResponseWriter, r *http.Request) bool {
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		respondWithError(w, http.StatusPreconditionFailed, "Unsupported tus version", nil)
+		return false
+	}
+	return true
+}
+
+func (cfg *apiConfig) handlerTusOptions(w http.ResponseWriter, r *http.Request) {
+	setTusHeaders(w)
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", tusExtensions)
+	w.Header().Set("Tus-Max-Size", strconv.FormatInt(tusMaxSize, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerTusCreate(w http.ResponseWriter, r *http.Request) {
+	setTusHeaders(w)
+	if !checkTusResumable(w, r) {
+		return
+	}
+
+	video, ok := cfg.authorizeVideoOwner(w, r)
+	if !ok {
+		return
+	}
+
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		respondWithError(w, http.StatusBadRequest, "Invalid Upload-Length", err)
+		return
+	}
+	if length > tusMaxSize {
+		respondWithError(w, http.StatusRequestEntityTooLarge, "Upload exceeds Tus-Max-Size", nil)
+		return
+	}
+	if !cfg.checkQuota(w, r, video.UserID, length, video.VideoBytes) {
+		return
+	}
+
+	metadata, err := parseTusMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid Upload-Metadata", err)
+		return
+	}
+	if metadata["filetype"] == "" {
+		metadata["filetype"] = "video/mp4"
+	}
+	_, err = cfg.validateVideoMediaType(metadata["filetype"])
+	if err != nil {
+		respondWithUnsupportedMedia(w, cfg.acceptedVideoTypes, err)
+		return
+	}
+
+	upload := tusUpload{
+		ID:        uuid.New(),
+		VideoID:   video.ID,
+		UserID:    video.UserID,
+		Length:    length,
+		Metadata:  metadata,
+		CreatedAt: time.Now().UTC(),
+	}
+	err = cfg.tusUploads.create(upload)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create upload", err)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/api/video_upload/%s/tus/%s", video.ID, upload.ID))
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (cfg *apiConfig) handlerTusHead(w http.ResponseWriter, r *http.Request) {
+	setTusHeaders(w)
+
+	upload, ok := cfg.authorizeTusUpload(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	w.WriteHeader(http.StatusOK)
+}
+
+func (cfg *apiConfig) handlerTusPatch(w http.ResponseWriter, r *http.Request) {
+	setTusHeaders(w)
+	if !checkTusResumable(w, r) {
+		return
+	}
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		respondWithError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/offset+octet-stream", nil)
+		return
+	}
+
+	upload, ok := cfg.authorizeTusUpload(w, r)
+	if !ok {
+		return
+	}
+
+	unlock := cfg.tusUploads.lock(upload.ID)
+	defer unlock()
+
+	// re-read under the lock, another request may have moved the offset
+	upload, err := cfg.tusUploads.get(upload.ID)
+	if errors.Is(err, errTusUploadNotFound) {
+		respondWithError(w, http.StatusNotFound, "Upload not found", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get upload", err)
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid Upload-Offset", err)
+		return
+	}
+	if offset != upload.Offset {
+		respondWithError(w, http.StatusConflict, "Upload-Offset doesn't match the current offset", nil)
+		return
+	}
+
+	body := newProgressReader(r.Body, func(read int64) {
+		received := upload.Offset + read
+		cfg.progress.publish(upload.VideoID, progressEvent{
+			Stage:   progressStageReceiving,
+			Percent: percentOf(received, upload.Length),
+			Bytes:   received,
+			Total:   upload.Length,
+		})
+	})
+	newOffset, err := cfg.tusUploads.write(upload, body)
+	if err != nil {
+		// the client resumes with a HEAD request, keep what was received
+		log.Printf("tus upload %s interrupted at offset %d: %v", upload.ID, newOffset, err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't write upload data", err)
+		return
+	}
+	upload.Offset = newOffset
+
+	if upload.Offset == upload.Length {
+		job, err := cfg.finishTusUpload(r.Context(), upload)
+		if errors.As(err, &unsupportedMediaError{}) {
+			// resuming can't fix the content, drop the upload
+			cfg.tusUploads.remove(upload.ID)
+			respondWithUnsupportedMedia(w, cfg.acceptedVideoTypes, err)
+			return
+		}
+		if errors.Is(err, database.ErrNotFound) {
+			// the video was deleted while it was being uploaded
+			cfg.tusUploads.remove(upload.ID)
+			respondWithError(w, http.StatusNotFound, "Video not found", nil)
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't queue video for processing", err)
+			return
+		}
+		w.Header().Set("Tubely-Job-Id", job.ID.String())
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerTusDelete(w http.ResponseWriter, r *http.Request) {
+	setTusHeaders(w)
+	if !checkTusResumable(w, r) {
+		return
+	}
+
+	upload, ok := cfg.authorizeTusUpload(w, r)
+	if !ok {
+		return
+	}
+
+	unlock := cfg.tusUploads.lock(upload.ID)
+	defer unlock()
+
+	err := cfg.tusUploads.remove(upload.ID)
+	if err != nil && !errors.Is(err, errTusUploadNotFound) {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't terminate upload", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// finishTusUpload stores a completed upload in video storage and queues
+// it for processing.
+func (cfg *apiConfig) finishTusUpload(ctx context.Context, upload tusUpload) (database.Job, error) {
+	video, err := cfg.db.GetVideo(ctx, upload.VideoID)
+	if err != nil {
+		return database.Job{}, err
+	}
+
+	_, err = cfg.verifyVideoFile(ctx, cfg.tusUploads.dataPath(upload.ID), upload.Metadata["filetype"])
+	if err != nil {
+		return database.Job{}, err
+	}
+
+	// the upload is kept until the job is queued, so the client can retry
+	// finishing it
+	sourceKey, err := cfg.stageJobSource(ctx, upload.VideoID, cfg.tusUploads.dataPath(upload.ID), upload.Metadata["filetype"])
+	if err != nil {
+		return database.Job{}, err
+	}
+
+	job, err := cfg.enqueueVideoJob(ctx, video, database.CreateJobParams{
+		VideoID:   upload.VideoID,
+		UserID:    upload.UserID,
+		SourceKey: sourceKey,
+		MediaType: upload.Metadata["filetype"],
+		Size:      upload.Length,
+	})
+	if err != nil {
+		cfg.deleteObject(context.WithoutCancel(ctx), storageNameVideo, sourceKey)
+		return database.Job{}, err
+	}
+
+	err = cfg.tusUploads.remove(upload.ID)
+	if err != nil && !errors.Is(err, errTusUploadNotFound) {
+		log.Printf("Couldn't remove finished tus upload %s: %v", upload.ID, err)
+	}
+	return job, nil
+}
+
+func (cfg *apiConfig) authorizeTusUpload(w http.ResponseWriter, r *http.Request) (tusUpload, bool) {
+	userID, err := authenticateUser(w, r, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return tusUpload{}, false
+	}
+
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return tusUpload{}, false
+	}
+	uploadID, err := uuid.Parse(r.PathValue("uploadID"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Upload not found", err)
+		return tusUpload{}, false
+	}
+
+	upload, err := cfg.tusUploads.get(uploadID)
+	if errors.Is(err, errTusUploadNotFound) || (err == nil && upload.VideoID != videoID) {
+		respondWithError(w, http.StatusNotFound, "Upload not found", err)
+		return tusUpload{}, false
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get upload", err)
+		return tusUpload{}, false
+	}
+	if upload.UserID != userID {
+		respondWithError(w, http.StatusUnauthorized, "unautherized user", nil)
+		return tusUpload{}, false
+	}
+	return upload, true
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strconv"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+// createTusUpload starts a tus upload of length bytes of MP4 for the video
+// and returns its ID.
+func createTusUpload(t *testing.T, cfg *apiConfig, videoID uuid.UUID, token string, length int) uuid.UUID {
+	t.Helper()
+	if cfg.tusUploads == nil {
+		tusUploads, err := newTusStore(t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg.tusUploads = tusUploads
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/api/video_upload/"+videoID.String()+"/tus", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	r.Header.Set("Tus-Resumable", tusVersion)
+	r.Header.Set("Upload-Length", strconv.Itoa(length))
+	r.Header.Set("Upload-Metadata", "filetype "+base64.StdEncoding.EncodeToString([]byte("video/mp4")))
+	r.SetPathValue("videoID", videoID.String())
+	w := httptest.NewRecorder()
+	cfg.handlerTusCreate(w, r)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create status = %d, want %d: %s", w.Code, http.StatusCreated, w.Body)
+	}
+	uploadID, err := uuid.Parse(path.Base(w.Header().Get("Location")))
+	if err != nil {
+		t.Fatalf("Location %q: %v", w.Header().Get("Location"), err)
+	}
+	return uploadID
+}
+
+func newTusRequest(method string, videoID, uploadID uuid.UUID, token string, offset string, body io.Reader) *http.Request {
+	r := httptest.NewRequest(method, "/api/video_upload/"+videoID.String()+"/tus/"+uploadID.String(), body)
+	r.Header.Set("Authorization", "Bearer "+token)
+	r.Header.Set("Tus-Resumable", tusVersion)
+	if method == http.MethodPatch {
+		r.Header.Set("Content-Type", "application/offset+octet-stream")
+		r.Header.Set("Upload-Offset", offset)
+	}
+	r.SetPathValue("videoID", videoID.String())
+	r.SetPathValue("uploadID", uploadID.String())
+	return r
+}
+
+// tusOffset asks for the upload's offset with a HEAD request, the way a
+// client resumes.
+func tusOffset(t *testing.T, cfg *apiConfig, videoID, uploadID uuid.UUID, token string) int64 {
+	t.Helper()
+	w := httptest.NewRecorder()
+	cfg.handlerTusHead(w, newTusRequest(http.MethodHead, videoID, uploadID, token, "", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("HEAD status = %d, want %d", w.Code, http.StatusOK)
+	}
+	offset, err := strconv.ParseInt(w.Header().Get("Upload-Offset"), 10, 64)
+	if err != nil {
+		t.Fatalf("Upload-Offset: %v", err)
+	}
+	return offset
+}
+
+// failingReader returns data and then fails, like a connection that drops
+// partway through a PATCH.
+type failingReader struct {
+	data []byte
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, errors.New("connection reset")
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestHandlerTusPatchResumes(t *testing.T) {
+	cfg, db, _ := newTestConfig(t)
+	user, token := createTestUser(t, cfg, "user@example.com")
+	video := createTestVideo(t, cfg, user.ID)
+	data := testMP4()
+	uploadID := createTusUpload(t, cfg, video.ID, token, len(data))
+
+	// the connection drops after the first 1000 bytes
+	w := httptest.NewRecorder()
+	cfg.handlerTusPatch(w, newTusRequest(http.MethodPatch, video.ID, uploadID, token, "0", &failingReader{data: data[:1000]}))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("interrupted PATCH status = %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+	if offset := tusOffset(t, cfg, video.ID, uploadID, token); offset != 1000 {
+		t.Fatalf("offset after interrupted PATCH = %d, want 1000", offset)
+	}
+
+	// resuming from the start would write the received bytes twice
+	w = httptest.NewRecorder()
+	cfg.handlerTusPatch(w, newTusRequest(http.MethodPatch, video.ID, uploadID, token, "0", bytes.NewReader(data)))
+	if w.Code != http.StatusConflict {
+		t.Errorf("PATCH at a stale offset status = %d, want %d", w.Code, http.StatusConflict)
+	}
+
+	w = httptest.NewRecorder()
+	cfg.handlerTusPatch(w, newTusRequest(http.MethodPatch, video.ID, uploadID, token, "1000", bytes.NewReader(data[1000:2000])))
+	if w.Code != http.StatusNoContent || w.Header().Get("Upload-Offset") != "2000" {
+		t.Fatalf("PATCH status = %d, offset %s, want %d at 2000: %s", w.Code, w.Header().Get("Upload-Offset"), http.StatusNoContent, w.Body)
+	}
+
+	// anything past Upload-Length is ignored
+	rest := append(bytes.Clone(data[2000:]), "trailing bytes"...)
+	w = httptest.NewRecorder()
+	cfg.handlerTusPatch(w, newTusRequest(http.MethodPatch, video.ID, uploadID, token, "2000", bytes.NewReader(rest)))
+	if w.Code != http.StatusNoContent || w.Header().Get("Upload-Offset") != strconv.Itoa(len(data)) {
+		t.Fatalf("final PATCH status = %d, offset %s, want %d at %d: %s", w.Code, w.Header().Get("Upload-Offset"), http.StatusNoContent, len(data), w.Body)
+	}
+
+	jobID, err := uuid.Parse(w.Header().Get("Tubely-Job-Id"))
+	if err != nil {
+		t.Fatalf("Tubely-Job-Id %q: %v", w.Header().Get("Tubely-Job-Id"), err)
+	}
+	job, err := db.GetJob(context.Background(), jobID)
+	if err != nil {
+		t.Fatalf("GetJob: %v", err)
+	}
+	if job.Status != database.StatusQueued || job.Size != int64(len(data)) {
+		t.Errorf("job = %s with %d bytes, want queued with %d", job.Status, job.Size, len(data))
+	}
+	if staged := readTestObject(t, cfg.videoStorage, job.SourceKey); staged != string(data) {
+		t.Errorf("staged source is %d bytes, want the %d uploaded", len(staged), len(data))
+	}
+	if _, err := cfg.tusUploads.get(uploadID); !errors.Is(err, errTusUploadNotFound) {
+		t.Errorf("finished upload wasn't removed: %v", err)
+	}
+}
+
+func TestHandlerTusPatchRejects(t *testing.T) {
+	cfg, _, _ := newTestConfig(t)
+	user, token := createTestUser(t, cfg, "user@example.com")
+	_, otherToken := createTestUser(t, cfg, "other@example.com")
+	video := createTestVideo(t, cfg, user.ID)
+	otherVideo := createTestVideo(t, cfg, user.ID)
+	uploadID := createTusUpload(t, cfg, video.ID, token, len(testMP4()))
+
+	tests := []struct {
+		name       string
+		request    func() *http.Request
+		wantStatus int
+	}{
+		{"no Tus-Resumable", func() *http.Request {
+			r := newTusRequest(http.MethodPatch, video.ID, uploadID, token, "0", bytes.NewReader([]byte("data")))
+			r.Header.Del("Tus-Resumable")
+			return r
+		}, http.StatusPreconditionFailed},
+		{"wrong Content-Type", func() *http.Request {
+			r := newTusRequest(http.MethodPatch, video.ID, uploadID, token, "0", bytes.NewReader([]byte("data")))
+			r.Header.Set("Content-Type", "video/mp4")
+			return r
+		}, http.StatusUnsupportedMediaType},
+		{"missing offset", func() *http.Request {
+			return newTusRequest(http.MethodPatch, video.ID, uploadID, token, "", bytes.NewReader([]byte("data")))
+		}, http.StatusBadRequest},
+		{"offset ahead of the upload", func() *http.Request {
+			return newTusRequest(http.MethodPatch, video.ID, uploadID, token, "4", bytes.NewReader([]byte("data")))
+		}, http.StatusConflict},
+		{"someone else's upload", func() *http.Request {
+			return newTusRequest(http.MethodPatch, video.ID, uploadID, otherToken, "0", bytes.NewReader([]byte("data")))
+		}, http.StatusUnauthorized},
+		{"another video's upload", func() *http.Request {
+			return newTusRequest(http.MethodPatch, otherVideo.ID, uploadID, token, "0", bytes.NewReader([]byte("data")))
+		}, http.StatusNotFound},
+		{"unknown upload", func() *http.Request {
+			return newTusRequest(http.MethodPatch, video.ID, uuid.New(), token, "0", bytes.NewReader([]byte("data")))
+		}, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			cfg.handlerTusPatch(w, tt.request())
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+		})
+	}
+
+	if offset := tusOffset(t, cfg, video.ID, uploadID, token); offset != 0 {
+		t.Errorf("rejected PATCHes moved the offset to %d", offset)
+	}
+}
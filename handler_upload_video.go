@@ -1,37 +1,31 @@
 package main
 
 import (
-	"bytes"
+	"bufio"
 	"context"
 	"crypto/rand"
 	"encoding/base64"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"mime"
+	"log"
 	"mime/multipart"
 	"net/http"
 	"os"
-	"os/exec"
-
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"path"
+	"strings"
+	"time"
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/media"
 	"github.com/google/uuid"
 )
 
-type VideoMetaData struct {
-	Streams []struct {
-		CodecType string `json:"codec_type"`
-		Width     int    `json:"width"`
-		Height    int    `json:"height"`
-	} `json:"streams"`
-}
+const maxVideoUploadSize = 10 << 30
 
 func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request) {
-	const maxMemory = 10 << 30
-	r.Body = http.MaxBytesReader(w, r.Body, maxMemory)
+	r.Body = http.MaxBytesReader(w, r.Body, maxVideoUploadSize)
 
 	userID, err := authenticateUser(w, r, cfg.jwtSecret)
 	if err != nil {
@@ -45,7 +39,11 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	videoDB, err := cfg.db.GetVideo(videoID)
+	videoDB, err := cfg.db.GetVideo(r.Context(), videoID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return
+	}
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Could not get video from db", err)
 		return
@@ -54,172 +52,346 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 		respondWithError(w, http.StatusUnauthorized, "unautherized user", err)
 		return
 	}
+	if !cfg.checkQuota(w, r, userID, max(r.ContentLength, 0), videoDB.VideoBytes) {
+		return
+	}
 
-	file, header, err := r.FormFile("video")
+	// stream the file straight to the spool instead of letting ParseMultipartForm
+	// buffer it, so progress can be reported as it arrives
+	reader, err := r.MultipartReader()
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "unable to get video data", err)
+		respondWithError(w, http.StatusBadRequest, "expected a multipart form", err)
 		return
 	}
-	defer file.Close()
+	var part *multipart.Part
+	for {
+		part, err = reader.NextPart()
+		if err == io.EOF {
+			respondWithError(w, http.StatusBadRequest, "missing video file", nil)
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "unable to get video data", err)
+			return
+		}
+		if part.FormName() == "video" {
+			break
+		}
+		part.Close()
+	}
+	defer part.Close()
 
-	medType, err := validateVideoFile(header)
+	medType, err := cfg.validateVideoMediaType(part.Header.Get("Content-Type"))
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "invalid media file", err)
+		respondWithUnsupportedMedia(w, cfg.acceptedVideoTypes, err)
 		return
 	}
 
-	tempFile, err := os.CreateTemp("", "tubely_default.mp4")
+	// reject files that only claim to be videos before reading the rest
+	body := bufio.NewReaderSize(part, sniffLen)
+	head, err := body.Peek(sniffLen)
+	if err != nil && err != io.EOF {
+		respondWithError(w, http.StatusInternalServerError, "unable to get video data", err)
+		return
+	}
+	err = checkVideoContent(head, medType)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "could not create temp video file", err)
+		respondWithUnsupportedMedia(w, cfg.acceptedVideoTypes, err)
 		return
 	}
-	defer os.Remove(tempFile.Name())
-	defer tempFile.Close()
 
-	_, err = io.Copy(tempFile, file)
+	spoolFile, err := cfg.createSpoolFile("upload-*")
 	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not create temp video file", err)
+		return
+	}
+	defer spoolFile.Close()
+
+	total := max(r.ContentLength, 0)
+	size, err := io.Copy(spoolFile, newProgressReader(body, func(read int64) {
+		cfg.progress.publish(videoDB.ID, progressEvent{
+			Stage:   progressStageReceiving,
+			Percent: percentOf(read, total),
+			Bytes:   read,
+			Total:   total,
+		})
+	}))
+	if err != nil {
+		os.Remove(spoolFile.Name())
+		cfg.progress.publish(videoDB.ID, progressEvent{Stage: progressStageFailed, Error: "upload interrupted"})
 		respondWithError(w, http.StatusInternalServerError, "error saving file", err)
 		return
 	}
+	// chunked requests don't say how big they are up front
+	if !cfg.checkQuota(w, r, userID, size, videoDB.VideoBytes) {
+		os.Remove(spoolFile.Name())
+		cfg.progress.publish(videoDB.ID, progressEvent{Stage: progressStageFailed, Error: "storage quota exceeded"})
+		return
+	}
 
-	_, err = tempFile.Seek(0, io.SeekStart)
+	_, err = cfg.verifyVideoFile(r.Context(), spoolFile.Name(), medType)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "error resetting file pointer", err)
+		os.Remove(spoolFile.Name())
+		cfg.progress.publish(videoDB.ID, progressEvent{Stage: progressStageFailed, Error: err.Error()})
+		if errors.As(err, &unsupportedMediaError{}) {
+			respondWithUnsupportedMedia(w, cfg.acceptedVideoTypes, err)
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "couldn't verify video file", err)
 		return
 	}
 
-	key, err := generateBucketKey(tempFile.Name())
+	sourceKey, err := cfg.stageJobSource(r.Context(), videoDB.ID, spoolFile.Name(), medType)
+	os.Remove(spoolFile.Name())
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "unable to generate bucket key", err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't store video for processing", err)
 		return
 	}
 
-	processedFilePath, err := processVideoForFastStart(tempFile.Name())
+	job, err := cfg.enqueueVideoJob(r.Context(), videoDB, database.CreateJobParams{
+		VideoID:   videoDB.ID,
+		UserID:    userID,
+		SourceKey: sourceKey,
+		MediaType: medType,
+		Size:      size,
+	})
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "error creating processed video", err)
+		cfg.deleteObject(context.WithoutCancel(r.Context()), storageNameVideo, sourceKey)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't queue video for processing", err)
 		return
 	}
+
+	respondWithJSON(w, http.StatusAccepted, job)
+}
+
+// processVideoUpload runs an uploaded file through the processing pipeline,
+// stores the result and points the video at it. Processing can take hours,
+// so only the columns it owns are written and the video is read again
+// afterwards. reserved is what the upload reserved of the user's quota.
+func (cfg *apiConfig) processVideoUpload(ctx context.Context, video database.Video, filePath, mediaType string, reserved int64, report func(progressEvent)) (database.Video, error) {
+	videoMeta, err := cfg.mediaProcessor.Probe(ctx, filePath)
+	if err != nil {
+		return video, fmt.Errorf("unable to probe video: %w", err)
+	}
+	// direct uploads haven't been checked yet
+	err = checkVideoProbe(videoMeta, mediaType)
+	if err != nil {
+		return video, err
+	}
+	key := generateBucketKey(videoMeta)
+
+	progress := &media.Progress{
+		Duration: videoMeta.Duration(),
+		Report: func(percent float64) {
+			report(progressEvent{Stage: progressStageProcessing, Percent: percent})
+		},
+	}
+	var processedFilePath string
+	if mediaType == mp4MediaType {
+		processedFilePath, err = cfg.processVideoForFastStart(ctx, filePath, progress)
+	} else {
+		processedFilePath, err = cfg.transcodeToMP4(ctx, filePath, progress)
+	}
+	if err != nil {
+		return video, fmt.Errorf("error creating processed video: %w", err)
+	}
 	defer os.Remove(processedFilePath)
 
+	if mediaType != mp4MediaType {
+		// the stored metadata describes the transcoded file
+		videoMeta, err = cfg.mediaProcessor.Probe(ctx, processedFilePath)
+		if err != nil {
+			return video, fmt.Errorf("unable to probe transcoded video: %w", err)
+		}
+	}
+
 	processedFile, err := os.Open(processedFilePath)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "error opening processed video", err)
-		return
+		return video, fmt.Errorf("error opening processed video: %w", err)
 	}
 	defer processedFile.Close()
 
-	_, err = cfg.s3Client.PutObject(context.Background(), &s3.PutObjectInput{
-		Bucket:      aws.String(cfg.s3Bucket),
-		Key:         aws.String(key),
-		Body:        processedFile,
-		ContentType: aws.String(medType),
+	stat, err := processedFile.Stat()
+	if err != nil {
+		return video, fmt.Errorf("error reading processed video: %w", err)
+	}
+
+	size := stat.Size()
+	body := newProgressFile(processedFile, func(read int64) {
+		report(progressEvent{Stage: progressStageStoring, Percent: percentOf(read, size), Bytes: min(read, size), Total: size})
 	})
+
+	err = cfg.checkVideoExists(ctx, video.ID)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "error putting in bucket", err)
-		return
+		return video, err
+	}
+	start := time.Now()
+	err = cfg.videoStorage.Put(ctx, key, body, mp4MediaType)
+	if err != nil {
+		return video, fmt.Errorf("error putting in bucket: %w", err)
+	}
+	logUploadThroughput(video.ID, size, time.Since(start))
+	report(progressEvent{Stage: progressStageStoring, Percent: 100, Bytes: size, Total: size})
+
+	processed := database.ProcessedVideo{VideoKey: &key}
+	if cfg.keepOriginals && mediaType != mp4MediaType {
+		originalKey, err := cfg.storeOriginal(ctx, key, filePath, mediaType)
+		if err != nil {
+			return video, err
+		}
+		processed.OriginalKey = &originalKey
 	}
+	processed.Metadata = videoMetadata(videoMeta)
+	// faststart moves the moov atom, the stored file isn't the probed one
+	processed.Metadata.FileSize = &size
 
-	newUrl := fmt.Sprintf("http://%s/%s", cfg.s3CfDistribution, key)
-	videoDB.VideoURL = &newUrl
-	err = cfg.db.UpdateVideo(videoDB)
+	streaming, err := cfg.generateStreaming(ctx, processedFilePath, videoMeta, videoAssetPrefix(key), cfg.streamingFormats, func(percent float64) {
+		report(progressEvent{Stage: progressStageEncoding, Percent: percent})
+	})
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "unable to update video in database", err)
-		return
+		return video, fmt.Errorf("error generating streaming renditions: %w", err)
+	}
+	processed.HLSKey = streaming.HLSKey
+	processed.DASHKey = streaming.DASHKey
+	processed.StreamingFormats = streaming.Formats
+
+	// previews and thumbnail candidates are optional, a video without them is
+	// still usable so they don't fail the upload
+	previewKey, err := cfg.generatePreviews(ctx, processedFilePath, videoMeta, videoAssetPrefix(key))
+	if err != nil {
+		log.Printf("Couldn't generate previews for video %s: %v", video.ID, err)
+	} else {
+		processed.PreviewVTTKey = &previewKey
+	}
+
+	err = cfg.generateThumbnailCandidates(ctx, video.ID, processedFilePath, videoMeta.Duration())
+	if err != nil {
+		log.Printf("Couldn't generate thumbnail candidates for video %s: %v", video.ID, err)
+	}
+
+	// the processed video can be bigger than the upload, and other uploads
+	// may have been stored in the meantime
+	err = cfg.checkProcessedQuota(ctx, video, processed, reserved)
+	if err != nil {
+		cfg.deleteProcessedAssets(ctx, processed)
+		// the new thumbnail candidates are kept and still take up space
+		if current, getErr := cfg.db.GetVideo(ctx, video.ID); getErr == nil {
+			cfg.updateVideoUsage(ctx, current)
+		}
+		return video, err
 	}
 
-	respondWithJSON(w, http.StatusOK, videoDB)
+	// the video may have been deleted while its outputs were stored
+	err = cfg.checkVideoExists(ctx, video.ID)
+	if err != nil {
+		cfg.deleteProcessedAssets(ctx, processed)
+		cfg.deletePrefix(context.WithoutCancel(ctx), storageNameThumbnail, thumbnailCandidatePrefix(video.ID))
+		return video, err
+	}
+
+	err = cfg.db.SetVideoProcessed(ctx, video.ID, processed)
+	if err != nil {
+		return video, fmt.Errorf("unable to update video in database: %w", err)
+	}
+
+	video, err = cfg.db.GetVideo(ctx, video.ID)
+	if err != nil {
+		return video, fmt.Errorf("unable to get processed video: %w", err)
+	}
+	return cfg.updateVideoUsage(ctx, video), nil
+}
+
+func logUploadThroughput(videoID uuid.UUID, size int64, elapsed time.Duration) {
+	mbPerSecond := float64(size) / (1 << 20) / max(elapsed.Seconds(), 0.001)
+	log.Printf("Uploaded video %s: %d bytes in %s (%.2f MiB/s)", videoID, size, elapsed.Round(time.Millisecond), mbPerSecond)
 }
 
-func processVideoForFastStart(filepath string) (string, error) {
+func (cfg *apiConfig) processVideoForFastStart(ctx context.Context, filepath string, progress *media.Progress) (string, error) {
 	newFilePath := fmt.Sprintf("%s.process", filepath)
-	cmd := exec.Command(
-		"ffmpeg",
+	err := cfg.mediaProcessor.Run(ctx, media.OpRemux, []string{
+		"-y",
 		"-i", filepath,
 		"-c", "copy",
 		"-movflags", "faststart",
 		"-f", "mp4", newFilePath,
-	)
-	var buffer bytes.Buffer
-	cmd.Stdout = &buffer
-	err := cmd.Run()
+	}, progress)
 	if err != nil {
 		return "", err
 	}
 	return newFilePath, nil
 }
 
-func getVideoAspectRatio(filePath string) (string, error) {
-	cmd := exec.Command(
-		"ffprobe",
-		"-v", "error",
-		"-print_format", "json",
-		"-show_streams",
-		filePath,
-	)
-	var buffer bytes.Buffer
-	cmd.Stdout = &buffer
-	err := cmd.Run()
+// transcodeToMP4 normalizes uploads in other containers to the H.264/AAC
+// MP4 with faststart that the rest of the pipeline expects.
+func (cfg *apiConfig) transcodeToMP4(ctx context.Context, filepath string, progress *media.Progress) (string, error) {
+	newFilePath := fmt.Sprintf("%s.process", filepath)
+	err := cfg.mediaProcessor.Run(ctx, media.OpTranscode, []string{
+		"-y",
+		"-i", filepath,
+		"-map", "0:v:0",
+		"-map", "0:a:0?",
+		"-c:v", "libx264",
+		"-preset", "veryfast",
+		"-crf", "20",
+		"-pix_fmt", "yuv420p",
+		"-c:a", "aac",
+		"-b:a", "192k",
+		"-movflags", "faststart",
+		"-f", "mp4", newFilePath,
+	}, progress)
 	if err != nil {
 		return "", err
 	}
+	return newFilePath, nil
+}
 
-	videoMeta := VideoMetaData{}
-	err = json.Unmarshal(buffer.Bytes(), &videoMeta)
+// storeOriginal keeps an upload as it was sent, under originals/ with the
+// same name as the processed video.
+func (cfg *apiConfig) storeOriginal(ctx context.Context, videoKey, filePath, mediaType string) (string, error) {
+	key := originalsPrefix + strings.TrimSuffix(videoKey, path.Ext(videoKey)) + videoContainers[mediaType].ext
+
+	original, err := os.Open(filePath)
 	if err != nil {
 		return "", err
 	}
+	defer original.Close()
 
-	width := videoMeta.Streams[0].Width
-	height := videoMeta.Streams[0].Height
-
-	if float32(width)/float32(height) == 1.7777778 {
-		return "16:9", nil
-	}
-	if float32(width)/float32(height) == 0.56296295 {
-		return "9:16", nil
+	err = cfg.videoStorage.Put(ctx, key, original, mediaType)
+	if err != nil {
+		return "", fmt.Errorf("error storing original video: %w", err)
 	}
-
-	return "other", nil
+	return key, nil
 }
 
-func getPrefix(filepath string) (string, error) {
-	aspectRatio, err := getVideoAspectRatio(filepath)
-	if err != nil {
-		return "", err
+func getVideoAspectRatio(videoMeta media.Metadata) aspectRatio {
+	stream, ok := videoMeta.VideoStream()
+	if !ok {
+		return aspectRatioOther
 	}
+	return classifyAspectRatio(stream)
+}
 
-	if aspectRatio == "16:9" {
-		return "landscape", nil
-	}
-	if aspectRatio == "9:16" {
-		return "portrait", nil
+// videoKeyPrefixes are all the prefixes generateBucketKey can place a video
+// under.
+var videoKeyPrefixes = func() []string {
+	prefixes := []string{aspectRatioOther.keyPrefix() + "/"}
+	for _, bucket := range aspectRatioBuckets {
+		prefixes = append(prefixes, bucket.aspectRatio.keyPrefix()+"/")
 	}
+	return prefixes
+}()
 
-	return "other", nil
-}
+// originalsPrefix is where uploads that had to be transcoded are kept when
+// KEEP_ORIGINALS is set.
+const originalsPrefix = "originals/"
 
-func generateBucketKey(filepath string) (string, error) {
+func generateBucketKey(videoMeta media.Metadata) string {
 	random := make([]byte, 32)
 	rand.Read(random)
 	b64Str := base64.RawURLEncoding.EncodeToString(random)
 
-	prefix, err := getPrefix(filepath)
-	if err != nil {
-		return "", err
-	}
-
-	return fmt.Sprintf("%s/%s.mp4", prefix, b64Str), nil
-}
-
-func validateVideoFile(header *multipart.FileHeader) (string, error) {
-	medType, _, err := mime.ParseMediaType(header.Header.Get("Content-Type"))
-	if err != nil {
-		return "", err
-	}
-	if medType != "video/mp4" {
-		return "", fmt.Errorf("unsupported media type")
-	}
-	return medType, nil
+	prefix := getVideoAspectRatio(videoMeta).keyPrefix()
+	return fmt.Sprintf("%s/%s.mp4", prefix, b64Str)
 }
 
 func authenticateUser(w http.ResponseWriter, r *http.Request, secret string) (uuid.UUID, error) {
@@ -234,3 +406,32 @@ func authenticateUser(w http.ResponseWriter, r *http.Request, secret string) (uu
 	}
 	return userID, nil
 }
+
+func (cfg *apiConfig) authorizeVideoOwner(w http.ResponseWriter, r *http.Request) (database.Video, bool) {
+	userID, err := authenticateUser(w, r, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return database.Video{}, false
+	}
+
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return database.Video{}, false
+	}
+
+	video, err := cfg.db.GetVideo(r.Context(), videoID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return database.Video{}, false
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Could not get video from db", err)
+		return database.Video{}, false
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusUnauthorized, "unautherized user", nil)
+		return database.Video{}, false
+	}
+	return video, true
+}
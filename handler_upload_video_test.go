@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/media"
+	"github.com/google/uuid"
+)
+
+func TestHandlerUploadVideoQueuesJob(t *testing.T) {
+	cfg, db, _ := newTestConfig(t)
+	user, token := createTestUser(t, cfg, "user@example.com")
+	video := createTestVideo(t, cfg, user.ID)
+	data := testMP4()
+
+	w := httptest.NewRecorder()
+	cfg.handlerUploadVideo(w, newVideoUploadRequest(t, video.ID, token, "video/mp4", data))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusAccepted, w.Body)
+	}
+
+	var job database.Job
+	decodeTestResponse(t, w, &job)
+	stored, err := db.GetJob(context.Background(), job.ID)
+	if err != nil {
+		t.Fatalf("GetJob: %v", err)
+	}
+	if stored.Status != database.StatusQueued || stored.VideoID != video.ID || stored.UserID != user.ID {
+		t.Errorf("job = %+v, want it queued for video %s", stored, video.ID)
+	}
+	if stored.Size != int64(len(data)) || stored.MediaType != "video/mp4" {
+		t.Errorf("job size and type = %d, %s, want %d, video/mp4", stored.Size, stored.MediaType, len(data))
+	}
+
+	// the source is staged in storage, not left in the spool
+	info, err := cfg.videoStorage.Head(context.Background(), stored.SourceKey)
+	if err != nil {
+		t.Fatalf("staged source %q: %v", stored.SourceKey, err)
+	}
+	if info.Size != int64(len(data)) {
+		t.Errorf("staged source is %d bytes, want %d", info.Size, len(data))
+	}
+	spooled, _ := os.ReadDir(cfg.jobSpoolDir)
+	if len(spooled) != 0 {
+		t.Errorf("spool directory still has %d files", len(spooled))
+	}
+
+	updated, err := db.GetVideo(context.Background(), video.ID)
+	if err != nil {
+		t.Fatalf("GetVideo: %v", err)
+	}
+	if updated.ProcessingStatus == nil || *updated.ProcessingStatus != database.StatusQueued {
+		t.Errorf("video processing status = %v, want queued", updated.ProcessingStatus)
+	}
+}
+
+func TestHandlerUploadVideoRejects(t *testing.T) {
+	cfg, db, _ := newTestConfig(t)
+	owner, ownerToken := createTestUser(t, cfg, "owner@example.com")
+	_, otherToken := createTestUser(t, cfg, "other@example.com")
+	video := createTestVideo(t, cfg, owner.ID)
+
+	tests := []struct {
+		name        string
+		videoID     uuid.UUID
+		token       string
+		contentType string
+		data        []byte
+		wantStatus  int
+	}{
+		{"no token", video.ID, "", "video/mp4", testMP4(), http.StatusUnauthorized},
+		{"someone else's video", video.ID, otherToken, "video/mp4", testMP4(), http.StatusUnauthorized},
+		{"missing video", uuid.New(), ownerToken, "video/mp4", testMP4(), http.StatusNotFound},
+		{"unaccepted type", video.ID, ownerToken, "image/png", testMP4(), http.StatusUnsupportedMediaType},
+		{"content isn't the declared type", video.ID, ownerToken, "video/mp4", []byte("just some text, not a video at all"), http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			cfg.handlerUploadVideo(w, newVideoUploadRequest(t, tt.videoID, tt.token, tt.contentType, tt.data))
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+		})
+	}
+
+	jobs, err := db.GetUnfinishedJobs(context.Background())
+	if err != nil {
+		t.Fatalf("GetUnfinishedJobs: %v", err)
+	}
+	if len(jobs) != 0 {
+		t.Errorf("%d jobs were queued for rejected uploads", len(jobs))
+	}
+}
+
+// TestHandlerUploadVideoProbe checks uploads ffprobe doesn't accept are
+// rejected before anything is queued.
+func TestHandlerUploadVideoProbe(t *testing.T) {
+	unreadable := &media.CommandError{Op: media.OpProbe, Command: "ffprobe", ExitCode: 1, Err: errors.New("exit status 1")}
+	vp9 := testVideoMetadata()
+	vp9.Streams[0].CodecName = "vp9"
+	audioOnly := testVideoMetadata()
+	audioOnly.Streams = audioOnly.Streams[1:]
+	webm := testVideoMetadata()
+	webm.Format.FormatName = "matroska,webm"
+
+	tests := []struct {
+		name       string
+		metadata   media.Metadata
+		probeErr   error
+		wantStatus int
+	}{
+		{"accepted", testVideoMetadata(), nil, http.StatusAccepted},
+		{"unreadable", media.Metadata{}, unreadable, http.StatusUnsupportedMediaType},
+		{"unsupported codec", vp9, nil, http.StatusUnsupportedMediaType},
+		{"no video stream", audioOnly, nil, http.StatusUnsupportedMediaType},
+		{"different container", webm, nil, http.StatusUnsupportedMediaType},
+		{"probe timed out", media.Metadata{}, &media.CommandError{Op: media.OpProbe, Command: "ffprobe", ExitCode: -1, Err: context.DeadlineExceeded}, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, db, fake := newTestConfig(t)
+			fake.Metadata = tt.metadata
+			fake.ProbeErr = tt.probeErr
+			user, token := createTestUser(t, cfg, "user@example.com")
+			video := createTestVideo(t, cfg, user.ID)
+
+			w := httptest.NewRecorder()
+			cfg.handlerUploadVideo(w, newVideoUploadRequest(t, video.ID, token, "video/mp4", testMP4()))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+
+			jobs, err := db.GetUnfinishedJobs(context.Background())
+			if err != nil {
+				t.Fatalf("GetUnfinishedJobs: %v", err)
+			}
+			if queued := len(jobs) > 0; queued != (tt.wantStatus == http.StatusAccepted) {
+				t.Errorf("%d jobs queued", len(jobs))
+			}
+			spooled, _ := os.ReadDir(cfg.jobSpoolDir)
+			if len(spooled) != 0 {
+				t.Errorf("spool directory still has %d files", len(spooled))
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
@@ -33,10 +34,14 @@ func (cfg *apiConfig) handlerUsersCreate(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	user, err := cfg.db.CreateUser(database.CreateUserParams{
+	user, err := cfg.db.CreateUser(r.Context(), database.CreateUserParams{
 		Email:    params.Email,
 		Password: hashedPassword,
 	})
+	if errors.Is(err, database.ErrConflict) {
+		respondWithError(w, http.StatusConflict, "A user with that email already exists", nil)
+		return
+	}
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't create user", err)
 		return
@@ -44,3 +49,18 @@ func (cfg *apiConfig) handlerUsersCreate(w http.ResponseWriter, r *http.Request)
 
 	respondWithJSON(w, http.StatusCreated, user)
 }
+
+func (cfg *apiConfig) handlerUsageGet(w http.ResponseWriter, r *http.Request) {
+	userID, err := authenticateUser(w, r, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+
+	usage, err := cfg.userUsage(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get storage usage", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, usage)
+}
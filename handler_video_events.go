@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	eventsKeepAliveInterval = 15 * time.Second
+	// the job may be running on another server, whose progress events
+	// don't reach this one, so the stored status is checked as well
+	eventsStatusPollInterval = 2 * time.Second
+	// eventsTokenExpiry only has to cover opening the stream, an open
+	// stream isn't cut off when its token expires.
+	eventsTokenExpiry = 5 * time.Minute
+)
+
+// handlerVideoEventsToken issues a token for the video's event stream.
+// EventSource can't send headers, so the stream takes its token from the
+// URL, where the long-lived access token shouldn't go.
+func (cfg *apiConfig) handlerVideoEventsToken(w http.ResponseWriter, r *http.Request) {
+	type response struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+
+	video, ok := cfg.authorizeVideoOwner(w, r)
+	if !ok {
+		return
+	}
+
+	expiresAt := time.Now().UTC().Add(eventsTokenExpiry)
+	token, err := auth.MakeVideoEventsToken(video.UserID, video.ID, cfg.jwtSecret, eventsTokenExpiry)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create events token", err)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, response{
+		Token:     token,
+		ExpiresAt: expiresAt,
+	})
+}
+
+// handlerVideoEvents streams a video's upload and processing progress as
+// Server-Sent Events. It takes either the access token in the
+// Authorization header or a token from handlerVideoEventsToken in the
+// token query parameter.
+func (cfg *apiConfig) handlerVideoEvents(w http.ResponseWriter, r *http.Request) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	var userID uuid.UUID
+	if token := r.URL.Query().Get("token"); token != "" {
+		userID, err = auth.ValidateVideoEventsToken(token, videoID, cfg.jwtSecret)
+	} else {
+		userID, err = authenticateUser(w, r, cfg.jwtSecret)
+	}
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate token", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(r.Context(), videoID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, "Streaming unsupported", nil)
+		return
+	}
+
+	events, latest, unsubscribe := cfg.progress.subscribe(videoID)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	initial := videoProgressEvent(video)
+	if latest != nil {
+		initial = *latest
+	}
+	if initial.Stage != "" {
+		writeProgressEvent(w, initial)
+	}
+	flusher.Flush()
+
+	stream := videoEventStream{
+		lastStage:  initial.Stage,
+		lastStatus: video.ProcessingStatus,
+		local:      latest != nil,
+	}
+	keepAlive := time.NewTicker(eventsKeepAliveInterval)
+	defer keepAlive.Stop()
+	statusPoll := time.NewTicker(eventsStatusPollInterval)
+	defer statusPoll.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-events:
+			stream.local = true
+			stream.lastStage = event.Stage
+			writeProgressEvent(w, event)
+		case <-statusPoll.C:
+			video, err := cfg.db.GetVideo(r.Context(), videoID)
+			if errors.Is(err, database.ErrNotFound) {
+				return
+			}
+			if err != nil {
+				continue
+			}
+			event, ok := stream.statusChanged(video)
+			if !ok {
+				continue
+			}
+			writeProgressEvent(w, event)
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		}
+		flusher.Flush()
+	}
+}
+
+// videoEventStream tracks what a subscriber has been sent, so a stored
+// status is only sent when it changes and isn't already known from this
+// server's own progress events.
+type videoEventStream struct {
+	lastStage  string
+	lastStatus *string
+	// local is set once this server has published progress for the
+	// video, which is more detailed than the stored status
+	local bool
+}
+
+func (s *videoEventStream) statusChanged(video database.Video) (progressEvent, bool) {
+	if video.ProcessingStatus == nil || (s.lastStatus != nil && *s.lastStatus == *video.ProcessingStatus) {
+		return progressEvent{}, false
+	}
+	s.lastStatus = video.ProcessingStatus
+	event := videoProgressEvent(video)
+	if event.Stage == s.lastStage || (s.local && !event.done()) {
+		return progressEvent{}, false
+	}
+	s.lastStage = event.Stage
+	return event, true
+}
+
+// videoProgressEvent describes a video's stored processing status, for
+// subscribers that connect while nothing is in progress here or whose
+// video is being processed by another server.
+func videoProgressEvent(video database.Video) progressEvent {
+	if video.ProcessingStatus == nil {
+		return progressEvent{}
+	}
+	event := progressEvent{Stage: *video.ProcessingStatus}
+	switch event.Stage {
+	case database.StatusReady:
+		event.Percent = 100
+	case database.StatusFailed:
+		if video.ProcessingError != nil {
+			event.Error = *video.ProcessingError
+		}
+	}
+	return event
+}
+
+func writeProgressEvent(w http.ResponseWriter, event progressEvent) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "event: progress\ndata: %s\n\n", data)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+func TestVideoEventStreamStatusChanged(t *testing.T) {
+	status := func(s string) *string { return &s }
+	processingErr := "boom"
+
+	tests := []struct {
+		name      string
+		stream    videoEventStream
+		video     database.Video
+		wantStage string
+		wantSent  bool
+	}{
+		{
+			"unchanged",
+			videoEventStream{lastStage: "queued", lastStatus: status("queued")},
+			database.Video{ProcessingStatus: status("queued")},
+			"", false,
+		},
+		{
+			"picked up by another server",
+			videoEventStream{lastStage: "queued", lastStatus: status("queued")},
+			database.Video{ProcessingStatus: status("processing")},
+			"processing", true,
+		},
+		{
+			"finished on another server",
+			videoEventStream{lastStage: "processing", lastStatus: status("processing")},
+			database.Video{ProcessingStatus: status("ready")},
+			"ready", true,
+		},
+		{
+			"failed on another server",
+			videoEventStream{lastStage: "queued", lastStatus: status("queued")},
+			database.Video{ProcessingStatus: status("failed"), ProcessingError: &processingErr},
+			"failed", true,
+		},
+		{
+			"local progress is more detailed",
+			videoEventStream{lastStage: "encoding", lastStatus: status("queued"), local: true},
+			database.Video{ProcessingStatus: status("processing")},
+			"", false,
+		},
+		{
+			"already sent locally",
+			videoEventStream{lastStage: "ready", lastStatus: status("processing"), local: true},
+			database.Video{ProcessingStatus: status("ready")},
+			"", false,
+		},
+		{
+			"no status",
+			videoEventStream{},
+			database.Video{},
+			"", false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, sent := tt.stream.statusChanged(tt.video)
+			if sent != tt.wantSent || event.Stage != tt.wantStage {
+				t.Errorf("statusChanged = %q, %v, want %q, %v", event.Stage, sent, tt.wantStage, tt.wantSent)
+			}
+			if sent && event.Stage == database.StatusFailed && event.Error != processingErr {
+				t.Errorf("failed event error = %q, want %q", event.Error, processingErr)
+			}
+		})
+	}
+}
+
+// TestHandlerVideoEventsStoredStatus checks a stream sees a job finish
+// that this server didn't run and so published no events for.
+func TestHandlerVideoEventsStoredStatus(t *testing.T) {
+	cfg, db, _ := newTestConfig(t)
+	user, token := createTestUser(t, cfg, "user@example.com")
+	video := createTestVideo(t, cfg, user.ID)
+	ctx := context.Background()
+	err := db.SetVideoProcessingStatus(ctx, video.ID, database.StatusQueued, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/videos/{videoID}/events", cfg.handlerVideoEvents)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	reqCtx, cancel := context.WithTimeout(ctx, 3*eventsStatusPollInterval)
+	defer cancel()
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, srv.URL+"/api/videos/"+video.ID.String()+"/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	// another server finishes the job
+	err = db.SetVideoProcessingStatus(ctx, video.ID, database.StatusReady, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stages := []string{}
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var event progressEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			t.Fatal(err)
+		}
+		stages = append(stages, event.Stage)
+		if event.done() {
+			break
+		}
+	}
+	want := []string{database.StatusQueued, database.StatusReady}
+	if !slices.Equal(stages, want) {
+		t.Errorf("stages = %v, want %v", stages, want)
+	}
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
 
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
@@ -34,7 +37,7 @@ func (cfg *apiConfig) handlerVideoMetaCreate(w http.ResponseWriter, r *http.Requ
 	}
 	params.UserID = userID
 
-	video, err := cfg.db.CreateVideo(params.CreateVideoParams)
+	video, err := cfg.db.CreateVideo(r.Context(), params.CreateVideoParams)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't create video", err)
 		return
@@ -62,9 +65,13 @@ func (cfg *apiConfig) handlerVideoMetaDelete(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	video, err := cfg.db.GetVideo(videoID)
+	video, err := cfg.db.GetVideo(r.Context(), videoID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return
+	}
 	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
 		return
 	}
 	if video.UserID != userID {
@@ -72,12 +79,29 @@ func (cfg *apiConfig) handlerVideoMetaDelete(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	err = cfg.db.DeleteVideo(videoID)
+	// a job still processing the video would store outputs nothing refers
+	// to, and a queued one would never delete its upload
+	jobs, err := cfg.db.CancelVideoJobs(r.Context(), videoID, errVideoDeleted.Error())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't cancel video processing", err)
+		return
+	}
+
+	err = cfg.db.DeleteVideo(r.Context(), videoID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't delete video", err)
 		return
 	}
 
+	ctx := context.WithoutCancel(r.Context())
+	for _, job := range jobs {
+		cfg.deleteJobSource(ctx, job)
+	}
+	err = cfg.deleteVideoAssets(ctx, video)
+	if err != nil {
+		log.Printf("Couldn't delete all assets of video %s: %v", videoID, err)
+	}
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -89,9 +113,37 @@ func (cfg *apiConfig) handlerVideoGet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	video, err := cfg.db.GetVideo(videoID)
+	video, err := cfg.db.GetVideo(r.Context(), videoID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+
+	// signed URLs grant access to the video, only hand them to its owner
+	if cfg.videoURLSigner != nil {
+		token, err := auth.GetBearerToken(r.Header)
+		if err != nil {
+			respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+			return
+		}
+		userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+		if err != nil {
+			respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+			return
+		}
+		if video.UserID != userID {
+			respondWithError(w, http.StatusForbidden, "You can't view this video", nil)
+			return
+		}
+	}
+
+	video, err = cfg.videoWithURLs(r.Context(), video)
 	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video URLs", err)
 		return
 	}
 
@@ -110,11 +162,17 @@ func (cfg *apiConfig) handlerVideosRetrieve(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	videos, err := cfg.db.GetVideos(userID)
+	videos, err := cfg.db.GetVideos(r.Context(), userID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve videos", err)
 		return
 	}
 
+	videos, err = cfg.videosWithURLs(r.Context(), videos)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video URLs", err)
+		return
+	}
+
 	respondWithJSON(w, http.StatusOK, videos)
 }
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// TestHandlerVideoMetaDeleteCancelsJobs checks deleting a video whose
+// upload is waiting to be processed also deletes the upload.
+func TestHandlerVideoMetaDeleteCancelsJobs(t *testing.T) {
+	cfg, db, _ := newTestConfig(t)
+	user, token := createTestUser(t, cfg, "user@example.com")
+	video := createTestVideo(t, cfg, user.ID)
+	ctx := context.Background()
+
+	w := httptest.NewRecorder()
+	cfg.handlerUploadVideo(w, newVideoUploadRequest(t, video.ID, token, "video/mp4", testMP4()))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("upload status = %d, want %d: %s", w.Code, http.StatusAccepted, w.Body)
+	}
+	var job database.Job
+	decodeTestResponse(t, w, &job)
+
+	r := httptest.NewRequest(http.MethodDelete, "/api/videos/"+video.ID.String(), nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	r.SetPathValue("videoID", video.ID.String())
+	w = httptest.NewRecorder()
+	cfg.handlerVideoMetaDelete(w, r)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusNoContent, w.Body)
+	}
+
+	jobs, err := db.GetUnfinishedJobs(ctx)
+	if err != nil {
+		t.Fatalf("GetUnfinishedJobs: %v", err)
+	}
+	if len(jobs) != 0 {
+		t.Errorf("%d jobs are still waiting for the deleted video", len(jobs))
+	}
+	if _, err := cfg.videoStorage.Head(ctx, job.SourceKey); err == nil {
+		t.Errorf("staged source %s wasn't deleted", job.SourceKey)
+	}
+	if _, err := db.GetVideo(ctx, video.ID); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("GetVideo = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/media"
+)
+
+// packageHLS segments the renditions and writes a master playlist
+// referencing one media playlist per rendition. Each variant declares its
+// codecs, so players can skip ones they can't decode without fetching
+// them.
+func (cfg *apiConfig) packageHLS(ctx context.Context, renditions []encodedRendition, hasAudio bool, outDir string) error {
+	err := os.MkdirAll(outDir, 0755)
+	if err != nil {
+		return err
+	}
+
+	master := strings.Builder{}
+	master.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n")
+	for _, r := range renditions {
+		err := cfg.mediaProcessor.Run(ctx, media.OpPackage, []string{
+			"-y",
+			"-i", r.Path,
+			"-c", "copy",
+			"-f", "hls",
+			"-hls_time", fmt.Sprint(segmentSeconds),
+			"-hls_playlist_type", "vod",
+			"-hls_segment_filename", filepath.Join(outDir, r.Name+"_%04d.ts"),
+			filepath.Join(outDir, r.Name+".m3u8"),
+		}, nil)
+		if err != nil {
+			return fmt.Errorf("couldn't segment %s rendition: %w", r.Name, err)
+		}
+		fmt.Fprintf(&master, "#EXT-X-STREAM-INF:BANDWIDTH=%d,RESOLUTION=%dx%d,CODECS=\"%s\"\n%s.m3u8\n", r.bandwidth(), r.Width, r.Height, r.codecs(hasAudio), r.Name)
+	}
+
+	return os.WriteFile(filepath.Join(outDir, "master.m3u8"), []byte(master.String()), 0644)
+}
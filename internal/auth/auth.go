@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/alexedwards/argon2id"
@@ -18,6 +19,12 @@ type TokenType string
 
 const (
 	TokenTypeAccess TokenType = "tubely-access"
+	// TokenTypeVideoEvents tokens only grant access to one video's progress
+	// events. They are short-lived since they travel in URLs.
+	TokenTypeVideoEvents TokenType = "tubely-video-events"
+	// TokenTypeVideoPlayback tokens let players fetch one video's
+	// manifests, for as long as the signed URLs in them are valid.
+	TokenTypeVideoPlayback TokenType = "tubely-video-playback"
 )
 
 var ErrNoAuthHeaderIncluded = errors.New("no auth header included in request")
@@ -38,6 +45,23 @@ func CheckPasswordHash(password, hash string) (bool, error) {
 	return match, nil
 }
 
+// dummyPasswordHash is hashed with the same parameters as real passwords,
+// so checking a password against it takes as long.
+var dummyPasswordHash = sync.OnceValues(func() (string, error) {
+	return HashPassword("tubely-dummy-password")
+})
+
+// CheckDummyPasswordHash does the work of CheckPasswordHash for a user
+// that doesn't exist, so how long a login takes doesn't reveal whether an
+// email is registered.
+func CheckDummyPasswordHash(password string) {
+	hash, err := dummyPasswordHash()
+	if err != nil {
+		return
+	}
+	argon2id.ComparePasswordAndHash(password, hash)
+}
+
 func MakeJWT(
 	userID uuid.UUID,
 	tokenSecret string,
@@ -84,6 +108,80 @@ func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
 	return id, nil
 }
 
+func MakeVideoEventsToken(
+	userID uuid.UUID,
+	videoID uuid.UUID,
+	tokenSecret string,
+	expiresIn time.Duration,
+) (string, error) {
+	return makeVideoToken(TokenTypeVideoEvents, userID, videoID, tokenSecret, expiresIn)
+}
+
+// ValidateVideoEventsToken returns the user a video events token was made
+// for, provided it was made for videoID.
+func ValidateVideoEventsToken(tokenString string, videoID uuid.UUID, tokenSecret string) (uuid.UUID, error) {
+	return validateVideoToken(TokenTypeVideoEvents, tokenString, videoID, tokenSecret)
+}
+
+func MakeVideoPlaybackToken(
+	userID uuid.UUID,
+	videoID uuid.UUID,
+	tokenSecret string,
+	expiresIn time.Duration,
+) (string, error) {
+	return makeVideoToken(TokenTypeVideoPlayback, userID, videoID, tokenSecret, expiresIn)
+}
+
+// ValidateVideoPlaybackToken returns the user a video playback token was
+// made for, provided it was made for videoID.
+func ValidateVideoPlaybackToken(tokenString string, videoID uuid.UUID, tokenSecret string) (uuid.UUID, error) {
+	return validateVideoToken(TokenTypeVideoPlayback, tokenString, videoID, tokenSecret)
+}
+
+// makeVideoToken makes a token of the given type that is only valid for
+// one video.
+func makeVideoToken(
+	tokenType TokenType,
+	userID uuid.UUID,
+	videoID uuid.UUID,
+	tokenSecret string,
+	expiresIn time.Duration,
+) (string, error) {
+	signingKey := []byte(tokenSecret)
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Issuer:    string(tokenType),
+		IssuedAt:  jwt.NewNumericDate(time.Now().UTC()),
+		ExpiresAt: jwt.NewNumericDate(time.Now().UTC().Add(expiresIn)),
+		Subject:   userID.String(),
+		Audience:  jwt.ClaimStrings{videoID.String()},
+	})
+	return token.SignedString(signingKey)
+}
+
+func validateVideoToken(tokenType TokenType, tokenString string, videoID uuid.UUID, tokenSecret string) (uuid.UUID, error) {
+	claimsStruct := jwt.RegisteredClaims{}
+	token, err := jwt.ParseWithClaims(
+		tokenString,
+		&claimsStruct,
+		func(token *jwt.Token) (interface{}, error) { return []byte(tokenSecret), nil },
+		jwt.WithIssuer(string(tokenType)),
+		jwt.WithAudience(videoID.String()),
+	)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	userIDString, err := token.Claims.GetSubject()
+	if err != nil {
+		return uuid.Nil, err
+	}
+	id, err := uuid.Parse(userIDString)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("invalid user ID: %w", err)
+	}
+	return id, nil
+}
+
 func GetBearerToken(headers http.Header) (string, error) {
 	authHeader := headers.Get("Authorization")
 	if authHeader == "" {
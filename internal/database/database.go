@@ -1,23 +1,44 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dialect is the flavor of SQL a Client speaks. Queries are written for
+// SQLite, with ? placeholders, and rebound for Postgres.
+type dialect string
 
-	_ "github.com/mattn/go-sqlite3"
+const (
+	dialectSQLite   dialect = "sqlite"
+	dialectPostgres dialect = "postgres"
 )
 
 type Client struct {
-	db *sql.DB
+	db           *sql.DB
+	dialect      dialect
+	queryTimeout time.Duration
 }
 
-func NewClient(pathToDB string) (Client, error) {
-	db, err := sql.Open("sqlite3", pathToDB)
+// NewClient connects to Postgres for postgres:// and postgresql:// DSNs and
+// otherwise treats the DSN as the path to a SQLite database. Queries that
+// take longer than queryTimeout fail with ErrTimeout, 0 means no limit.
+func NewClient(ctx context.Context, dsn string, queryTimeout time.Duration) (Client, error) {
+	driver, source, d := "sqlite3", withForeignKeys(dsn), dialectSQLite
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		driver, source, d = "postgres", dsn, dialectPostgres
+	}
+
+	db, err := sql.Open(driver, source)
 	if err != nil {
 		return Client{}, err
 	}
-	c := Client{db}
-	err = c.autoMigrate()
+	c := Client{db: db, dialect: d, queryTimeout: queryTimeout}
+	err = c.Migrate(ctx)
 	if err != nil {
 		return Client{}, err
 	}
@@ -25,65 +46,105 @@ func NewClient(pathToDB string) (Client, error) {
 
 }
 
-func (c *Client) autoMigrate() error {
-	userTable := `
-	CREATE TABLE IF NOT EXISTS users (
-		id TEXT PRIMARY KEY,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		password TEXT NOT NULL,
-		email TEXT UNIQUE NOT NULL
-	);
-	`
-	_, err := c.db.Exec(userTable)
-	if err != nil {
-		return err
+// withForeignKeys has SQLite enforce foreign keys on every connection it
+// opens, the pragma only applies to the connection it runs on.
+func withForeignKeys(pathToDB string) string {
+	if strings.Contains(pathToDB, "?") {
+		return pathToDB + "&_foreign_keys=on"
 	}
-	refreshTokenTable := `
-	CREATE TABLE IF NOT EXISTS refresh_tokens (
-		token TEXT PRIMARY KEY,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		revoked_at TIMESTAMP,
-		user_id TEXT NOT NULL,
-		expires_at TIMESTAMP NOT NULL,
-		FOREIGN KEY(user_id) REFERENCES users(id)
-	);
-	`
-	_, err = c.db.Exec(refreshTokenTable)
-	if err != nil {
-		return err
+	return pathToDB + "?_foreign_keys=on"
+}
+
+// rebind rewrites ? placeholders into the dialect's own.
+func (d dialect) rebind(query string) string {
+	if d != dialectPostgres || !strings.Contains(query, "?") {
+		return query
 	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r != '?' {
+			b.WriteRune(r)
+			continue
+		}
+		n++
+		b.WriteString("$" + strconv.Itoa(n))
+	}
+	return b.String()
+}
 
-	videoTable := `
-	CREATE TABLE IF NOT EXISTS videos (
-		id TEXT PRIMARY KEY,
-		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		title TEXT NOT NULL,
-		description TEXT,
-		thumbnail_url TEXT,
-		video_url TEXT TEXT,
-		user_id INTEGER,
-		FOREIGN KEY(user_id) REFERENCES users(id)
-	);
-	`
-	_, err = c.db.Exec(videoTable)
-	if err != nil {
-		return err
+// withTimeout bounds a single query by the client's query timeout.
+func (c Client) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.queryTimeout <= 0 {
+		return context.WithCancel(ctx)
 	}
-	return nil
+	return context.WithTimeout(ctx, c.queryTimeout)
 }
 
-func (c Client) Reset() error {
-	if _, err := c.db.Exec("DELETE FROM refresh_tokens"); err != nil {
-		return fmt.Errorf("failed to reset table refresh_tokens: %w", err)
+func (c Client) exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	res, err := c.db.ExecContext(ctx, c.dialect.rebind(query), args...)
+	if isUniqueViolation(err) {
+		return nil, fmt.Errorf("%w: %w", ErrConflict, err)
 	}
-	if _, err := c.db.Exec("DELETE FROM users"); err != nil {
-		return fmt.Errorf("failed to reset table users: %w", err)
+	return res, contextError(ctx, err)
+}
+
+// queryRows keeps the query's context alive until the rows are closed.
+type queryRows struct {
+	*sql.Rows
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func (r *queryRows) Close() error {
+	defer r.cancel()
+	return r.Rows.Close()
+}
+
+func (r *queryRows) Err() error {
+	return contextError(r.ctx, r.Rows.Err())
+}
+
+func (r *queryRows) Scan(dest ...any) error {
+	return contextError(r.ctx, r.Rows.Scan(dest...))
+}
+
+func (c Client) query(ctx context.Context, query string, args ...any) (*queryRows, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	rows, err := c.db.QueryContext(ctx, c.dialect.rebind(query), args...)
+	if err != nil {
+		cancel()
+		return nil, contextError(ctx, err)
 	}
-	if _, err := c.db.Exec("DELETE FROM videos"); err != nil {
-		return fmt.Errorf("failed to reset table videos: %w", err)
+	return &queryRows{Rows: rows, ctx: ctx, cancel: cancel}, nil
+}
+
+// queryRow keeps the query's context alive until the row is scanned.
+type queryRow struct {
+	row    *sql.Row
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func (r queryRow) Scan(dest ...any) error {
+	defer r.cancel()
+	return contextError(r.ctx, r.row.Scan(dest...))
+}
+
+func (c Client) queryRow(ctx context.Context, query string, args ...any) queryRow {
+	ctx, cancel := c.withTimeout(ctx)
+	row := c.db.QueryRowContext(ctx, c.dialect.rebind(query), args...)
+	return queryRow{row: row, ctx: ctx, cancel: cancel}
+}
+
+func (c Client) Reset(ctx context.Context) error {
+	// children first, foreign keys are enforced
+	for _, table := range []string{"jobs", "thumbnail_candidates", "videos", "refresh_tokens", "users", "failed_deletions"} {
+		if _, err := c.exec(ctx, "DELETE FROM "+table); err != nil {
+			return fmt.Errorf("failed to reset table %s: %w", table, err)
+		}
 	}
 	return nil
 }
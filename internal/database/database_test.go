@@ -0,0 +1,105 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// postgresDSNEnv names the Postgres server the tests also run against.
+// Without it only SQLite is tested.
+const postgresDSNEnv = "TEST_POSTGRES_DSN"
+
+// forEachDialect runs test against a freshly migrated SQLite database and,
+// when TEST_POSTGRES_DSN is set, a Postgres schema of its own.
+func forEachDialect(t *testing.T, test func(t *testing.T, c Client)) {
+	t.Run("sqlite", func(t *testing.T) {
+		test(t, newSQLiteTestClient(t))
+	})
+	t.Run("postgres", func(t *testing.T) {
+		test(t, newPostgresTestClient(t))
+	})
+}
+
+func newSQLiteTestClient(t *testing.T) Client {
+	t.Helper()
+	c, err := NewClient(context.Background(), filepath.Join(t.TempDir(), "tubely.db"), 0)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { c.db.Close() })
+	return c
+}
+
+func newPostgresTestClient(t *testing.T) Client {
+	t.Helper()
+	dsn := newPostgresTestSchema(t)
+	c, err := NewClient(context.Background(), dsn, 0)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { c.db.Close() })
+	return c
+}
+
+// newPostgresTestSchema creates an empty schema that is dropped after the
+// test and returns a DSN that uses it. It skips the test without
+// TEST_POSTGRES_DSN.
+func newPostgresTestSchema(t *testing.T) string {
+	t.Helper()
+	dsn := os.Getenv(postgresDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s isn't set", postgresDSNEnv)
+	}
+
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("couldn't connect to Postgres: %v", err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	schema := "tubely_test_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	_, err = admin.Exec("CREATE SCHEMA " + schema)
+	if err != nil {
+		t.Fatalf("couldn't create schema: %v", err)
+	}
+	t.Cleanup(func() {
+		admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+	})
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatalf("invalid %s: %v", postgresDSNEnv, err)
+	}
+	query := u.Query()
+	query.Set("search_path", schema)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// createTestVideo creates a user and a video of theirs.
+func createTestVideo(t *testing.T, s Store) (User, Video) {
+	t.Helper()
+	ctx := context.Background()
+	user, err := s.CreateUser(ctx, CreateUserParams{
+		Email:    uuid.NewString() + "@example.com",
+		Password: "hash",
+	})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	video, err := s.CreateVideo(ctx, CreateVideoParams{
+		Title:  "video",
+		UserID: user.ID,
+	})
+	if err != nil {
+		t.Fatalf("CreateVideo: %v", err)
+	}
+	return *user, video
+}
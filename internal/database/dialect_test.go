@@ -0,0 +1,577 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect dialect
+		query   string
+		want    string
+	}{
+		{"sqlite keeps placeholders", dialectSQLite, "SELECT * FROM users WHERE id = ? AND email = ?", "SELECT * FROM users WHERE id = ? AND email = ?"},
+		{"postgres numbers placeholders", dialectPostgres, "SELECT * FROM users WHERE id = ? AND email = ?", "SELECT * FROM users WHERE id = $1 AND email = $2"},
+		{"postgres without placeholders", dialectPostgres, "DELETE FROM users", "DELETE FROM users"},
+		{"postgres across lines", dialectPostgres, "INSERT INTO t (a, b)\n\tVALUES (?,\n\t?)", "INSERT INTO t (a, b)\n\tVALUES ($1,\n\t$2)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.dialect.rebind(tt.query)
+			if got != tt.want {
+				t.Errorf("rebind(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsUniqueViolation(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"other error", errors.New("boom"), false},
+		{"no rows", sql.ErrNoRows, false},
+		{"sqlite unique", sqlite3.Error{Code: sqlite3.ErrConstraint, ExtendedCode: sqlite3.ErrConstraintUnique}, true},
+		{"sqlite primary key", sqlite3.Error{Code: sqlite3.ErrConstraint, ExtendedCode: sqlite3.ErrConstraintPrimaryKey}, true},
+		{"sqlite foreign key", sqlite3.Error{Code: sqlite3.ErrConstraint, ExtendedCode: sqlite3.ErrConstraintForeignKey}, false},
+		{"sqlite busy", sqlite3.Error{Code: sqlite3.ErrBusy}, false},
+		{"pq unique", &pq.Error{Code: "23505"}, true},
+		{"pq foreign key", &pq.Error{Code: "23503"}, false},
+		{"wrapped pq unique", fmt.Errorf("insert: %w", &pq.Error{Code: "23505"}), true},
+		{"wrapped sqlite unique", fmt.Errorf("insert: %w", sqlite3.Error{Code: sqlite3.ErrConstraint, ExtendedCode: sqlite3.ErrConstraintUnique}), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isUniqueViolation(tt.err); got != tt.want {
+				t.Errorf("isUniqueViolation(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestDriverUniqueViolation checks the drivers really return the errors
+// isUniqueViolation looks for.
+func TestDriverUniqueViolation(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, c Client) {
+		id := uuid.New()
+		query := c.dialect.rebind("INSERT INTO users (id, created_at, updated_at, email, password) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?)")
+		_, err := c.db.Exec(query, id, "a@example.com", "hash")
+		if err != nil {
+			t.Fatalf("first insert: %v", err)
+		}
+		_, err = c.db.Exec(query, uuid.New(), "a@example.com", "hash")
+		if !isUniqueViolation(err) {
+			t.Errorf("duplicate email: isUniqueViolation(%v) = false", err)
+		}
+		_, err = c.db.Exec(query, id, "b@example.com", "hash")
+		if !isUniqueViolation(err) {
+			t.Errorf("duplicate id: isUniqueViolation(%v) = false", err)
+		}
+	})
+}
+
+// TestClaimNextJobConcurrently claims from several connections at once.
+// On Postgres that relies on UPDATE ... RETURNING skipping the rows
+// another claim has locked.
+func TestClaimNextJobConcurrently(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, c Client) {
+		ctx := context.Background()
+		user, video := createTestVideo(t, c)
+
+		const jobs, workers = 20, 5
+		for i := range jobs {
+			_, err := c.CreateJob(ctx, CreateJobParams{VideoID: video.ID, UserID: user.ID, SourceKey: fmt.Sprint(i), MediaType: "video/mp4"})
+			if err != nil {
+				t.Fatalf("CreateJob: %v", err)
+			}
+		}
+
+		var mu sync.Mutex
+		claimed := map[uuid.UUID]string{}
+		var wg sync.WaitGroup
+		errs := make(chan error, workers)
+		for w := range workers {
+			owner := fmt.Sprintf("worker-%d", w)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					job, err := c.ClaimNextJob(ctx, owner, time.Minute)
+					if err != nil {
+						errs <- err
+						return
+					}
+					if job == nil {
+						return
+					}
+					mu.Lock()
+					if other, ok := claimed[job.ID]; ok {
+						errs <- fmt.Errorf("job %s claimed by %s and %s", job.ID, other, owner)
+					}
+					claimed[job.ID] = owner
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			t.Error(err)
+		}
+		if len(claimed) != jobs {
+			t.Errorf("claimed %d jobs, want %d", len(claimed), jobs)
+		}
+	})
+}
+
+func TestJobLeases(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, c Client) {
+		ctx := context.Background()
+		user, video := createTestVideo(t, c)
+		for i := range 2 {
+			_, err := c.CreateJob(ctx, CreateJobParams{VideoID: video.ID, UserID: user.ID, SourceKey: fmt.Sprint(i), MediaType: "video/mp4"})
+			if err != nil {
+				t.Fatalf("CreateJob: %v", err)
+			}
+		}
+
+		live, err := c.ClaimNextJob(ctx, "live", time.Minute)
+		if err != nil || live == nil {
+			t.Fatalf("ClaimNextJob = %v, %v", live, err)
+		}
+		// a lease that has already run out, like a server that died
+		dead, err := c.ClaimNextJob(ctx, "dead", -time.Minute)
+		if err != nil || dead == nil {
+			t.Fatalf("ClaimNextJob = %v, %v", dead, err)
+		}
+
+		if err := c.RenewJobLease(ctx, live.ID, "live", time.Minute); err != nil {
+			t.Errorf("RenewJobLease by the owner: %v", err)
+		}
+		if err := c.RenewJobLease(ctx, live.ID, "dead", time.Minute); !errors.Is(err, ErrLeaseLost) {
+			t.Errorf("RenewJobLease by another worker = %v, want ErrLeaseLost", err)
+		}
+
+		requeued, err := c.RequeueExpiredJobs(ctx, 3)
+		if err != nil {
+			t.Fatalf("RequeueExpiredJobs: %v", err)
+		}
+		if requeued != 1 {
+			t.Errorf("RequeueExpiredJobs requeued %d jobs, want 1", requeued)
+		}
+		job, err := c.GetJob(ctx, dead.ID)
+		if err != nil {
+			t.Fatalf("GetJob: %v", err)
+		}
+		if job.Status != StatusQueued || job.LeaseOwner != "" || job.LeaseExpiresAt != nil {
+			t.Errorf("expired job = %+v, want it queued without a lease", job)
+		}
+		if err := c.RenewJobLease(ctx, dead.ID, "dead", time.Minute); !errors.Is(err, ErrLeaseLost) {
+			t.Errorf("RenewJobLease after requeue = %v, want ErrLeaseLost", err)
+		}
+		if err := c.FinishJob(ctx, dead.ID, "dead", StatusReady, nil); !errors.Is(err, ErrLeaseLost) {
+			t.Errorf("FinishJob after requeue = %v, want ErrLeaseLost", err)
+		}
+
+		if err := c.FinishJob(ctx, live.ID, "live", StatusReady, nil); err != nil {
+			t.Errorf("FinishJob by the owner: %v", err)
+		}
+		job, err = c.GetJob(ctx, live.ID)
+		if err != nil {
+			t.Fatalf("GetJob: %v", err)
+		}
+		if job.Status != StatusReady || job.FinishedAt == nil {
+			t.Errorf("finished job = %+v, want it ready", job)
+		}
+	})
+}
+
+func TestFailExhaustedJobs(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, c Client) {
+		ctx := context.Background()
+		const maxAttempts = 3
+		user, video := createTestVideo(t, c)
+		created, err := c.CreateJob(ctx, CreateJobParams{VideoID: video.ID, UserID: user.ID, SourceKey: "source", MediaType: "video/mp4"})
+		if err != nil {
+			t.Fatalf("CreateJob: %v", err)
+		}
+
+		// every server that claims the job dies before finishing it
+		for attempt := 1; attempt <= maxAttempts; attempt++ {
+			job, err := c.ClaimNextJob(ctx, fmt.Sprintf("dead-%d", attempt), -time.Minute)
+			if err != nil || job == nil || job.ID != created.ID || job.Attempts != attempt {
+				t.Fatalf("claim %d: ClaimNextJob = %+v, %v", attempt, job, err)
+			}
+
+			failed, err := c.FailExhaustedJobs(ctx, maxAttempts, "gave up")
+			if err != nil {
+				t.Fatalf("FailExhaustedJobs: %v", err)
+			}
+			requeued, err := c.RequeueExpiredJobs(ctx, maxAttempts)
+			if err != nil {
+				t.Fatalf("RequeueExpiredJobs: %v", err)
+			}
+			if attempt < maxAttempts {
+				if len(failed) != 0 || requeued != 1 {
+					t.Fatalf("after %d attempts: failed %d and requeued %d jobs, want the job requeued", attempt, len(failed), requeued)
+				}
+				continue
+			}
+			if len(failed) != 1 || failed[0].ID != created.ID || requeued != 0 {
+				t.Fatalf("after %d attempts: failed %+v and requeued %d jobs, want the job failed", attempt, failed, requeued)
+			}
+		}
+
+		job, err := c.GetJob(ctx, created.ID)
+		if err != nil {
+			t.Fatalf("GetJob: %v", err)
+		}
+		if job.Status != StatusFailed || job.Error == nil || *job.Error != "gave up" || job.FinishedAt == nil || job.LeaseExpiresAt != nil {
+			t.Errorf("exhausted job = %+v, want it failed", job)
+		}
+		if next, err := c.ClaimNextJob(ctx, "live", time.Minute); err != nil || next != nil {
+			t.Errorf("ClaimNextJob = %+v, %v, want nothing left to claim", next, err)
+		}
+	})
+}
+
+func TestCancelVideoJobs(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, c Client) {
+		ctx := context.Background()
+		user, video := createTestVideo(t, c)
+		_, other := createTestVideo(t, c)
+		for _, params := range []CreateJobParams{
+			{VideoID: video.ID, UserID: user.ID, SourceKey: "processing", MediaType: "video/mp4"},
+			{VideoID: video.ID, UserID: user.ID, SourceKey: "queued", MediaType: "video/mp4"},
+			{VideoID: other.ID, UserID: other.UserID, SourceKey: "other", MediaType: "video/mp4"},
+		} {
+			if _, err := c.CreateJob(ctx, params); err != nil {
+				t.Fatalf("CreateJob: %v", err)
+			}
+		}
+		processing, err := c.ClaimNextJob(ctx, "worker", time.Minute)
+		if err != nil || processing == nil || processing.SourceKey != "processing" {
+			t.Fatalf("ClaimNextJob = %+v, %v", processing, err)
+		}
+
+		canceled, err := c.CancelVideoJobs(ctx, video.ID, "video was deleted")
+		if err != nil {
+			t.Fatalf("CancelVideoJobs: %v", err)
+		}
+		if len(canceled) != 2 {
+			t.Fatalf("canceled %d jobs, want 2", len(canceled))
+		}
+		for _, job := range canceled {
+			if job.VideoID != video.ID || job.Status != StatusFailed || job.Error == nil || job.FinishedAt == nil {
+				t.Errorf("canceled job = %+v, want it failed", job)
+			}
+		}
+		if err := c.RenewJobLease(ctx, processing.ID, "worker", time.Minute); !errors.Is(err, ErrLeaseLost) {
+			t.Errorf("RenewJobLease = %v, want ErrLeaseLost", err)
+		}
+		if next, err := c.ClaimNextJob(ctx, "worker", time.Minute); err != nil || next == nil || next.VideoID != other.ID {
+			t.Errorf("ClaimNextJob = %+v, %v, want the other video's job", next, err)
+		}
+	})
+}
+
+func TestMigrateDownAndUp(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, c Client) {
+		ctx := context.Background()
+		latest, err := c.LatestSchemaVersion()
+		if err != nil {
+			t.Fatalf("LatestSchemaVersion: %v", err)
+		}
+		createTestVideo(t, c)
+
+		err = c.MigrateTo(ctx, 0)
+		if err != nil {
+			t.Fatalf("MigrateTo(0): %v", err)
+		}
+		if version, err := c.SchemaVersion(ctx); err != nil || version != 0 {
+			t.Errorf("SchemaVersion after rolling back = %d, %v, want 0", version, err)
+		}
+
+		err = c.Migrate(ctx)
+		if err != nil {
+			t.Fatalf("Migrate: %v", err)
+		}
+		if version, err := c.SchemaVersion(ctx); err != nil || version != latest {
+			t.Errorf("SchemaVersion after migrating = %d, %v, want %d", version, err, latest)
+		}
+		createTestVideo(t, c)
+	})
+}
+
+// TestMigratePostgresConcurrently starts several servers' migrations on
+// an empty schema at once. The advisory lock has to make all but one of
+// them find the schema already migrated.
+func TestMigratePostgresConcurrently(t *testing.T) {
+	dsn := newPostgresTestSchema(t)
+
+	const servers = 4
+	clients := make([]*Client, servers)
+	for i := range clients {
+		db, err := sql.Open("postgres", dsn)
+		if err != nil {
+			t.Fatalf("sql.Open: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		clients[i] = &Client{db: db, dialect: dialectPostgres}
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, servers)
+	for _, c := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- c.Migrate(context.Background())
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Migrate: %v", err)
+		}
+	}
+
+	var applied int
+	err := clients[0].db.QueryRow("SELECT COUNT(*) FROM schema_migrations").Scan(&applied)
+	if err != nil {
+		t.Fatalf("counting migrations: %v", err)
+	}
+	latest, err := clients[0].LatestSchemaVersion()
+	if err != nil {
+		t.Fatalf("LatestSchemaVersion: %v", err)
+	}
+	if applied != latest {
+		t.Errorf("%d migrations recorded, want each of the %d once", applied, latest)
+	}
+}
+
+// TestMigrateLeasesProcessingJobs checks jobs a server from before leases
+// is still processing get a lease when the schema is upgraded under it,
+// rather than being queued again straight away.
+func TestMigrateLeasesProcessingJobs(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, c Client) {
+		ctx := context.Background()
+		user, video := createTestVideo(t, c)
+		job, err := c.CreateJob(ctx, CreateJobParams{VideoID: video.ID, UserID: user.ID, SourceKey: "source", MediaType: "video/mp4"})
+		if err != nil {
+			t.Fatalf("CreateJob: %v", err)
+		}
+
+		err = c.MigrateTo(ctx, 13)
+		if err != nil {
+			t.Fatalf("MigrateTo(13): %v", err)
+		}
+		_, err = c.exec(ctx, "UPDATE jobs SET status = ? WHERE id = ?", StatusProcessing, job.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = c.Migrate(ctx)
+		if err != nil {
+			t.Fatalf("Migrate: %v", err)
+		}
+
+		requeued, err := c.RequeueExpiredJobs(ctx, 3)
+		if err != nil {
+			t.Fatalf("RequeueExpiredJobs: %v", err)
+		}
+		if requeued != 0 {
+			t.Errorf("RequeueExpiredJobs requeued %d jobs, want 0", requeued)
+		}
+		leased, err := c.GetJob(ctx, job.ID)
+		if err != nil {
+			t.Fatalf("GetJob: %v", err)
+		}
+		if leased.Status != StatusProcessing || leased.LeaseExpiresAt == nil || !leased.LeaseExpiresAt.After(time.Now().Add(time.Hour)) {
+			t.Errorf("job = %s leased until %v, want it still processing with a long lease", leased.Status, leased.LeaseExpiresAt)
+		}
+	})
+}
+
+// TestMigrateFailsDuplicateJobSources checks uploads that were queued
+// twice before sources had to be unique keep only their oldest job.
+func TestMigrateFailsDuplicateJobSources(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, c Client) {
+		ctx := context.Background()
+		user, video := createTestVideo(t, c)
+		err := c.MigrateTo(ctx, 14)
+		if err != nil {
+			t.Fatalf("MigrateTo(14): %v", err)
+		}
+
+		ids := make([]uuid.UUID, 3)
+		for i := range ids {
+			job, err := c.CreateJob(ctx, CreateJobParams{VideoID: video.ID, UserID: user.ID, SourceKey: "source", MediaType: "video/mp4"})
+			if err != nil {
+				t.Fatalf("CreateJob: %v", err)
+			}
+			_, err = c.exec(ctx, "UPDATE jobs SET created_at = ? WHERE id = ?", time.Now().UTC().Add(time.Duration(i-3)*time.Minute), job.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids[i] = job.ID
+		}
+		err = c.Migrate(ctx)
+		if err != nil {
+			t.Fatalf("Migrate: %v", err)
+		}
+
+		for i, id := range ids {
+			job, err := c.GetJob(ctx, id)
+			if err != nil {
+				t.Fatalf("GetJob: %v", err)
+			}
+			want := StatusFailed
+			if i == 0 {
+				want = StatusQueued
+			}
+			if job.Status != want {
+				t.Errorf("job %d is %s, want %s", i, job.Status, want)
+			}
+		}
+	})
+}
+
+// upstreamSchema is what autoMigrate created before any of the later
+// columns and tables were added.
+const upstreamSchema = `
+CREATE TABLE users (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	password TEXT NOT NULL,
+	email TEXT UNIQUE NOT NULL
+);
+CREATE TABLE refresh_tokens (
+	token TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	revoked_at TIMESTAMP,
+	user_id TEXT NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+CREATE TABLE videos (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	title TEXT NOT NULL,
+	description TEXT,
+	thumbnail_url TEXT,
+	video_url TEXT TEXT,
+	user_id INTEGER,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+`
+
+// TestMigrateQuarantinesOrphans upgrades a database from before migrations
+// whose videos and refresh tokens include some of users that were deleted
+// without them.
+func TestMigrateQuarantinesOrphans(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "tubely.db")
+	legacy, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID, keptID, orphanID := uuid.NewString(), uuid.NewString(), uuid.NewString()
+	statements := []string{
+		upstreamSchema,
+		fmt.Sprintf("INSERT INTO users (id, password, email) VALUES ('%s', 'hash', 'user@example.com')", userID),
+		fmt.Sprintf("INSERT INTO videos (id, title, description, user_id, video_url) VALUES ('%s', 'kept', '', '%s', 'https://cdn.example.com/landscape/kept.mp4')", keptID, userID),
+		fmt.Sprintf("INSERT INTO videos (id, title, description, user_id) VALUES ('%s', 'orphan', '', '%s')", orphanID, uuid.NewString()),
+		fmt.Sprintf("INSERT INTO refresh_tokens (token, user_id, expires_at) VALUES ('kept', '%s', CURRENT_TIMESTAMP)", userID),
+		fmt.Sprintf("INSERT INTO refresh_tokens (token, user_id, expires_at) VALUES ('orphan', '%s', CURRENT_TIMESTAMP)", uuid.NewString()),
+	}
+	for _, statement := range statements {
+		if _, err := legacy.Exec(statement); err != nil {
+			t.Fatalf("setting up legacy database: %v", err)
+		}
+	}
+	legacy.Close()
+
+	c, err := NewClient(ctx, path, 0)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { c.db.Close() })
+
+	videos, err := c.GetAllVideos(ctx)
+	if err != nil {
+		t.Fatalf("GetAllVideos: %v", err)
+	}
+	if len(videos) != 1 || videos[0].ID.String() != keptID {
+		t.Fatalf("videos = %+v, want only the one whose user exists", videos)
+	}
+	if videos[0].VideoKey == nil || *videos[0].VideoKey != "landscape/kept.mp4" {
+		t.Errorf("video key = %v, want it taken from the URL", videos[0].VideoKey)
+	}
+
+	tests := []struct {
+		table string
+		id    string
+	}{
+		{"orphaned_videos", "id = '" + orphanID + "'"},
+		{"orphaned_refresh_tokens", "token = 'orphan'"},
+	}
+	for _, tt := range tests {
+		var count int
+		err := c.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+tt.table+" WHERE "+tt.id).Scan(&count)
+		if err != nil || count != 1 {
+			t.Errorf("%s has %d rows where %s, %v, want 1", tt.table, count, tt.id, err)
+		}
+	}
+	if _, err := c.GetRefreshToken(ctx, "orphan"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetRefreshToken for the orphan = %v, want ErrNotFound", err)
+	}
+}
+
+func TestRestoreConn(t *testing.T) {
+	c := newSQLiteTestClient(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	conn, err := c.db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+		t.Fatal(err)
+	}
+
+	// a canceled migration still has to put the connection back in order
+	cancel()
+	if err := restoreConn(ctx, conn, "PRAGMA foreign_keys = ON"); err != nil {
+		t.Fatalf("restoreConn with a canceled context: %v", err)
+	}
+	var foreignKeys bool
+	if err := conn.QueryRowContext(context.Background(), "PRAGMA foreign_keys").Scan(&foreignKeys); err != nil || !foreignKeys {
+		t.Errorf("foreign keys = %t, %v, want them back on", foreignKeys, err)
+	}
+
+	if err := restoreConn(ctx, conn, "NOT SQL"); err == nil {
+		t.Error("restoreConn with a failing query succeeded")
+	}
+	if _, err := conn.ExecContext(context.Background(), "SELECT 1"); !errors.Is(err, sql.ErrConnDone) {
+		t.Errorf("connection after a failed restore = %v, want it closed", err)
+	}
+}
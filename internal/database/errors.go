@@ -0,0 +1,56 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+var (
+	// ErrCanceled means the query was abandoned because its context was
+	// canceled, usually because the client went away.
+	ErrCanceled = errors.New("database query canceled")
+	// ErrTimeout means the query didn't finish before its deadline.
+	ErrTimeout = errors.New("database query timed out")
+	// ErrNotFound means no row matched.
+	ErrNotFound = errors.New("not found")
+	// ErrConflict means a write would have broken a unique constraint, like
+	// a second user with the same email.
+	ErrConflict = errors.New("already exists")
+	// ErrLeaseLost means a job's lease ran out and the job may have been
+	// claimed by another worker since.
+	ErrLeaseLost = errors.New("job lease lost")
+)
+
+// contextError replaces err with ErrCanceled or ErrTimeout when it was
+// caused by ctx ending. Both still match the context's own error.
+func contextError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return fmt.Errorf("%w: %w", ErrTimeout, ctx.Err())
+	case errors.Is(ctx.Err(), context.Canceled):
+		return fmt.Errorf("%w: %w", ErrCanceled, ctx.Err())
+	}
+	return err
+}
+
+// isUniqueViolation reports whether err is either driver refusing a
+// duplicate key.
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique ||
+			sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "23505"
+	}
+	return false
+}
@@ -0,0 +1,146 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type FailedDeletion struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	CreateFailedDeletionParams
+}
+
+type CreateFailedDeletionParams struct {
+	Storage  string `json:"storage"`
+	Key      string `json:"key"`
+	IsPrefix bool   `json:"is_prefix"`
+	Error    string `json:"error"`
+	Attempts int    `json:"attempts"`
+}
+
+func (c Client) CreateFailedDeletion(ctx context.Context, params CreateFailedDeletionParams) (FailedDeletion, error) {
+	id := uuid.New()
+	query := `
+	INSERT INTO failed_deletions (
+		id,
+		created_at,
+		updated_at,
+		storage,
+		object_key,
+		is_prefix,
+		error,
+		attempts
+	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, ?, ?)
+	`
+	_, err := c.exec(ctx, query, id, params.Storage, params.Key, params.IsPrefix, params.Error, params.Attempts)
+	if err != nil {
+		return FailedDeletion{}, err
+	}
+
+	return c.GetFailedDeletion(ctx, id)
+}
+
+func (c Client) GetFailedDeletion(ctx context.Context, id uuid.UUID) (FailedDeletion, error) {
+	query := `
+	SELECT
+		id,
+		created_at,
+		updated_at,
+		storage,
+		object_key,
+		is_prefix,
+		error,
+		attempts
+	FROM failed_deletions
+	WHERE id = ?
+	`
+
+	var fd FailedDeletion
+	err := c.queryRow(ctx, query, id).Scan(
+		&fd.ID,
+		&fd.CreatedAt,
+		&fd.UpdatedAt,
+		&fd.Storage,
+		&fd.Key,
+		&fd.IsPrefix,
+		&fd.Error,
+		&fd.Attempts,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return FailedDeletion{}, ErrNotFound
+		}
+		return FailedDeletion{}, err
+	}
+	return fd, nil
+}
+
+func (c Client) GetFailedDeletions(ctx context.Context) ([]FailedDeletion, error) {
+	query := `
+	SELECT
+		id,
+		created_at,
+		updated_at,
+		storage,
+		object_key,
+		is_prefix,
+		error,
+		attempts
+	FROM failed_deletions
+	ORDER BY created_at ASC
+	`
+
+	rows, err := c.query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deletions := []FailedDeletion{}
+	for rows.Next() {
+		var fd FailedDeletion
+		if err := rows.Scan(
+			&fd.ID,
+			&fd.CreatedAt,
+			&fd.UpdatedAt,
+			&fd.Storage,
+			&fd.Key,
+			&fd.IsPrefix,
+			&fd.Error,
+			&fd.Attempts,
+		); err != nil {
+			return nil, err
+		}
+		deletions = append(deletions, fd)
+	}
+
+	return deletions, rows.Err()
+}
+
+func (c Client) UpdateFailedDeletion(ctx context.Context, fd FailedDeletion) error {
+	query := `
+	UPDATE failed_deletions
+	SET
+		updated_at = CURRENT_TIMESTAMP,
+		error = ?,
+		attempts = ?
+	WHERE id = ?
+	`
+	_, err := c.exec(ctx, query, fd.Error, fd.Attempts, fd.ID)
+	return err
+}
+
+func (c Client) DeleteFailedDeletion(ctx context.Context, id uuid.UUID) error {
+	query := `
+	DELETE FROM failed_deletions
+	WHERE id = ?
+	`
+	_, err := c.exec(ctx, query, id)
+	return err
+}
@@ -0,0 +1,353 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	StatusQueued     = "queued"
+	StatusProcessing = "processing"
+	StatusReady      = "ready"
+	StatusFailed     = "failed"
+)
+
+type Job struct {
+	ID         uuid.UUID  `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	Status     string     `json:"status"`
+	Error      *string    `json:"error"`
+	Attempts   int        `json:"attempts"`
+	StartedAt  *time.Time `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+	// LeaseOwner is the worker processing the job, until LeaseExpiresAt
+	// unless it renews the lease.
+	LeaseOwner     string     `json:"-"`
+	LeaseExpiresAt *time.Time `json:"-"`
+	CreateJobParams
+}
+
+type CreateJobParams struct {
+	VideoID uuid.UUID `json:"video_id"`
+	UserID  uuid.UUID `json:"user_id"`
+	// SourceKey is the object in video storage to process. SourcePath, a
+	// local file, is only set on jobs queued by older versions, which only
+	// the server that queued them can process.
+	SourcePath string `json:"-"`
+	SourceKey  string `json:"-"`
+	MediaType  string `json:"media_type"`
+	// Size is the upload's size in bytes, reserved against the user's
+	// quota until the job finishes.
+	Size int64 `json:"size"`
+}
+
+const jobColumns = `
+		id,
+		created_at,
+		updated_at,
+		status,
+		error,
+		attempts,
+		started_at,
+		finished_at,
+		lease_owner,
+		lease_expires_at,
+		video_id,
+		user_id,
+		source_path,
+		source_key,
+		media_type,
+		size
+`
+
+func scanJob(row rowScanner) (Job, error) {
+	var job Job
+	err := row.Scan(
+		&job.ID,
+		&job.CreatedAt,
+		&job.UpdatedAt,
+		&job.Status,
+		&job.Error,
+		&job.Attempts,
+		&job.StartedAt,
+		&job.FinishedAt,
+		&job.LeaseOwner,
+		&job.LeaseExpiresAt,
+		&job.VideoID,
+		&job.UserID,
+		&job.SourcePath,
+		&job.SourceKey,
+		&job.MediaType,
+		&job.Size,
+	)
+	return job, err
+}
+
+func (c Client) CreateJob(ctx context.Context, params CreateJobParams) (Job, error) {
+	id := uuid.New()
+	query := `
+	INSERT INTO jobs (
+		id,
+		created_at,
+		updated_at,
+		status,
+		video_id,
+		user_id,
+		source_path,
+		source_key,
+		media_type,
+		size
+	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err := c.exec(ctx, query, id, StatusQueued, params.VideoID, params.UserID, params.SourcePath, params.SourceKey, params.MediaType, params.Size)
+	if err != nil {
+		return Job{}, err
+	}
+
+	return c.GetJob(ctx, id)
+}
+
+func (c Client) GetJob(ctx context.Context, id uuid.UUID) (Job, error) {
+	query := `
+	SELECT` + jobColumns + `
+	FROM jobs
+	WHERE id = ?
+	`
+
+	job, err := scanJob(c.queryRow(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Job{}, ErrNotFound
+		}
+		return Job{}, err
+	}
+	return job, nil
+}
+
+// GetUnfinishedJobs returns the jobs that are queued or processing.
+func (c Client) GetUnfinishedJobs(ctx context.Context) ([]Job, error) {
+	query := `
+	SELECT` + jobColumns + `
+	FROM jobs
+	WHERE status IN (?, ?)
+	ORDER BY created_at ASC
+	`
+	rows, err := c.query(ctx, query, StatusQueued, StatusProcessing)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []Job{}
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// GetUnfinishedJobBySourceKey returns the queued or processing job for an
+// uploaded object. There is at most one.
+func (c Client) GetUnfinishedJobBySourceKey(ctx context.Context, sourceKey string) (Job, error) {
+	query := `
+	SELECT` + jobColumns + `
+	FROM jobs
+	WHERE source_key = ? AND status IN (?, ?)
+	`
+
+	job, err := scanJob(c.queryRow(ctx, query, sourceKey, StatusQueued, StatusProcessing))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Job{}, ErrNotFound
+		}
+		return Job{}, err
+	}
+	return job, nil
+}
+
+// ClaimNextJob marks the oldest queued job as processing, leases it to
+// owner for leaseDuration and returns it. It returns nil if no job is
+// queued. Servers sharing a Postgres database skip jobs another server is
+// claiming at the same moment.
+func (c Client) ClaimNextJob(ctx context.Context, owner string, leaseDuration time.Duration) (*Job, error) {
+	query := `
+	UPDATE jobs
+	SET
+		status = ?,
+		attempts = attempts + 1,
+		lease_owner = ?,
+		lease_expires_at = ?,
+		started_at = CURRENT_TIMESTAMP,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = (
+		SELECT id FROM jobs
+		WHERE status = ?
+		ORDER BY created_at ASC
+		LIMIT 1` + c.skipLocked() + `
+	)
+	RETURNING` + jobColumns
+
+	job, err := scanJob(c.queryRow(ctx, query, StatusProcessing, owner, leaseExpiry(leaseDuration), StatusQueued))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &job, nil
+}
+
+// RenewJobLease extends owner's lease on a processing job. It returns
+// ErrLeaseLost if owner no longer holds it.
+func (c Client) RenewJobLease(ctx context.Context, id uuid.UUID, owner string, leaseDuration time.Duration) error {
+	query := `
+	UPDATE jobs
+	SET
+		lease_expires_at = ?,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = ? AND status = ? AND lease_owner = ?
+	`
+	res, err := c.exec(ctx, query, leaseExpiry(leaseDuration), id, StatusProcessing, owner)
+	if err != nil {
+		return err
+	}
+	return leaseResult(res)
+}
+
+// FinishJob records the outcome of a job owner is processing. It returns
+// ErrLeaseLost, and changes nothing, if owner no longer holds the job.
+func (c Client) FinishJob(ctx context.Context, id uuid.UUID, owner string, status string, jobErr *string) error {
+	query := `
+	UPDATE jobs
+	SET
+		status = ?,
+		error = ?,
+		lease_expires_at = NULL,
+		finished_at = CURRENT_TIMESTAMP,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = ? AND status = ? AND lease_owner = ?
+	`
+	res, err := c.exec(ctx, query, status, jobErr, id, StatusProcessing, owner)
+	if err != nil {
+		return err
+	}
+	return leaseResult(res)
+}
+
+// RequeueExpiredJobs puts processing jobs whose lease ran out, because
+// the server processing them stopped, back in the queue. Every processing
+// job has a lease, so one without is left alone. Jobs that have already
+// been claimed maxAttempts times are left for FailExhaustedJobs.
+func (c Client) RequeueExpiredJobs(ctx context.Context, maxAttempts int) (int64, error) {
+	query := `
+	UPDATE jobs
+	SET
+		status = ?,
+		lease_owner = '',
+		lease_expires_at = NULL,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE status = ? AND lease_expires_at < ? AND attempts < ?
+	`
+	res, err := c.exec(ctx, query, StatusQueued, StatusProcessing, time.Now().UTC(), maxAttempts)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// FailExhaustedJobs fails processing jobs whose lease ran out after they
+// had been claimed maxAttempts times, and returns them. A job that keeps
+// stopping the server processing it, such as an input that crashes or
+// hangs ffmpeg, would otherwise be retried forever.
+func (c Client) FailExhaustedJobs(ctx context.Context, maxAttempts int, jobErr string) ([]Job, error) {
+	query := `
+	UPDATE jobs
+	SET
+		status = ?,
+		error = ?,
+		lease_expires_at = NULL,
+		finished_at = CURRENT_TIMESTAMP,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE status = ? AND lease_expires_at < ? AND attempts >= ?
+	RETURNING` + jobColumns
+
+	rows, err := c.query(ctx, query, StatusFailed, jobErr, StatusProcessing, time.Now().UTC(), maxAttempts)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []Job{}
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// CancelVideoJobs fails the video's queued and processing jobs and
+// returns them. A server processing one of them loses its lease, and stops
+// the next time it tries to renew it.
+func (c Client) CancelVideoJobs(ctx context.Context, videoID uuid.UUID, jobErr string) ([]Job, error) {
+	query := `
+	UPDATE jobs
+	SET
+		status = ?,
+		error = ?,
+		lease_expires_at = NULL,
+		finished_at = CURRENT_TIMESTAMP,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE video_id = ? AND status IN (?, ?)
+	RETURNING` + jobColumns
+
+	rows, err := c.query(ctx, query, StatusFailed, jobErr, videoID, StatusQueued, StatusProcessing)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []Job{}
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// leaseExpiry is computed here rather than in SQL since SQLite and
+// Postgres don't share a way to add an interval to the current time.
+func leaseExpiry(leaseDuration time.Duration) time.Time {
+	return time.Now().UTC().Add(leaseDuration)
+}
+
+func leaseResult(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+func (c Client) skipLocked() string {
+	if c.dialect == dialectPostgres {
+		return "\n\t\tFOR UPDATE SKIP LOCKED"
+	}
+	return ""
+}
@@ -0,0 +1,164 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// legacySchemaVersion is the migration that brings the schema to where
+// autoMigrate left it before migrations were versioned.
+const legacySchemaVersion = 11
+
+// legacyTables were created by autoMigrate after the initial tables.
+// Databases from then may lack any of them, depending on their age.
+var legacyTables = []string{
+	`CREATE TABLE IF NOT EXISTS failed_deletions (
+		id TEXT PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		storage TEXT NOT NULL,
+		object_key TEXT NOT NULL,
+		is_prefix BOOLEAN NOT NULL DEFAULT FALSE,
+		error TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0
+	)`,
+	`CREATE TABLE IF NOT EXISTS jobs (
+		id TEXT PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		status TEXT NOT NULL,
+		error TEXT,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		started_at TIMESTAMP,
+		finished_at TIMESTAMP,
+		video_id TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		source_path TEXT NOT NULL DEFAULT '',
+		source_key TEXT NOT NULL DEFAULT '',
+		media_type TEXT NOT NULL,
+		FOREIGN KEY(video_id) REFERENCES videos(id),
+		FOREIGN KEY(user_id) REFERENCES users(id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS thumbnail_candidates (
+		id TEXT PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		video_id TEXT NOT NULL,
+		thumbnail_key TEXT NOT NULL,
+		position REAL NOT NULL,
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	)`,
+}
+
+// legacyVideoColumns were added to the videos table one by one before
+// migrations were versioned. Databases from then may lack any of them.
+var legacyVideoColumns = []struct{ name, definition string }{
+	{"video_key", "TEXT"},
+	{"thumbnail_key", "TEXT"},
+	{"hls_key", "TEXT"},
+	{"dash_key", "TEXT"},
+	{"preview_vtt_key", "TEXT"},
+	{"original_key", "TEXT"},
+	{"streaming_formats", "TEXT"},
+	{"processing_status", "TEXT"},
+	{"processing_error", "TEXT"},
+	{"video_bytes", "INTEGER NOT NULL DEFAULT 0"},
+	{"thumbnail_bytes", "INTEGER NOT NULL DEFAULT 0"},
+	{"duration", "REAL"},
+	{"width", "INTEGER"},
+	{"height", "INTEGER"},
+	{"video_codec", "TEXT"},
+	{"audio_codec", "TEXT"},
+	{"bitrate", "INTEGER"},
+	{"frame_rate", "REAL"},
+	{"audio_channels", "INTEGER"},
+	{"rotation", "INTEGER"},
+	{"file_size", "INTEGER"},
+}
+
+// adoptLegacySchema brings a database created before schema_migrations
+// existed up to legacySchemaVersion and records the migrations up to it
+// as applied. It returns the version adopted, or 0 for databases that
+// have no tables yet.
+func adoptLegacySchema(ctx context.Context, conn *sql.Conn, migrations []migration) (int, error) {
+	var tables int
+	err := conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'videos'").Scan(&tables)
+	if err != nil {
+		return 0, err
+	}
+	if tables == 0 {
+		return 0, nil
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// the initial migration only creates tables that are missing
+	_, err = tx.ExecContext(ctx, migrations[0].up)
+	if err != nil {
+		return 0, err
+	}
+	for _, table := range legacyTables {
+		_, err = tx.ExecContext(ctx, table)
+		if err != nil {
+			return 0, err
+		}
+	}
+	for _, column := range legacyVideoColumns {
+		err = addColumnIfMissing(ctx, tx, "videos", column.name, column.definition)
+		if err != nil {
+			return 0, err
+		}
+	}
+	// later migrations drop the URL columns this reads
+	err = backfillVideoKeys(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, m := range migrations {
+		if m.version > legacySchemaVersion {
+			break
+		}
+		_, err = tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, name) VALUES (?, ?)", m.version, m.name)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return legacySchemaVersion, tx.Commit()
+}
+
+func addColumnIfMissing(ctx context.Context, tx *sql.Tx, table, column, definition string) error {
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			columnType string
+			notNull    bool
+			dfltValue  sql.NullString
+			pk         int
+		)
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &dfltValue, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
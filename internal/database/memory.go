@@ -0,0 +1,768 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var errMemoryForeignKey = errors.New("FOREIGN KEY constraint failed")
+
+// MemoryStore is a Store that keeps everything in memory so handlers can
+// be tested without a database file. It behaves like Client, down to
+// enforcing foreign keys and deleting a video's jobs and candidates along
+// with it.
+type MemoryStore struct {
+	mu              sync.Mutex
+	users           map[uuid.UUID]User
+	refreshTokens   map[string]RefreshToken
+	videos          map[uuid.UUID]Video
+	jobs            map[uuid.UUID]Job
+	failedDeletions map[uuid.UUID]FailedDeletion
+	candidates      map[uuid.UUID]ThumbnailCandidate
+}
+
+func NewMemoryStore() *MemoryStore {
+	s := &MemoryStore{}
+	s.reset()
+	return s
+}
+
+func (s *MemoryStore) reset() {
+	s.users = map[uuid.UUID]User{}
+	s.refreshTokens = map[string]RefreshToken{}
+	s.videos = map[uuid.UUID]Video{}
+	s.jobs = map[uuid.UUID]Job{}
+	s.failedDeletions = map[uuid.UUID]FailedDeletion{}
+	s.candidates = map[uuid.UUID]ThumbnailCandidate{}
+}
+
+func (s *MemoryStore) Reset(ctx context.Context) error {
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+	s.reset()
+	return nil
+}
+
+// lock fails the way a query would if ctx has already ended.
+func (s *MemoryStore) lock(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return contextError(ctx, err)
+	}
+	s.mu.Lock()
+	return nil
+}
+
+func now() time.Time {
+	return time.Now().UTC()
+}
+
+// sortedValues returns the map's values ordered by less.
+func sortedValues[K comparable, V any](m map[K]V, less func(a, b V) bool) []V {
+	values := make([]V, 0, len(m))
+	for _, v := range m {
+		values = append(values, v)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		return less(values[i], values[j])
+	})
+	return values
+}
+
+func (s *MemoryStore) GetUsers(ctx context.Context) ([]User, error) {
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+	return sortedValues(s.users, func(a, b User) bool {
+		return a.CreatedAt.Before(b.CreatedAt)
+	}), nil
+}
+
+func (s *MemoryStore) GetUser(ctx context.Context, id uuid.UUID) (*User, error) {
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+	user, ok := s.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &user, nil
+}
+
+func (s *MemoryStore) GetUserByEmail(ctx context.Context, email string) (User, error) {
+	if err := s.lock(ctx); err != nil {
+		return User{}, err
+	}
+	defer s.mu.Unlock()
+	for _, user := range s.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return User{}, ErrNotFound
+}
+
+func (s *MemoryStore) GetUserByRefreshToken(ctx context.Context, token string) (*User, error) {
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+	rt, ok := s.refreshTokens[token]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	user, ok := s.users[rt.UserID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &user, nil
+}
+
+func (s *MemoryStore) CreateUser(ctx context.Context, params CreateUserParams) (*User, error) {
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+	for _, user := range s.users {
+		if user.Email == params.Email {
+			return nil, ErrConflict
+		}
+	}
+	user := User{
+		ID:               uuid.New(),
+		CreatedAt:        now(),
+		UpdatedAt:        now(),
+		CreateUserParams: params,
+	}
+	s.users[user.ID] = user
+	return &user, nil
+}
+
+func (s *MemoryStore) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+	for _, video := range s.videos {
+		if video.UserID == id {
+			return errMemoryForeignKey
+		}
+	}
+	for _, rt := range s.refreshTokens {
+		if rt.UserID == id {
+			return errMemoryForeignKey
+		}
+	}
+	for _, job := range s.jobs {
+		if job.UserID == id {
+			return errMemoryForeignKey
+		}
+	}
+	delete(s.users, id)
+	return nil
+}
+
+// copyVideo keeps callers from sharing the stored video's slice.
+func copyVideo(video Video) Video {
+	video.StreamingFormats = slices.Clone(video.StreamingFormats)
+	return video
+}
+
+func (s *MemoryStore) getVideos(match func(Video) bool) []Video {
+	videos := []Video{}
+	for _, video := range s.videos {
+		if match(video) {
+			videos = append(videos, copyVideo(video))
+		}
+	}
+	return videos
+}
+
+func (s *MemoryStore) GetVideos(ctx context.Context, userID uuid.UUID) ([]Video, error) {
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+	videos := s.getVideos(func(v Video) bool { return v.UserID == userID })
+	sort.Slice(videos, func(i, j int) bool {
+		return videos[i].CreatedAt.After(videos[j].CreatedAt)
+	})
+	return videos, nil
+}
+
+func (s *MemoryStore) GetAllVideos(ctx context.Context) ([]Video, error) {
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+	return s.getVideos(func(Video) bool { return true }), nil
+}
+
+func (s *MemoryStore) GetVideo(ctx context.Context, id uuid.UUID) (Video, error) {
+	if err := s.lock(ctx); err != nil {
+		return Video{}, err
+	}
+	defer s.mu.Unlock()
+	video, ok := s.videos[id]
+	if !ok {
+		return Video{}, ErrNotFound
+	}
+	return copyVideo(video), nil
+}
+
+func (s *MemoryStore) CreateVideo(ctx context.Context, params CreateVideoParams) (Video, error) {
+	if err := s.lock(ctx); err != nil {
+		return Video{}, err
+	}
+	defer s.mu.Unlock()
+	if _, ok := s.users[params.UserID]; !ok {
+		return Video{}, errMemoryForeignKey
+	}
+	video := Video{
+		ID:                uuid.New(),
+		CreatedAt:         now(),
+		UpdatedAt:         now(),
+		StreamingFormats:  []string{},
+		CreateVideoParams: params,
+	}
+	s.videos[video.ID] = video
+	return copyVideo(video), nil
+}
+
+func (s *MemoryStore) UpdateVideo(ctx context.Context, video Video) error {
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+	stored, ok := s.videos[video.ID]
+	if !ok {
+		return nil
+	}
+	if _, ok := s.users[video.UserID]; !ok {
+		return errMemoryForeignKey
+	}
+	video.CreatedAt = stored.CreatedAt
+	video.UpdatedAt = stored.UpdatedAt
+	// URLs are derived from keys, they aren't stored
+	video.ThumbnailURL = nil
+	video.VideoURL = nil
+	video.HLSURL = nil
+	video.DASHURL = nil
+	video.PreviewVTTURL = nil
+	if video.StreamingFormats == nil {
+		video.StreamingFormats = []string{}
+	}
+	s.videos[video.ID] = copyVideo(video)
+	return nil
+}
+
+// updateVideo applies update to the stored video, if it exists.
+func (s *MemoryStore) updateVideo(ctx context.Context, id uuid.UUID, update func(*Video)) error {
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+	video, ok := s.videos[id]
+	if !ok {
+		return nil
+	}
+	update(&video)
+	video.UpdatedAt = now()
+	s.videos[id] = copyVideo(video)
+	return nil
+}
+
+func (s *MemoryStore) SetVideoProcessed(ctx context.Context, id uuid.UUID, processed ProcessedVideo) error {
+	return s.updateVideo(ctx, id, func(video *Video) {
+		video.VideoKey = processed.VideoKey
+		video.OriginalKey = processed.OriginalKey
+		video.HLSKey = processed.HLSKey
+		video.DASHKey = processed.DASHKey
+		video.PreviewVTTKey = processed.PreviewVTTKey
+		video.StreamingFormats = slices.Clone(processed.StreamingFormats)
+		if video.StreamingFormats == nil {
+			video.StreamingFormats = []string{}
+		}
+		video.Metadata = processed.Metadata
+	})
+}
+
+func (s *MemoryStore) SetVideoProcessingStatus(ctx context.Context, id uuid.UUID, status string, processingErr *string) error {
+	return s.updateVideo(ctx, id, func(video *Video) {
+		video.ProcessingStatus = &status
+		video.ProcessingError = processingErr
+	})
+}
+
+func (s *MemoryStore) SetVideoThumbnail(ctx context.Context, id uuid.UUID, key string) error {
+	return s.updateVideo(ctx, id, func(video *Video) {
+		video.ThumbnailKey = &key
+	})
+}
+
+func (s *MemoryStore) SetDefaultVideoThumbnail(ctx context.Context, id uuid.UUID, key, replaceablePrefix string) error {
+	return s.updateVideo(ctx, id, func(video *Video) {
+		if video.ThumbnailKey == nil || strings.HasPrefix(*video.ThumbnailKey, replaceablePrefix) {
+			video.ThumbnailKey = &key
+		}
+	})
+}
+
+func (s *MemoryStore) DeleteVideo(ctx context.Context, id uuid.UUID) error {
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+	delete(s.videos, id)
+	for jobID, job := range s.jobs {
+		if job.VideoID == id {
+			delete(s.jobs, jobID)
+		}
+	}
+	for candidateID, candidate := range s.candidates {
+		if candidate.VideoID == id {
+			delete(s.candidates, candidateID)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) GetUsage(ctx context.Context, userID uuid.UUID) (Usage, error) {
+	if err := s.lock(ctx); err != nil {
+		return Usage{}, err
+	}
+	defer s.mu.Unlock()
+	usage := Usage{}
+	for _, video := range s.videos {
+		if video.UserID != userID {
+			continue
+		}
+		usage.Videos++
+		usage.VideoBytes += video.VideoBytes
+		usage.ThumbnailBytes += video.ThumbnailBytes
+	}
+	for _, job := range s.jobs {
+		if job.UserID == userID && (job.Status == StatusQueued || job.Status == StatusProcessing) {
+			usage.ReservedBytes += job.Size
+		}
+	}
+	return usage, nil
+}
+
+func (s *MemoryStore) SetVideoUsage(ctx context.Context, id uuid.UUID, videoBytes, thumbnailBytes int64) error {
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+	video, ok := s.videos[id]
+	if !ok {
+		return nil
+	}
+	video.VideoBytes = videoBytes
+	video.ThumbnailBytes = thumbnailBytes
+	s.videos[id] = video
+	return nil
+}
+
+func (s *MemoryStore) GetRefreshToken(ctx context.Context, token string) (RefreshToken, error) {
+	if err := s.lock(ctx); err != nil {
+		return RefreshToken{}, err
+	}
+	defer s.mu.Unlock()
+	rt, ok := s.refreshTokens[token]
+	if !ok {
+		return RefreshToken{}, ErrNotFound
+	}
+	return rt, nil
+}
+
+func (s *MemoryStore) CreateRefreshToken(ctx context.Context, params CreateRefreshTokenParams) (RefreshToken, error) {
+	if err := s.lock(ctx); err != nil {
+		return RefreshToken{}, err
+	}
+	defer s.mu.Unlock()
+	if _, ok := s.users[params.UserID]; !ok {
+		return RefreshToken{}, errMemoryForeignKey
+	}
+	if _, ok := s.refreshTokens[params.Token]; ok {
+		return RefreshToken{}, ErrConflict
+	}
+	rt := RefreshToken{
+		CreateRefreshTokenParams: params,
+		CreatedAt:                now(),
+		UpdatedAt:                now(),
+	}
+	s.refreshTokens[rt.Token] = rt
+	return rt, nil
+}
+
+func (s *MemoryStore) RevokeRefreshToken(ctx context.Context, token string) error {
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+	rt, ok := s.refreshTokens[token]
+	if !ok {
+		return nil
+	}
+	revokedAt := now()
+	rt.RevokedAt = &revokedAt
+	s.refreshTokens[token] = rt
+	return nil
+}
+
+func (s *MemoryStore) DeleteRefreshToken(ctx context.Context, token string) error {
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+	delete(s.refreshTokens, token)
+	return nil
+}
+
+func (s *MemoryStore) GetJob(ctx context.Context, id uuid.UUID) (Job, error) {
+	if err := s.lock(ctx); err != nil {
+		return Job{}, err
+	}
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	return job, nil
+}
+
+func (s *MemoryStore) CreateJob(ctx context.Context, params CreateJobParams) (Job, error) {
+	if err := s.lock(ctx); err != nil {
+		return Job{}, err
+	}
+	defer s.mu.Unlock()
+	if _, ok := s.videos[params.VideoID]; !ok {
+		return Job{}, errMemoryForeignKey
+	}
+	if _, ok := s.users[params.UserID]; !ok {
+		return Job{}, errMemoryForeignKey
+	}
+	if params.SourceKey != "" {
+		if _, ok := s.unfinishedJobBySourceKey(params.SourceKey); ok {
+			return Job{}, ErrConflict
+		}
+	}
+	job := Job{
+		ID:              uuid.New(),
+		CreatedAt:       now(),
+		UpdatedAt:       now(),
+		Status:          StatusQueued,
+		CreateJobParams: params,
+	}
+	s.jobs[job.ID] = job
+	return job, nil
+}
+
+func (s *MemoryStore) GetUnfinishedJobBySourceKey(ctx context.Context, sourceKey string) (Job, error) {
+	if err := s.lock(ctx); err != nil {
+		return Job{}, err
+	}
+	defer s.mu.Unlock()
+	job, ok := s.unfinishedJobBySourceKey(sourceKey)
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	return job, nil
+}
+
+func (s *MemoryStore) unfinishedJobBySourceKey(sourceKey string) (Job, bool) {
+	for _, job := range s.jobs {
+		if job.SourceKey == sourceKey && (job.Status == StatusQueued || job.Status == StatusProcessing) {
+			return job, true
+		}
+	}
+	return Job{}, false
+}
+
+func (s *MemoryStore) GetUnfinishedJobs(ctx context.Context) ([]Job, error) {
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+	jobs := []Job{}
+	for _, job := range sortedValues(s.jobs, func(a, b Job) bool {
+		return a.CreatedAt.Before(b.CreatedAt)
+	}) {
+		if job.Status == StatusQueued || job.Status == StatusProcessing {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs, nil
+}
+
+func (s *MemoryStore) ClaimNextJob(ctx context.Context, owner string, leaseDuration time.Duration) (*Job, error) {
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+	jobs := sortedValues(s.jobs, func(a, b Job) bool {
+		return a.CreatedAt.Before(b.CreatedAt)
+	})
+	for _, job := range jobs {
+		if job.Status != StatusQueued {
+			continue
+		}
+		startedAt := now()
+		expiresAt := leaseExpiry(leaseDuration)
+		job.Status = StatusProcessing
+		job.Attempts++
+		job.LeaseOwner = owner
+		job.LeaseExpiresAt = &expiresAt
+		job.StartedAt = &startedAt
+		job.UpdatedAt = startedAt
+		s.jobs[job.ID] = job
+		return &job, nil
+	}
+	return nil, nil
+}
+
+func (s *MemoryStore) RenewJobLease(ctx context.Context, id uuid.UUID, owner string, leaseDuration time.Duration) error {
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok || job.Status != StatusProcessing || job.LeaseOwner != owner {
+		return ErrLeaseLost
+	}
+	expiresAt := leaseExpiry(leaseDuration)
+	job.LeaseExpiresAt = &expiresAt
+	job.UpdatedAt = now()
+	s.jobs[id] = job
+	return nil
+}
+
+func (s *MemoryStore) FinishJob(ctx context.Context, id uuid.UUID, owner string, status string, jobErr *string) error {
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok || job.Status != StatusProcessing || job.LeaseOwner != owner {
+		return ErrLeaseLost
+	}
+	finishedAt := now()
+	job.Status = status
+	job.Error = jobErr
+	job.LeaseExpiresAt = nil
+	job.FinishedAt = &finishedAt
+	job.UpdatedAt = finishedAt
+	s.jobs[id] = job
+	return nil
+}
+
+// leaseExpired reports whether a processing job's lease ran out.
+func leaseExpired(job Job) bool {
+	return job.Status == StatusProcessing && job.LeaseExpiresAt != nil && job.LeaseExpiresAt.Before(time.Now())
+}
+
+func (s *MemoryStore) RequeueExpiredJobs(ctx context.Context, maxAttempts int) (int64, error) {
+	if err := s.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer s.mu.Unlock()
+	var requeued int64
+	for id, job := range s.jobs {
+		if !leaseExpired(job) || job.Attempts >= maxAttempts {
+			continue
+		}
+		job.Status = StatusQueued
+		job.LeaseOwner = ""
+		job.LeaseExpiresAt = nil
+		job.UpdatedAt = now()
+		s.jobs[id] = job
+		requeued++
+	}
+	return requeued, nil
+}
+
+func (s *MemoryStore) FailExhaustedJobs(ctx context.Context, maxAttempts int, jobErr string) ([]Job, error) {
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+	failed := []Job{}
+	for id, job := range s.jobs {
+		if !leaseExpired(job) || job.Attempts < maxAttempts {
+			continue
+		}
+		finishedAt := now()
+		job.Status = StatusFailed
+		job.Error = &jobErr
+		job.LeaseExpiresAt = nil
+		job.FinishedAt = &finishedAt
+		job.UpdatedAt = finishedAt
+		s.jobs[id] = job
+		failed = append(failed, job)
+	}
+	return failed, nil
+}
+
+func (s *MemoryStore) CancelVideoJobs(ctx context.Context, videoID uuid.UUID, jobErr string) ([]Job, error) {
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+	canceled := []Job{}
+	for id, job := range s.jobs {
+		if job.VideoID != videoID || (job.Status != StatusQueued && job.Status != StatusProcessing) {
+			continue
+		}
+		finishedAt := now()
+		job.Status = StatusFailed
+		job.Error = &jobErr
+		job.LeaseExpiresAt = nil
+		job.FinishedAt = &finishedAt
+		job.UpdatedAt = finishedAt
+		s.jobs[id] = job
+		canceled = append(canceled, job)
+	}
+	return canceled, nil
+}
+
+func (s *MemoryStore) GetFailedDeletion(ctx context.Context, id uuid.UUID) (FailedDeletion, error) {
+	if err := s.lock(ctx); err != nil {
+		return FailedDeletion{}, err
+	}
+	defer s.mu.Unlock()
+	fd, ok := s.failedDeletions[id]
+	if !ok {
+		return FailedDeletion{}, ErrNotFound
+	}
+	return fd, nil
+}
+
+func (s *MemoryStore) GetFailedDeletions(ctx context.Context) ([]FailedDeletion, error) {
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+	return sortedValues(s.failedDeletions, func(a, b FailedDeletion) bool {
+		return a.CreatedAt.Before(b.CreatedAt)
+	}), nil
+}
+
+func (s *MemoryStore) CreateFailedDeletion(ctx context.Context, params CreateFailedDeletionParams) (FailedDeletion, error) {
+	if err := s.lock(ctx); err != nil {
+		return FailedDeletion{}, err
+	}
+	defer s.mu.Unlock()
+	fd := FailedDeletion{
+		ID:                         uuid.New(),
+		CreatedAt:                  now(),
+		UpdatedAt:                  now(),
+		CreateFailedDeletionParams: params,
+	}
+	s.failedDeletions[fd.ID] = fd
+	return fd, nil
+}
+
+func (s *MemoryStore) UpdateFailedDeletion(ctx context.Context, fd FailedDeletion) error {
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+	stored, ok := s.failedDeletions[fd.ID]
+	if !ok {
+		return nil
+	}
+	stored.Error = fd.Error
+	stored.Attempts = fd.Attempts
+	stored.UpdatedAt = now()
+	s.failedDeletions[fd.ID] = stored
+	return nil
+}
+
+func (s *MemoryStore) DeleteFailedDeletion(ctx context.Context, id uuid.UUID) error {
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+	delete(s.failedDeletions, id)
+	return nil
+}
+
+func (s *MemoryStore) GetThumbnailCandidate(ctx context.Context, id uuid.UUID) (ThumbnailCandidate, error) {
+	if err := s.lock(ctx); err != nil {
+		return ThumbnailCandidate{}, err
+	}
+	defer s.mu.Unlock()
+	candidate, ok := s.candidates[id]
+	if !ok {
+		return ThumbnailCandidate{}, ErrNotFound
+	}
+	return candidate, nil
+}
+
+func (s *MemoryStore) GetThumbnailCandidates(ctx context.Context, videoID uuid.UUID) ([]ThumbnailCandidate, error) {
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+	candidates := []ThumbnailCandidate{}
+	for _, candidate := range s.candidates {
+		if candidate.VideoID == videoID {
+			candidates = append(candidates, candidate)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Position < candidates[j].Position
+	})
+	return candidates, nil
+}
+
+func (s *MemoryStore) GetAllThumbnailCandidates(ctx context.Context) ([]ThumbnailCandidate, error) {
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+	return sortedValues(s.candidates, func(a, b ThumbnailCandidate) bool {
+		return a.CreatedAt.Before(b.CreatedAt)
+	}), nil
+}
+
+func (s *MemoryStore) CreateThumbnailCandidate(ctx context.Context, params CreateThumbnailCandidateParams) (ThumbnailCandidate, error) {
+	if err := s.lock(ctx); err != nil {
+		return ThumbnailCandidate{}, err
+	}
+	defer s.mu.Unlock()
+	if _, ok := s.videos[params.VideoID]; !ok {
+		return ThumbnailCandidate{}, errMemoryForeignKey
+	}
+	candidate := ThumbnailCandidate{
+		ID:                             uuid.New(),
+		CreatedAt:                      now(),
+		CreateThumbnailCandidateParams: params,
+	}
+	s.candidates[candidate.ID] = candidate
+	return candidate, nil
+}
+
+func (s *MemoryStore) DeleteThumbnailCandidates(ctx context.Context, videoID uuid.UUID) error {
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+	for id, candidate := range s.candidates {
+		if candidate.VideoID == videoID {
+			delete(s.candidates, id)
+		}
+	}
+	return nil
+}
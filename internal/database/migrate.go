@@ -0,0 +1,262 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed migrations/*/*.sql
+var migrationFiles embed.FS
+
+// migrationLockID is the Postgres advisory lock that keeps servers
+// starting at the same time from migrating concurrently.
+const migrationLockID = 7_261_005
+
+// migration is a pair of scripts in migrations/<dialect>/, named
+// <version>_<name>.up.sql and <version>_<name>.down.sql. Both dialects
+// use the same version numbers for the same change.
+type migration struct {
+	version int
+	name    string
+	up      string
+	down    string
+}
+
+func loadMigrations(d dialect) ([]migration, error) {
+	dir := path.Join("migrations", string(d))
+	names, err := fs.Glob(migrationFiles, path.Join(dir, "*.up.sql"))
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := []migration{}
+	for _, name := range names {
+		base := strings.TrimSuffix(path.Base(name), ".up.sql")
+		versionStr, label, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(versionStr)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration name %q", name)
+		}
+		up, err := migrationFiles.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		down, err := migrationFiles.ReadFile(path.Join(dir, base+".down.sql"))
+		if err != nil {
+			return nil, fmt.Errorf("migration %d has no down script: %w", version, err)
+		}
+		migrations = append(migrations, migration{
+			version: version,
+			name:    label,
+			up:      string(up),
+			down:    string(down),
+		})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].version == migrations[i-1].version {
+			return nil, fmt.Errorf("duplicate migration version %d", migrations[i].version)
+		}
+	}
+	return migrations, nil
+}
+
+// LatestSchemaVersion is the version of the newest migration.
+func (c *Client) LatestSchemaVersion() (int, error) {
+	migrations, err := loadMigrations(c.dialect)
+	if err != nil {
+		return 0, err
+	}
+	if len(migrations) == 0 {
+		return 0, nil
+	}
+	return migrations[len(migrations)-1].version, nil
+}
+
+// Migrate applies every migration that hasn't been applied yet.
+func (c *Client) Migrate(ctx context.Context) error {
+	latest, err := c.LatestSchemaVersion()
+	if err != nil {
+		return err
+	}
+	return c.MigrateTo(ctx, latest)
+}
+
+// MigrateTo applies or rolls back migrations until the schema is at the
+// given version. Each migration runs in its own transaction together with
+// its schema_migrations row.
+func (c *Client) MigrateTo(ctx context.Context, target int) (err error) {
+	migrations, err := loadMigrations(c.dialect)
+	if err != nil {
+		return err
+	}
+
+	conn, err := c.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	switch c.dialect {
+	case dialectSQLite:
+		// tables are rebuilt to change them, which foreign keys would get in
+		// the way of. They can't be switched off inside a transaction, so
+		// they're off for the whole run and checked before each commit.
+		_, err = conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF")
+		if err != nil {
+			return err
+		}
+		defer func() {
+			err = errors.Join(err, restoreConn(ctx, conn, "PRAGMA foreign_keys = ON"))
+		}()
+	case dialectPostgres:
+		_, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockID)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			err = errors.Join(err, restoreConn(ctx, conn, "SELECT pg_advisory_unlock($1)", migrationLockID))
+		}()
+	}
+
+	_, err = conn.ExecContext(ctx, `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)
+	`)
+	if err != nil {
+		return err
+	}
+
+	current, err := schemaVersion(ctx, conn)
+	if err != nil {
+		return err
+	}
+	if current == 0 && len(migrations) > 0 && c.dialect == dialectSQLite {
+		current, err = adoptLegacySchema(ctx, conn, migrations)
+		if err != nil {
+			return fmt.Errorf("couldn't adopt existing schema: %w", err)
+		}
+	}
+
+	if target >= current {
+		for _, m := range migrations {
+			if m.version <= current || m.version > target {
+				continue
+			}
+			err = c.applyMigration(ctx, conn, m, true)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if m.version > current || m.version <= target {
+			continue
+		}
+		err = c.applyMigration(ctx, conn, m, false)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreConn undoes what a migration run changed about its connection
+// before it goes back to the pool, even if ctx was canceled. If that
+// fails the connection is closed instead, so no query gets a connection
+// without foreign keys, or one still holding the migration lock.
+func restoreConn(ctx context.Context, conn *sql.Conn, query string, args ...any) error {
+	_, err := conn.ExecContext(context.WithoutCancel(ctx), query, args...)
+	if err != nil {
+		conn.Raw(func(any) error { return driver.ErrBadConn })
+		return fmt.Errorf("couldn't restore migration connection: %w", err)
+	}
+	return nil
+}
+
+// SchemaVersion is the version of the newest applied migration.
+func (c *Client) SchemaVersion(ctx context.Context) (int, error) {
+	conn, err := c.db.Conn(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	return schemaVersion(ctx, conn)
+}
+
+func schemaVersion(ctx context.Context, conn *sql.Conn) (int, error) {
+	var version int
+	err := conn.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+	return version, err
+}
+
+func (c *Client) applyMigration(ctx context.Context, conn *sql.Conn, m migration, up bool) error {
+	direction, script := "up", m.up
+	if !up {
+		direction, script = "down", m.down
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, script)
+	if err != nil {
+		return fmt.Errorf("migration %d_%s %s failed: %w", m.version, m.name, direction, err)
+	}
+	if c.dialect == dialectSQLite {
+		err = checkForeignKeys(ctx, tx)
+		if err != nil {
+			return fmt.Errorf("migration %d_%s %s failed: %w", m.version, m.name, direction, err)
+		}
+	}
+
+	if up {
+		_, err = tx.ExecContext(ctx, c.dialect.rebind("INSERT INTO schema_migrations (version, name) VALUES (?, ?)"), m.version, m.name)
+	} else {
+		_, err = tx.ExecContext(ctx, c.dialect.rebind("DELETE FROM schema_migrations WHERE version = ?"), m.version)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func checkForeignKeys(ctx context.Context, tx *sql.Tx) error {
+	rows, err := tx.QueryContext(ctx, "PRAGMA foreign_key_check")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		var table, parent string
+		var rowID sql.NullInt64
+		var fkID int
+		if err := rows.Scan(&table, &rowID, &parent, &fkID); err != nil {
+			return err
+		}
+		return fmt.Errorf("row %d of %s references a missing %s", rowID.Int64, table, parent)
+	}
+	return rows.Err()
+}
@@ -0,0 +1,2 @@
+ALTER TABLE videos DROP COLUMN thumbnail_key;
+ALTER TABLE videos DROP COLUMN video_key;
@@ -0,0 +1,4 @@
+-- Videos and thumbnails are referred to by object key rather than URL, so
+-- the URL can be built, or signed, when it's served.
+ALTER TABLE videos ADD COLUMN video_key TEXT;
+ALTER TABLE videos ADD COLUMN thumbnail_key TEXT;
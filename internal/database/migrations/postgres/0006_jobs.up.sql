@@ -0,0 +1,20 @@
+-- Uploads are processed in the background by jobs, and videos keep the
+-- status of their latest one.
+ALTER TABLE videos ADD COLUMN processing_status TEXT;
+ALTER TABLE videos ADD COLUMN processing_error TEXT;
+
+CREATE TABLE jobs (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	status TEXT NOT NULL,
+	error TEXT,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	started_at TIMESTAMPTZ,
+	finished_at TIMESTAMPTZ,
+	video_id TEXT NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
+	user_id TEXT NOT NULL REFERENCES users(id),
+	source_path TEXT NOT NULL DEFAULT '',
+	source_key TEXT NOT NULL DEFAULT '',
+	media_type TEXT NOT NULL
+);
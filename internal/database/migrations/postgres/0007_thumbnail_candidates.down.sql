@@ -0,0 +1 @@
+DROP TABLE thumbnail_candidates;
@@ -0,0 +1,8 @@
+-- Frames taken from a video that its owner can pick a thumbnail from.
+CREATE TABLE thumbnail_candidates (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	video_id TEXT NOT NULL REFERENCES videos(id) ON DELETE CASCADE,
+	thumbnail_key TEXT NOT NULL,
+	position DOUBLE PRECISION NOT NULL
+);
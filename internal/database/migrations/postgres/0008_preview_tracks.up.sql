@@ -0,0 +1,2 @@
+-- The WebVTT track of seek-bar preview sprites.
+ALTER TABLE videos ADD COLUMN preview_vtt_key TEXT;
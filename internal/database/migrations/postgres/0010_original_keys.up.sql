@@ -0,0 +1,3 @@
+-- Uploads in other containers are transcoded to MP4. With KEEP_ORIGINALS
+-- the upload itself is kept as well.
+ALTER TABLE videos ADD COLUMN original_key TEXT;
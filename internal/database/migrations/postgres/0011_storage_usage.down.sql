@@ -0,0 +1,2 @@
+ALTER TABLE videos DROP COLUMN thumbnail_bytes;
+ALTER TABLE videos DROP COLUMN video_bytes;
@@ -0,0 +1,6 @@
+DROP INDEX thumbnail_candidates_video_id_idx;
+DROP INDEX jobs_video_id_idx;
+DROP INDEX videos_user_id_idx;
+
+ALTER TABLE videos ADD COLUMN thumbnail_url TEXT;
+ALTER TABLE videos ADD COLUMN video_url TEXT;
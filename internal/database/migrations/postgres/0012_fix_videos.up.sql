@@ -0,0 +1,9 @@
+-- The column types and foreign keys SQLite's 0012 fixes were right from
+-- the start here. The URL columns, replaced by object keys, are dropped
+-- and the indexes added.
+ALTER TABLE videos DROP COLUMN thumbnail_url;
+ALTER TABLE videos DROP COLUMN video_url;
+
+CREATE INDEX videos_user_id_idx ON videos(user_id);
+CREATE INDEX jobs_video_id_idx ON jobs(video_id);
+CREATE INDEX thumbnail_candidates_video_id_idx ON thumbnail_candidates(video_id);
@@ -0,0 +1,4 @@
+-- A job's size is what its upload declared. Until the job finishes it
+-- counts against the user's quota, so concurrent uploads can't each
+-- squeeze under it.
+ALTER TABLE jobs ADD COLUMN size BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+ALTER TABLE jobs DROP COLUMN lease_expires_at;
+ALTER TABLE jobs DROP COLUMN lease_owner;
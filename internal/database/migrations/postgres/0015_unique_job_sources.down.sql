@@ -0,0 +1 @@
+DROP INDEX jobs_unfinished_source_key_idx;
@@ -0,0 +1,19 @@
+-- An upload can only be waiting for or in processing once, so completing
+-- a direct upload twice doesn't queue it twice. Duplicates that were
+-- queued before this are failed, keeping the job that's further along.
+UPDATE jobs
+SET status = 'failed', error = 'the upload was already queued by another job', finished_at = CURRENT_TIMESTAMP
+WHERE status = 'queued' AND source_key <> ''
+	AND EXISTS (
+		SELECT 1 FROM jobs AS other
+		WHERE other.source_key = jobs.source_key
+			AND other.id <> jobs.id
+			AND (
+				other.status = 'processing'
+				OR (other.status = 'queued' AND (other.created_at < jobs.created_at
+					OR (other.created_at = jobs.created_at AND other.id < jobs.id)))
+			)
+	);
+
+CREATE UNIQUE INDEX jobs_unfinished_source_key_idx ON jobs(source_key)
+WHERE source_key <> '' AND status IN ('queued', 'processing');
@@ -0,0 +1 @@
+DROP TABLE failed_deletions;
@@ -0,0 +1,12 @@
+-- Objects that still couldn't be deleted after retrying, so garbage
+-- collection can try again later.
+CREATE TABLE failed_deletions (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	storage TEXT NOT NULL,
+	object_key TEXT NOT NULL,
+	is_prefix BOOLEAN NOT NULL DEFAULT FALSE,
+	error TEXT NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0
+);
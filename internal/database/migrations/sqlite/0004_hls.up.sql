@@ -0,0 +1,2 @@
+-- The HLS master playlist of a video's renditions.
+ALTER TABLE videos ADD COLUMN hls_key TEXT;
@@ -0,0 +1,2 @@
+ALTER TABLE videos DROP COLUMN streaming_formats;
+ALTER TABLE videos DROP COLUMN dash_key;
@@ -0,0 +1,4 @@
+-- The DASH manifest of a video's renditions, and which streaming formats
+-- it was packaged in.
+ALTER TABLE videos ADD COLUMN dash_key TEXT;
+ALTER TABLE videos ADD COLUMN streaming_formats TEXT;
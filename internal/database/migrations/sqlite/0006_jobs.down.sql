@@ -0,0 +1,3 @@
+DROP TABLE jobs;
+ALTER TABLE videos DROP COLUMN processing_error;
+ALTER TABLE videos DROP COLUMN processing_status;
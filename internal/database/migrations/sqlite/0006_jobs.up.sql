@@ -0,0 +1,22 @@
+-- Uploads are processed in the background by jobs, and videos keep the
+-- status of their latest one.
+ALTER TABLE videos ADD COLUMN processing_status TEXT;
+ALTER TABLE videos ADD COLUMN processing_error TEXT;
+
+CREATE TABLE jobs (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	status TEXT NOT NULL,
+	error TEXT,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	started_at TIMESTAMP,
+	finished_at TIMESTAMP,
+	video_id TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	source_path TEXT NOT NULL DEFAULT '',
+	source_key TEXT NOT NULL DEFAULT '',
+	media_type TEXT NOT NULL,
+	FOREIGN KEY(video_id) REFERENCES videos(id),
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
@@ -0,0 +1,9 @@
+-- Frames taken from a video that its owner can pick a thumbnail from.
+CREATE TABLE thumbnail_candidates (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	video_id TEXT NOT NULL,
+	thumbnail_key TEXT NOT NULL,
+	position REAL NOT NULL,
+	FOREIGN KEY(video_id) REFERENCES videos(id)
+);
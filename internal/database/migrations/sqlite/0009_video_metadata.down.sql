@@ -0,0 +1,10 @@
+ALTER TABLE videos DROP COLUMN file_size;
+ALTER TABLE videos DROP COLUMN rotation;
+ALTER TABLE videos DROP COLUMN audio_channels;
+ALTER TABLE videos DROP COLUMN frame_rate;
+ALTER TABLE videos DROP COLUMN bitrate;
+ALTER TABLE videos DROP COLUMN audio_codec;
+ALTER TABLE videos DROP COLUMN video_codec;
+ALTER TABLE videos DROP COLUMN height;
+ALTER TABLE videos DROP COLUMN width;
+ALTER TABLE videos DROP COLUMN duration;
@@ -0,0 +1,11 @@
+-- What ffprobe reported about a video's upload.
+ALTER TABLE videos ADD COLUMN duration REAL;
+ALTER TABLE videos ADD COLUMN width INTEGER;
+ALTER TABLE videos ADD COLUMN height INTEGER;
+ALTER TABLE videos ADD COLUMN video_codec TEXT;
+ALTER TABLE videos ADD COLUMN audio_codec TEXT;
+ALTER TABLE videos ADD COLUMN bitrate INTEGER;
+ALTER TABLE videos ADD COLUMN frame_rate REAL;
+ALTER TABLE videos ADD COLUMN audio_channels INTEGER;
+ALTER TABLE videos ADD COLUMN rotation INTEGER;
+ALTER TABLE videos ADD COLUMN file_size INTEGER;
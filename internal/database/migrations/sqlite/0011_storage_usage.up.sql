@@ -0,0 +1,4 @@
+-- How much storage each video takes up, which counts against its owner's
+-- quota.
+ALTER TABLE videos ADD COLUMN video_bytes INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE videos ADD COLUMN thumbnail_bytes INTEGER NOT NULL DEFAULT 0;
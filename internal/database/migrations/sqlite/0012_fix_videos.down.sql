@@ -0,0 +1,113 @@
+CREATE TABLE videos_old (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	title TEXT NOT NULL,
+	description TEXT,
+	thumbnail_url TEXT,
+	video_url TEXT TEXT,
+	user_id INTEGER,
+	video_key TEXT,
+	thumbnail_key TEXT,
+	hls_key TEXT,
+	dash_key TEXT,
+	preview_vtt_key TEXT,
+	original_key TEXT,
+	streaming_formats TEXT,
+	processing_status TEXT,
+	processing_error TEXT,
+	video_bytes INTEGER NOT NULL DEFAULT 0,
+	thumbnail_bytes INTEGER NOT NULL DEFAULT 0,
+	duration REAL,
+	width INTEGER,
+	height INTEGER,
+	video_codec TEXT,
+	audio_codec TEXT,
+	bitrate INTEGER,
+	frame_rate REAL,
+	audio_channels INTEGER,
+	rotation INTEGER,
+	file_size INTEGER,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+INSERT INTO videos_old (
+	id, created_at, updated_at, title, description, user_id,
+	video_key, thumbnail_key, hls_key, dash_key, preview_vtt_key, original_key,
+	streaming_formats, processing_status, processing_error,
+	video_bytes, thumbnail_bytes,
+	duration, width, height, video_codec, audio_codec, bitrate, frame_rate,
+	audio_channels, rotation, file_size
+)
+SELECT
+	id, created_at, updated_at, title, description, user_id,
+	video_key, thumbnail_key, hls_key, dash_key, preview_vtt_key, original_key,
+	streaming_formats, processing_status, processing_error,
+	video_bytes, thumbnail_bytes,
+	duration, width, height, video_codec, audio_codec, bitrate, frame_rate,
+	audio_channels, rotation, file_size
+FROM videos;
+
+INSERT INTO videos_old (
+	id, created_at, updated_at, title, description, thumbnail_url, video_url, user_id,
+	video_key, thumbnail_key, hls_key, dash_key, preview_vtt_key, original_key,
+	streaming_formats, processing_status, processing_error,
+	video_bytes, thumbnail_bytes,
+	duration, width, height, video_codec, audio_codec, bitrate, frame_rate,
+	audio_channels, rotation, file_size
+)
+SELECT
+	id, created_at, updated_at, title, description, thumbnail_url, video_url, user_id,
+	video_key, thumbnail_key, hls_key, dash_key, preview_vtt_key, original_key,
+	streaming_formats, processing_status, processing_error,
+	video_bytes, thumbnail_bytes,
+	duration, width, height, video_codec, audio_codec, bitrate, frame_rate,
+	audio_channels, rotation, file_size
+FROM orphaned_videos;
+
+CREATE TABLE jobs_old (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	status TEXT NOT NULL,
+	error TEXT,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	started_at TIMESTAMP,
+	finished_at TIMESTAMP,
+	video_id TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	source_path TEXT NOT NULL DEFAULT '',
+	source_key TEXT NOT NULL DEFAULT '',
+	media_type TEXT NOT NULL,
+	FOREIGN KEY(video_id) REFERENCES videos(id),
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+INSERT INTO jobs_old SELECT * FROM jobs;
+INSERT INTO jobs_old SELECT * FROM orphaned_jobs;
+
+CREATE TABLE thumbnail_candidates_old (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	video_id TEXT NOT NULL,
+	thumbnail_key TEXT NOT NULL,
+	position REAL NOT NULL,
+	FOREIGN KEY(video_id) REFERENCES videos(id)
+);
+
+INSERT INTO thumbnail_candidates_old SELECT * FROM thumbnail_candidates;
+INSERT INTO thumbnail_candidates_old SELECT * FROM orphaned_thumbnail_candidates;
+
+INSERT INTO refresh_tokens SELECT * FROM orphaned_refresh_tokens;
+
+DROP TABLE orphaned_refresh_tokens;
+DROP TABLE orphaned_thumbnail_candidates;
+DROP TABLE orphaned_jobs;
+DROP TABLE orphaned_videos;
+
+DROP TABLE thumbnail_candidates;
+DROP TABLE jobs;
+DROP TABLE videos;
+ALTER TABLE videos_old RENAME TO videos;
+ALTER TABLE jobs_old RENAME TO jobs;
+ALTER TABLE thumbnail_candidates_old RENAME TO thumbnail_candidates;
@@ -0,0 +1,128 @@
+-- videos.user_id was declared INTEGER and video_url as TEXT TEXT. SQLite
+-- can't change column types, so the table is rebuilt without the URL
+-- columns, which were replaced by object keys. Jobs and thumbnail
+-- candidates are rebuilt to be deleted along with their video.
+--
+-- Rows that point at users or videos that no longer exist can't go in the
+-- rebuilt tables. They're moved to orphaned_* tables rather than dropped,
+-- so they can be looked at and put back by hand, or dropped once they
+-- aren't needed.
+
+CREATE TABLE orphaned_videos AS
+SELECT * FROM videos
+WHERE user_id IS NULL OR user_id NOT IN (SELECT id FROM users);
+
+CREATE TABLE videos_new (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	title TEXT NOT NULL,
+	description TEXT,
+	user_id TEXT NOT NULL,
+	video_key TEXT,
+	thumbnail_key TEXT,
+	hls_key TEXT,
+	dash_key TEXT,
+	preview_vtt_key TEXT,
+	original_key TEXT,
+	streaming_formats TEXT,
+	processing_status TEXT,
+	processing_error TEXT,
+	video_bytes INTEGER NOT NULL DEFAULT 0,
+	thumbnail_bytes INTEGER NOT NULL DEFAULT 0,
+	duration REAL,
+	width INTEGER,
+	height INTEGER,
+	video_codec TEXT,
+	audio_codec TEXT,
+	bitrate INTEGER,
+	frame_rate REAL,
+	audio_channels INTEGER,
+	rotation INTEGER,
+	file_size INTEGER,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+INSERT INTO videos_new (
+	id, created_at, updated_at, title, description, user_id,
+	video_key, thumbnail_key, hls_key, dash_key, preview_vtt_key, original_key,
+	streaming_formats, processing_status, processing_error,
+	video_bytes, thumbnail_bytes,
+	duration, width, height, video_codec, audio_codec, bitrate, frame_rate,
+	audio_channels, rotation, file_size
+)
+SELECT
+	id, created_at, updated_at, title, description, CAST(user_id AS TEXT),
+	video_key, thumbnail_key, hls_key, dash_key, preview_vtt_key, original_key,
+	streaming_formats, processing_status, processing_error,
+	video_bytes, thumbnail_bytes,
+	duration, width, height, video_codec, audio_codec, bitrate, frame_rate,
+	audio_channels, rotation, file_size
+FROM videos
+WHERE id NOT IN (SELECT id FROM orphaned_videos);
+
+CREATE TABLE orphaned_jobs AS
+SELECT * FROM jobs
+WHERE video_id NOT IN (SELECT id FROM videos_new)
+	OR user_id NOT IN (SELECT id FROM users);
+
+CREATE TABLE jobs_new (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	status TEXT NOT NULL,
+	error TEXT,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	started_at TIMESTAMP,
+	finished_at TIMESTAMP,
+	video_id TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	source_path TEXT NOT NULL DEFAULT '',
+	source_key TEXT NOT NULL DEFAULT '',
+	media_type TEXT NOT NULL,
+	FOREIGN KEY(video_id) REFERENCES videos(id) ON DELETE CASCADE,
+	FOREIGN KEY(user_id) REFERENCES users(id)
+);
+
+INSERT INTO jobs_new
+SELECT
+	id, created_at, updated_at, status, error, attempts, started_at, finished_at,
+	video_id, user_id, source_path, source_key, media_type
+FROM jobs
+WHERE id NOT IN (SELECT id FROM orphaned_jobs);
+
+CREATE TABLE orphaned_thumbnail_candidates AS
+SELECT * FROM thumbnail_candidates
+WHERE video_id NOT IN (SELECT id FROM videos_new);
+
+CREATE TABLE thumbnail_candidates_new (
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	video_id TEXT NOT NULL,
+	thumbnail_key TEXT NOT NULL,
+	position REAL NOT NULL,
+	FOREIGN KEY(video_id) REFERENCES videos(id) ON DELETE CASCADE
+);
+
+INSERT INTO thumbnail_candidates_new
+SELECT id, created_at, video_id, thumbnail_key, position
+FROM thumbnail_candidates
+WHERE id NOT IN (SELECT id FROM orphaned_thumbnail_candidates);
+
+CREATE TABLE orphaned_refresh_tokens AS
+SELECT * FROM refresh_tokens
+WHERE user_id NOT IN (SELECT id FROM users);
+
+DELETE FROM refresh_tokens
+WHERE token IN (SELECT token FROM orphaned_refresh_tokens);
+
+DROP TABLE thumbnail_candidates;
+DROP TABLE jobs;
+DROP TABLE videos;
+ALTER TABLE videos_new RENAME TO videos;
+ALTER TABLE jobs_new RENAME TO jobs;
+ALTER TABLE thumbnail_candidates_new RENAME TO thumbnail_candidates;
+
+CREATE INDEX videos_user_id_idx ON videos(user_id);
+CREATE INDEX jobs_video_id_idx ON jobs(video_id);
+CREATE INDEX thumbnail_candidates_video_id_idx ON thumbnail_candidates(video_id);
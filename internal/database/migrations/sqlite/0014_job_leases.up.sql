@@ -0,0 +1,14 @@
+-- A processing job is leased to the worker that claimed it, which keeps
+-- renewing the lease while it works. Jobs whose lease ran out are queued
+-- again, so a server that dies doesn't strand its jobs and one that is
+-- still running doesn't have them taken away.
+ALTER TABLE jobs ADD COLUMN lease_owner TEXT NOT NULL DEFAULT '';
+ALTER TABLE jobs ADD COLUMN lease_expires_at TIMESTAMP;
+
+-- Jobs that are already processing belong to a server from before leases,
+-- which won't renew them. They get a lease long enough for that server to
+-- finish, so they aren't processed twice during a rolling deploy, and are
+-- only queued again if it never does.
+UPDATE jobs
+SET lease_owner = 'pre-lease', lease_expires_at = strftime('%Y-%m-%d %H:%M:%f+00:00', 'now', '+6 hours')
+WHERE status = 'processing';
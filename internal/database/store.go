@@ -0,0 +1,87 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// The stores split Client's methods by table so code can depend on only
+// what it uses. Store is all of them together. Client keeps them in SQLite
+// or Postgres, MemoryStore in memory.
+
+type UserStore interface {
+	GetUsers(ctx context.Context) ([]User, error)
+	GetUser(ctx context.Context, id uuid.UUID) (*User, error)
+	GetUserByEmail(ctx context.Context, email string) (User, error)
+	GetUserByRefreshToken(ctx context.Context, token string) (*User, error)
+	CreateUser(ctx context.Context, params CreateUserParams) (*User, error)
+	DeleteUser(ctx context.Context, id uuid.UUID) error
+}
+
+type VideoStore interface {
+	GetVideos(ctx context.Context, userID uuid.UUID) ([]Video, error)
+	GetAllVideos(ctx context.Context) ([]Video, error)
+	GetVideo(ctx context.Context, id uuid.UUID) (Video, error)
+	CreateVideo(ctx context.Context, params CreateVideoParams) (Video, error)
+	UpdateVideo(ctx context.Context, video Video) error
+	SetVideoProcessed(ctx context.Context, id uuid.UUID, processed ProcessedVideo) error
+	SetVideoProcessingStatus(ctx context.Context, id uuid.UUID, status string, processingErr *string) error
+	SetVideoThumbnail(ctx context.Context, id uuid.UUID, key string) error
+	SetDefaultVideoThumbnail(ctx context.Context, id uuid.UUID, key, replaceablePrefix string) error
+	DeleteVideo(ctx context.Context, id uuid.UUID) error
+	GetUsage(ctx context.Context, userID uuid.UUID) (Usage, error)
+	SetVideoUsage(ctx context.Context, id uuid.UUID, videoBytes, thumbnailBytes int64) error
+}
+
+type RefreshTokenStore interface {
+	GetRefreshToken(ctx context.Context, token string) (RefreshToken, error)
+	CreateRefreshToken(ctx context.Context, params CreateRefreshTokenParams) (RefreshToken, error)
+	RevokeRefreshToken(ctx context.Context, token string) error
+	DeleteRefreshToken(ctx context.Context, token string) error
+}
+
+type JobStore interface {
+	GetJob(ctx context.Context, id uuid.UUID) (Job, error)
+	CreateJob(ctx context.Context, params CreateJobParams) (Job, error)
+	GetUnfinishedJobs(ctx context.Context) ([]Job, error)
+	GetUnfinishedJobBySourceKey(ctx context.Context, sourceKey string) (Job, error)
+	ClaimNextJob(ctx context.Context, owner string, leaseDuration time.Duration) (*Job, error)
+	RenewJobLease(ctx context.Context, id uuid.UUID, owner string, leaseDuration time.Duration) error
+	FinishJob(ctx context.Context, id uuid.UUID, owner string, status string, jobErr *string) error
+	RequeueExpiredJobs(ctx context.Context, maxAttempts int) (int64, error)
+	FailExhaustedJobs(ctx context.Context, maxAttempts int, jobErr string) ([]Job, error)
+	CancelVideoJobs(ctx context.Context, videoID uuid.UUID, jobErr string) ([]Job, error)
+}
+
+type FailedDeletionStore interface {
+	GetFailedDeletion(ctx context.Context, id uuid.UUID) (FailedDeletion, error)
+	GetFailedDeletions(ctx context.Context) ([]FailedDeletion, error)
+	CreateFailedDeletion(ctx context.Context, params CreateFailedDeletionParams) (FailedDeletion, error)
+	UpdateFailedDeletion(ctx context.Context, fd FailedDeletion) error
+	DeleteFailedDeletion(ctx context.Context, id uuid.UUID) error
+}
+
+type ThumbnailCandidateStore interface {
+	GetThumbnailCandidate(ctx context.Context, id uuid.UUID) (ThumbnailCandidate, error)
+	GetThumbnailCandidates(ctx context.Context, videoID uuid.UUID) ([]ThumbnailCandidate, error)
+	GetAllThumbnailCandidates(ctx context.Context) ([]ThumbnailCandidate, error)
+	CreateThumbnailCandidate(ctx context.Context, params CreateThumbnailCandidateParams) (ThumbnailCandidate, error)
+	DeleteThumbnailCandidates(ctx context.Context, videoID uuid.UUID) error
+}
+
+type Store interface {
+	UserStore
+	VideoStore
+	RefreshTokenStore
+	JobStore
+	FailedDeletionStore
+	ThumbnailCandidateStore
+	Reset(ctx context.Context) error
+}
+
+var (
+	_ Store = Client{}
+	_ Store = (*MemoryStore)(nil)
+)
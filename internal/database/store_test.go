@@ -0,0 +1,217 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// storeUnderTest is a Store along with a way to backdate its jobs, since
+// SQLite's CURRENT_TIMESTAMP can't tell apart jobs created in one second.
+type storeUnderTest struct {
+	Store
+	setJobCreatedAt func(t *testing.T, id uuid.UUID, createdAt time.Time)
+}
+
+// forEachStore runs test against MemoryStore and every dialect of Client,
+// which all have to behave the same.
+func forEachStore(t *testing.T, test func(t *testing.T, s storeUnderTest)) {
+	t.Run("memory", func(t *testing.T) {
+		m := NewMemoryStore()
+		test(t, storeUnderTest{
+			Store: m,
+			setJobCreatedAt: func(t *testing.T, id uuid.UUID, createdAt time.Time) {
+				m.mu.Lock()
+				defer m.mu.Unlock()
+				job := m.jobs[id]
+				job.CreatedAt = createdAt
+				m.jobs[id] = job
+			},
+		})
+	})
+	forEachDialect(t, func(t *testing.T, c Client) {
+		test(t, storeUnderTest{
+			Store: c,
+			setJobCreatedAt: func(t *testing.T, id uuid.UUID, createdAt time.Time) {
+				_, err := c.exec(context.Background(), "UPDATE jobs SET created_at = ? WHERE id = ?", createdAt, id)
+				if err != nil {
+					t.Fatalf("setting created_at: %v", err)
+				}
+			},
+		})
+	})
+}
+
+func TestStoreNotFound(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s storeUnderTest) {
+		ctx := context.Background()
+		missing := uuid.New()
+		tests := []struct {
+			name string
+			get  func() error
+		}{
+			{"GetUser", func() error { _, err := s.GetUser(ctx, missing); return err }},
+			{"GetUserByEmail", func() error { _, err := s.GetUserByEmail(ctx, "missing@example.com"); return err }},
+			{"GetVideo", func() error { _, err := s.GetVideo(ctx, missing); return err }},
+			{"GetRefreshToken", func() error { _, err := s.GetRefreshToken(ctx, "missing"); return err }},
+			{"GetJob", func() error { _, err := s.GetJob(ctx, missing); return err }},
+			{"GetUnfinishedJobBySourceKey", func() error { _, err := s.GetUnfinishedJobBySourceKey(ctx, "missing"); return err }},
+			{"GetFailedDeletion", func() error { _, err := s.GetFailedDeletion(ctx, missing); return err }},
+			{"GetThumbnailCandidate", func() error { _, err := s.GetThumbnailCandidate(ctx, missing); return err }},
+		}
+		for _, tt := range tests {
+			if err := tt.get(); !errors.Is(err, ErrNotFound) {
+				t.Errorf("%s = %v, want ErrNotFound", tt.name, err)
+			}
+		}
+	})
+}
+
+func TestStoreDuplicateEmail(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s storeUnderTest) {
+		ctx := context.Background()
+		params := CreateUserParams{Email: "dup@example.com", Password: "hash"}
+		first, err := s.CreateUser(ctx, params)
+		if err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+		_, err = s.CreateUser(ctx, params)
+		if !errors.Is(err, ErrConflict) {
+			t.Errorf("CreateUser with a taken email = %v, want ErrConflict", err)
+		}
+
+		user, err := s.GetUserByEmail(ctx, params.Email)
+		if err != nil {
+			t.Fatalf("GetUserByEmail: %v", err)
+		}
+		if user.ID != first.ID {
+			t.Errorf("GetUserByEmail = %s, want the first user %s", user.ID, first.ID)
+		}
+	})
+}
+
+func TestStoreDeleteVideoCascades(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s storeUnderTest) {
+		ctx := context.Background()
+		user, video := createTestVideo(t, s)
+		_, other := createTestVideo(t, s)
+
+		job, err := s.CreateJob(ctx, CreateJobParams{VideoID: video.ID, UserID: user.ID, SourceKey: "source", MediaType: "video/mp4"})
+		if err != nil {
+			t.Fatalf("CreateJob: %v", err)
+		}
+		candidate, err := s.CreateThumbnailCandidate(ctx, CreateThumbnailCandidateParams{VideoID: video.ID, Key: "candidate.jpg", Position: 1})
+		if err != nil {
+			t.Fatalf("CreateThumbnailCandidate: %v", err)
+		}
+		otherCandidate, err := s.CreateThumbnailCandidate(ctx, CreateThumbnailCandidateParams{VideoID: other.ID, Key: "other.jpg", Position: 1})
+		if err != nil {
+			t.Fatalf("CreateThumbnailCandidate: %v", err)
+		}
+
+		if err := s.DeleteVideo(ctx, video.ID); err != nil {
+			t.Fatalf("DeleteVideo: %v", err)
+		}
+
+		if _, err := s.GetVideo(ctx, video.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetVideo after delete = %v, want ErrNotFound", err)
+		}
+		if _, err := s.GetJob(ctx, job.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetJob after deleting its video = %v, want ErrNotFound", err)
+		}
+		if _, err := s.GetThumbnailCandidate(ctx, candidate.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetThumbnailCandidate after deleting its video = %v, want ErrNotFound", err)
+		}
+		if _, err := s.GetThumbnailCandidate(ctx, otherCandidate.ID); err != nil {
+			t.Errorf("another video's candidate was deleted too: %v", err)
+		}
+		if _, err := s.GetUser(ctx, user.ID); err != nil {
+			t.Errorf("the video's owner was deleted too: %v", err)
+		}
+	})
+}
+
+func TestStoreDuplicateJobSource(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s storeUnderTest) {
+		ctx := context.Background()
+		user, video := createTestVideo(t, s)
+		params := CreateJobParams{VideoID: video.ID, UserID: user.ID, SourceKey: "source", MediaType: "video/mp4"}
+
+		queued, err := s.CreateJob(ctx, params)
+		if err != nil {
+			t.Fatalf("CreateJob: %v", err)
+		}
+		if _, err := s.CreateJob(ctx, params); !errors.Is(err, ErrConflict) {
+			t.Errorf("CreateJob for a queued source = %v, want ErrConflict", err)
+		}
+		found, err := s.GetUnfinishedJobBySourceKey(ctx, "source")
+		if err != nil || found.ID != queued.ID {
+			t.Errorf("GetUnfinishedJobBySourceKey = %s, %v, want %s", found.ID, err, queued.ID)
+		}
+
+		claimed, err := s.ClaimNextJob(ctx, "worker", time.Minute)
+		if err != nil || claimed == nil {
+			t.Fatalf("ClaimNextJob = %v, %v", claimed, err)
+		}
+		if _, err := s.CreateJob(ctx, params); !errors.Is(err, ErrConflict) {
+			t.Errorf("CreateJob for a processing source = %v, want ErrConflict", err)
+		}
+
+		// a source that failed to process can be queued again
+		if err := s.FinishJob(ctx, claimed.ID, "worker", StatusFailed, nil); err != nil {
+			t.Fatalf("FinishJob: %v", err)
+		}
+		if _, err := s.CreateJob(ctx, params); err != nil {
+			t.Errorf("CreateJob for a finished source: %v", err)
+		}
+	})
+}
+
+func TestStoreClaimNextJobOrder(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s storeUnderTest) {
+		ctx := context.Background()
+		user, video := createTestVideo(t, s)
+
+		base := time.Now().UTC().Add(-time.Hour)
+		offsets := []time.Duration{time.Minute, 3 * time.Minute, 0, 2 * time.Minute}
+		ids := make([]uuid.UUID, len(offsets))
+		for i, offset := range offsets {
+			job, err := s.CreateJob(ctx, CreateJobParams{VideoID: video.ID, UserID: user.ID, SourceKey: fmt.Sprint("source-", i), MediaType: "video/mp4"})
+			if err != nil {
+				t.Fatalf("CreateJob: %v", err)
+			}
+			s.setJobCreatedAt(t, job.ID, base.Add(offset))
+			ids[i] = job.ID
+		}
+
+		first, err := s.ClaimNextJob(ctx, "worker", time.Minute)
+		if err != nil || first == nil {
+			t.Fatalf("ClaimNextJob = %v, %v", first, err)
+		}
+		if first.ID != ids[2] {
+			t.Errorf("claimed job %s first, want the oldest %s", first.ID, ids[2])
+		}
+		if first.Status != StatusProcessing || first.Attempts != 1 || first.LeaseOwner != "worker" || first.LeaseExpiresAt == nil {
+			t.Errorf("claimed job = %+v, want it processing, leased to worker, attempt 1", first)
+		}
+
+		for _, want := range []uuid.UUID{ids[0], ids[3], ids[1]} {
+			job, err := s.ClaimNextJob(ctx, "worker", time.Minute)
+			if err != nil || job == nil {
+				t.Fatalf("ClaimNextJob = %v, %v", job, err)
+			}
+			if job.ID != want {
+				t.Errorf("claimed job %s, want %s", job.ID, want)
+			}
+		}
+
+		job, err := s.ClaimNextJob(ctx, "worker", time.Minute)
+		if err != nil || job != nil {
+			t.Errorf("ClaimNextJob with nothing queued = %v, %v, want nil, nil", job, err)
+		}
+	})
+}
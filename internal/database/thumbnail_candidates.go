@@ -0,0 +1,132 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ThumbnailCandidate is a frame extracted from a video that its owner can
+// pick as the thumbnail.
+type ThumbnailCandidate struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	URL       string    `json:"url"`
+	CreateThumbnailCandidateParams
+}
+
+type CreateThumbnailCandidateParams struct {
+	VideoID uuid.UUID `json:"video_id"`
+	Key     string    `json:"-"`
+	// Position is where in the video the frame was taken, in seconds.
+	Position float64 `json:"position"`
+}
+
+const thumbnailCandidateColumns = `
+		id,
+		created_at,
+		video_id,
+		thumbnail_key,
+		position
+`
+
+func scanThumbnailCandidate(row rowScanner) (ThumbnailCandidate, error) {
+	var candidate ThumbnailCandidate
+	err := row.Scan(
+		&candidate.ID,
+		&candidate.CreatedAt,
+		&candidate.VideoID,
+		&candidate.Key,
+		&candidate.Position,
+	)
+	return candidate, err
+}
+
+func scanThumbnailCandidates(rows *queryRows) ([]ThumbnailCandidate, error) {
+	defer rows.Close()
+	candidates := []ThumbnailCandidate{}
+	for rows.Next() {
+		candidate, err := scanThumbnailCandidate(rows)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, candidate)
+	}
+	return candidates, rows.Err()
+}
+
+func (c Client) CreateThumbnailCandidate(ctx context.Context, params CreateThumbnailCandidateParams) (ThumbnailCandidate, error) {
+	id := uuid.New()
+	query := `
+	INSERT INTO thumbnail_candidates (
+		id,
+		created_at,
+		video_id,
+		thumbnail_key,
+		position
+	) VALUES (?, CURRENT_TIMESTAMP, ?, ?, ?)
+	`
+	_, err := c.exec(ctx, query, id, params.VideoID, params.Key, params.Position)
+	if err != nil {
+		return ThumbnailCandidate{}, err
+	}
+
+	return c.GetThumbnailCandidate(ctx, id)
+}
+
+func (c Client) GetThumbnailCandidate(ctx context.Context, id uuid.UUID) (ThumbnailCandidate, error) {
+	query := `
+	SELECT` + thumbnailCandidateColumns + `
+	FROM thumbnail_candidates
+	WHERE id = ?
+	`
+
+	candidate, err := scanThumbnailCandidate(c.queryRow(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ThumbnailCandidate{}, ErrNotFound
+		}
+		return ThumbnailCandidate{}, err
+	}
+	return candidate, nil
+}
+
+func (c Client) GetThumbnailCandidates(ctx context.Context, videoID uuid.UUID) ([]ThumbnailCandidate, error) {
+	query := `
+	SELECT` + thumbnailCandidateColumns + `
+	FROM thumbnail_candidates
+	WHERE video_id = ?
+	ORDER BY position
+	`
+
+	rows, err := c.query(ctx, query, videoID)
+	if err != nil {
+		return nil, err
+	}
+	return scanThumbnailCandidates(rows)
+}
+
+func (c Client) GetAllThumbnailCandidates(ctx context.Context) ([]ThumbnailCandidate, error) {
+	query := `
+	SELECT` + thumbnailCandidateColumns + `
+	FROM thumbnail_candidates
+	`
+
+	rows, err := c.query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return scanThumbnailCandidates(rows)
+}
+
+func (c Client) DeleteThumbnailCandidates(ctx context.Context, videoID uuid.UUID) error {
+	query := `
+	DELETE FROM thumbnail_candidates
+	WHERE video_id = ?
+	`
+	_, err := c.exec(ctx, query, videoID)
+	return err
+}
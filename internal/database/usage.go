@@ -0,0 +1,55 @@
+package database
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// Usage is how much storage a user's videos take up. ReservedBytes is the
+// declared size of uploads that are queued or being processed, which
+// aren't in storage yet but will be.
+type Usage struct {
+	Videos         int   `json:"videos"`
+	VideoBytes     int64 `json:"video_bytes"`
+	ThumbnailBytes int64 `json:"thumbnail_bytes"`
+	ReservedBytes  int64 `json:"reserved_bytes"`
+}
+
+func (u Usage) TotalBytes() int64 {
+	return u.VideoBytes + u.ThumbnailBytes + u.ReservedBytes
+}
+
+func (c Client) GetUsage(ctx context.Context, userID uuid.UUID) (Usage, error) {
+	query := `
+	SELECT
+		COUNT(*),
+		COALESCE(SUM(video_bytes), 0),
+		COALESCE(SUM(thumbnail_bytes), 0),
+		(
+			SELECT COALESCE(SUM(size), 0)
+			FROM jobs
+			WHERE user_id = ? AND status IN (?, ?)
+		)
+	FROM videos
+	WHERE user_id = ?
+	`
+
+	var usage Usage
+	err := c.queryRow(ctx, query, userID, StatusQueued, StatusProcessing, userID).Scan(&usage.Videos, &usage.VideoBytes, &usage.ThumbnailBytes, &usage.ReservedBytes)
+	if err != nil {
+		return Usage{}, err
+	}
+	return usage, nil
+}
+
+// SetVideoUsage updates only the video's byte counts.
+func (c Client) SetVideoUsage(ctx context.Context, id uuid.UUID, videoBytes, thumbnailBytes int64) error {
+	query := `
+	UPDATE videos
+	SET video_bytes = ?, thumbnail_bytes = ?
+	WHERE id = ?
+	`
+	_, err := c.exec(ctx, query, videoBytes, thumbnailBytes, id)
+	return err
+}
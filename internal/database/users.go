@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"time"
@@ -20,7 +21,7 @@ type CreateUserParams struct {
 	Password string `json:"password"`
 }
 
-func (c Client) GetUsers() ([]User, error) {
+func (c Client) GetUsers(ctx context.Context) ([]User, error) {
 	query := `
 		SELECT
 			id,
@@ -28,7 +29,7 @@ func (c Client) GetUsers() ([]User, error) {
 		FROM users
 	`
 
-	rows, err := c.db.Query(query)
+	rows, err := c.query(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -51,7 +52,7 @@ func (c Client) GetUsers() ([]User, error) {
 	return users, nil
 }
 
-func (c Client) GetUserByEmail(email string) (User, error) {
+func (c Client) GetUserByEmail(ctx context.Context, email string) (User, error) {
 	query := `
 		SELECT id, created_at, updated_at, email, password
 		FROM users
@@ -59,10 +60,10 @@ func (c Client) GetUserByEmail(email string) (User, error) {
 	`
 	var user User
 	var id string
-	err := c.db.QueryRow(query, email).Scan(&id, &user.CreatedAt, &user.UpdatedAt, &user.Email, &user.Password)
+	err := c.queryRow(ctx, query, email).Scan(&id, &user.CreatedAt, &user.UpdatedAt, &user.Email, &user.Password)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return User{}, nil
+			return User{}, ErrNotFound
 		}
 		return User{}, err
 	}
@@ -73,7 +74,7 @@ func (c Client) GetUserByEmail(email string) (User, error) {
 	return user, nil
 }
 
-func (c Client) GetUserByRefreshToken(token string) (*User, error) {
+func (c Client) GetUserByRefreshToken(ctx context.Context, token string) (*User, error) {
 	query := `
 		SELECT u.id, u.email, u.created_at, u.updated_at, u.password
 		FROM users u
@@ -83,10 +84,10 @@ func (c Client) GetUserByRefreshToken(token string) (*User, error) {
 
 	var user User
 	var id string
-	err := c.db.QueryRow(query, token).Scan(&id, &user.Email, &user.CreatedAt, &user.UpdatedAt, &user.Password)
+	err := c.queryRow(ctx, query, token).Scan(&id, &user.Email, &user.CreatedAt, &user.UpdatedAt, &user.Password)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, nil
+			return nil, ErrNotFound
 		}
 		return nil, err
 	}
@@ -98,7 +99,7 @@ func (c Client) GetUserByRefreshToken(token string) (*User, error) {
 	return &user, nil
 }
 
-func (c Client) CreateUser(params CreateUserParams) (*User, error) {
+func (c Client) CreateUser(ctx context.Context, params CreateUserParams) (*User, error) {
 	id := uuid.New()
 
 	query := `
@@ -107,15 +108,15 @@ func (c Client) CreateUser(params CreateUserParams) (*User, error) {
 		VALUES
 		    (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?)
 	`
-	_, err := c.db.Exec(query, id.String(), params.Email, params.Password)
+	_, err := c.exec(ctx, query, id.String(), params.Email, params.Password)
 	if err != nil {
 		return nil, err
 	}
 
-	return c.GetUser(id)
+	return c.GetUser(ctx, id)
 }
 
-func (c Client) GetUser(id uuid.UUID) (*User, error) {
+func (c Client) GetUser(ctx context.Context, id uuid.UUID) (*User, error) {
 	query := `
 		SELECT id, created_at, updated_at, email, password
 		FROM users
@@ -123,10 +124,10 @@ func (c Client) GetUser(id uuid.UUID) (*User, error) {
 	`
 	var user User
 	var idStr string
-	err := c.db.QueryRow(query, id.String()).Scan(&idStr, &user.CreatedAt, &user.UpdatedAt, &user.Email, &user.Password)
+	err := c.queryRow(ctx, query, id.String()).Scan(&idStr, &user.CreatedAt, &user.UpdatedAt, &user.Email, &user.Password)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, nil
+			return nil, ErrNotFound
 		}
 		return nil, err
 	}
@@ -137,11 +138,11 @@ func (c Client) GetUser(id uuid.UUID) (*User, error) {
 	return &user, nil
 }
 
-func (c Client) DeleteUser(id uuid.UUID) error {
+func (c Client) DeleteUser(ctx context.Context, id uuid.UUID) error {
 	query := `
 		DELETE FROM users
 		WHERE id = ?
 	`
-	_, err := c.db.Exec(query, id.String())
+	_, err := c.exec(ctx, query, id.String())
 	return err
 }
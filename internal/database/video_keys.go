@@ -0,0 +1,81 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"net/url"
+	"strings"
+)
+
+// backfillVideoKeys fills video_key and thumbnail_key for rows written
+// when only full URLs were stored.
+func backfillVideoKeys(ctx context.Context, tx *sql.Tx) error {
+	query := `
+	SELECT id, video_url, thumbnail_url
+	FROM videos
+	WHERE (video_key IS NULL AND video_url IS NOT NULL)
+		OR (thumbnail_key IS NULL AND thumbnail_url IS NOT NULL)
+	`
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	type legacyRow struct {
+		id           string
+		videoURL     sql.NullString
+		thumbnailURL sql.NullString
+	}
+	legacyRows := []legacyRow{}
+	for rows.Next() {
+		var row legacyRow
+		if err := rows.Scan(&row.id, &row.videoURL, &row.thumbnailURL); err != nil {
+			rows.Close()
+			return err
+		}
+		legacyRows = append(legacyRows, row)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	update := `
+	UPDATE videos
+	SET
+		video_key = COALESCE(video_key, ?),
+		thumbnail_key = COALESCE(thumbnail_key, ?)
+	WHERE id = ?
+	`
+	for _, row := range legacyRows {
+		videoKey := legacyKey(row.videoURL, "objects/")
+		thumbnailKey := legacyKey(row.thumbnailURL, "assets/")
+		_, err := tx.ExecContext(ctx, update, videoKey, thumbnailKey, row.id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// legacyKey extracts an object key from a stored URL. Videos were served
+// from the CDN root (or /objects/ when stored locally) and thumbnails from
+// /assets/. Values without a scheme are already keys.
+func legacyKey(stored sql.NullString, servedFrom string) *string {
+	if !stored.Valid || stored.String == "" {
+		return nil
+	}
+	key := stored.String
+	if strings.Contains(key, "://") {
+		parsed, err := url.Parse(key)
+		if err != nil {
+			return nil
+		}
+		key = strings.TrimPrefix(parsed.Path, "/")
+		key = strings.TrimPrefix(key, servedFrom)
+	}
+	if key == "" {
+		return nil
+	}
+	return &key
+}
@@ -0,0 +1,42 @@
+package database
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestLegacyKey(t *testing.T) {
+	tests := []struct {
+		name       string
+		stored     sql.NullString
+		servedFrom string
+		want       string
+	}{
+		{"null", sql.NullString{}, "objects/", ""},
+		{"empty", sql.NullString{String: "", Valid: true}, "objects/", ""},
+		{"CDN URL", sql.NullString{String: "https://d1234.cloudfront.net/landscape/abc.mp4", Valid: true}, "objects/", "landscape/abc.mp4"},
+		{"S3 URL", sql.NullString{String: "https://tubely.s3.us-east-2.amazonaws.com/portrait/abc.mp4", Valid: true}, "objects/", "portrait/abc.mp4"},
+		{"local video", sql.NullString{String: "http://localhost:8091/objects/landscape/abc.mp4", Valid: true}, "objects/", "landscape/abc.mp4"},
+		{"local thumbnail", sql.NullString{String: "http://localhost:8091/assets/abc.png", Valid: true}, "assets/", "abc.png"},
+		{"query string", sql.NullString{String: "https://d1234.cloudfront.net/landscape/abc.mp4?Expires=1&Signature=x", Valid: true}, "objects/", "landscape/abc.mp4"},
+		{"escaped path", sql.NullString{String: "https://d1234.cloudfront.net/other/a%20b.mp4", Valid: true}, "objects/", "other/a b.mp4"},
+		{"already a key", sql.NullString{String: "landscape/abc.mp4", Valid: true}, "objects/", "landscape/abc.mp4"},
+		{"bare key keeps its prefix", sql.NullString{String: "objects/abc.mp4", Valid: true}, "objects/", "objects/abc.mp4"},
+		{"URL without a path", sql.NullString{String: "https://d1234.cloudfront.net/", Valid: true}, "objects/", ""},
+		{"unparseable URL", sql.NullString{String: "http://[::1/abc.mp4", Valid: true}, "objects/", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := legacyKey(tt.stored, tt.servedFrom)
+			if tt.want == "" {
+				if got != nil {
+					t.Errorf("legacyKey(%q) = %q, want nil", tt.stored.String, *got)
+				}
+				return
+			}
+			if got == nil || *got != tt.want {
+				t.Errorf("legacyKey(%q) = %v, want %q", tt.stored.String, got, tt.want)
+			}
+		})
+	}
+}
@@ -1,72 +1,187 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 type Video struct {
-	ID           uuid.UUID `json:"id"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
-	ThumbnailURL *string   `json:"thumbnail_url"`
-	VideoURL     *string   `json:"video_url"`
+	ID               uuid.UUID     `json:"id"`
+	CreatedAt        time.Time     `json:"created_at"`
+	UpdatedAt        time.Time     `json:"updated_at"`
+	ThumbnailURL     *string       `json:"thumbnail_url"`
+	VideoURL         *string       `json:"video_url"`
+	HLSURL           *string       `json:"hls_url"`
+	DASHURL          *string       `json:"dash_url"`
+	PreviewVTTURL    *string       `json:"preview_vtt_url"`
+	StreamingFormats []string      `json:"streaming_formats"`
+	ProcessingStatus *string       `json:"processing_status"`
+	ProcessingError  *string       `json:"processing_error"`
+	Metadata         VideoMetadata `json:"metadata"`
+	VideoBytes       int64         `json:"video_bytes"`
+	ThumbnailBytes   int64         `json:"thumbnail_bytes"`
+	ThumbnailKey     *string       `json:"-"`
+	VideoKey         *string       `json:"-"`
+	HLSKey           *string       `json:"-"`
+	DASHKey          *string       `json:"-"`
+	PreviewVTTKey    *string       `json:"-"`
+	OriginalKey      *string       `json:"-"`
 	CreateVideoParams
 }
 
+// VideoMetadata is what ffprobe reported about the stored video file.
+type VideoMetadata struct {
+	Duration      *float64 `json:"duration"`
+	Width         *int     `json:"width"`
+	Height        *int     `json:"height"`
+	VideoCodec    *string  `json:"video_codec"`
+	AudioCodec    *string  `json:"audio_codec"`
+	Bitrate       *int64   `json:"bitrate"`
+	FrameRate     *float64 `json:"frame_rate"`
+	AudioChannels *int     `json:"audio_channels"`
+	Rotation      *int     `json:"rotation"`
+	FileSize      *int64   `json:"file_size"`
+}
+
 type CreateVideoParams struct {
 	Title       string    `json:"title"`
 	Description string    `json:"description"`
 	UserID      uuid.UUID `json:"user_id"`
 }
 
-func (c Client) GetVideos(userID uuid.UUID) ([]Video, error) {
-	query := `
-	SELECT
+const videoColumns = `
 		id,
 		created_at,
 		updated_at,
 		title,
 		description,
-		thumbnail_url,
-		video_url,
+		thumbnail_key,
+		video_key,
+		hls_key,
+		dash_key,
+		preview_vtt_key,
+		original_key,
+		streaming_formats,
+		processing_status,
+		processing_error,
+		duration,
+		width,
+		height,
+		video_codec,
+		audio_codec,
+		bitrate,
+		frame_rate,
+		audio_channels,
+		rotation,
+		file_size,
+		video_bytes,
+		thumbnail_bytes,
 		user_id
-	FROM videos
-	WHERE user_id = ?
-	ORDER BY created_at DESC
-	`
+`
 
-	rows, err := c.db.Query(query, userID)
-	if err != nil {
-		return nil, err
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanVideo(row rowScanner) (Video, error) {
+	var video Video
+	var streamingFormats sql.NullString
+	err := row.Scan(
+		&video.ID,
+		&video.CreatedAt,
+		&video.UpdatedAt,
+		&video.Title,
+		&video.Description,
+		&video.ThumbnailKey,
+		&video.VideoKey,
+		&video.HLSKey,
+		&video.DASHKey,
+		&video.PreviewVTTKey,
+		&video.OriginalKey,
+		&streamingFormats,
+		&video.ProcessingStatus,
+		&video.ProcessingError,
+		&video.Metadata.Duration,
+		&video.Metadata.Width,
+		&video.Metadata.Height,
+		&video.Metadata.VideoCodec,
+		&video.Metadata.AudioCodec,
+		&video.Metadata.Bitrate,
+		&video.Metadata.FrameRate,
+		&video.Metadata.AudioChannels,
+		&video.Metadata.Rotation,
+		&video.Metadata.FileSize,
+		&video.VideoBytes,
+		&video.ThumbnailBytes,
+		&video.UserID,
+	)
+	video.StreamingFormats = splitList(streamingFormats)
+	return video, err
+}
+
+func splitList(list sql.NullString) []string {
+	if !list.Valid || list.String == "" {
+		return []string{}
+	}
+	return strings.Split(list.String, ",")
+}
+
+func joinList(list []string) sql.NullString {
+	if len(list) == 0 {
+		return sql.NullString{}
 	}
+	return sql.NullString{String: strings.Join(list, ","), Valid: true}
+}
+
+func scanVideos(rows *queryRows) ([]Video, error) {
 	defer rows.Close()
 
 	videos := []Video{}
 	for rows.Next() {
-		var video Video
-		if err := rows.Scan(
-			&video.ID,
-			&video.CreatedAt,
-			&video.UpdatedAt,
-			&video.Title,
-			&video.Description,
-			&video.ThumbnailURL,
-			&video.VideoURL,
-			&video.UserID,
-		); err != nil {
+		video, err := scanVideo(rows)
+		if err != nil {
 			return nil, err
 		}
 		videos = append(videos, video)
 	}
 
-	return videos, nil
+	return videos, rows.Err()
+}
+
+func (c Client) GetVideos(ctx context.Context, userID uuid.UUID) ([]Video, error) {
+	query := `
+	SELECT` + videoColumns + `
+	FROM videos
+	WHERE user_id = ?
+	ORDER BY created_at DESC
+	`
+
+	rows, err := c.query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	return scanVideos(rows)
+}
+
+func (c Client) GetAllVideos(ctx context.Context) ([]Video, error) {
+	query := `
+	SELECT` + videoColumns + `
+	FROM videos
+	`
+
+	rows, err := c.query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return scanVideos(rows)
 }
 
-func (c Client) CreateVideo(params CreateVideoParams) (Video, error) {
+func (c Client) CreateVideo(ctx context.Context, params CreateVideoParams) (Video, error) {
 	id := uuid.New()
 	query := `
 	INSERT INTO videos (
@@ -78,42 +193,25 @@ func (c Client) CreateVideo(params CreateVideoParams) (Video, error) {
 		user_id
 	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?)
 	`
-	_, err := c.db.Exec(query, id, params.Title, params.Description, params.UserID)
+	_, err := c.exec(ctx, query, id, params.Title, params.Description, params.UserID)
 	if err != nil {
 		return Video{}, err
 	}
 
-	return c.GetVideo(id)
+	return c.GetVideo(ctx, id)
 }
 
-func (c Client) GetVideo(id uuid.UUID) (Video, error) {
+func (c Client) GetVideo(ctx context.Context, id uuid.UUID) (Video, error) {
 	query := `
-	SELECT
-		id,
-		created_at,
-		updated_at,
-		title,
-		description,
-		thumbnail_url,
-		video_url,
-		user_id
+	SELECT` + videoColumns + `
 	FROM videos
 	WHERE id = ?
 	`
 
-	var video Video
-	err := c.db.QueryRow(query, id).Scan(
-		&video.ID,
-		&video.CreatedAt,
-		&video.UpdatedAt,
-		&video.Title,
-		&video.Description,
-		&video.ThumbnailURL,
-		&video.VideoURL,
-		&video.UserID)
+	video, err := scanVideo(c.queryRow(ctx, query, id))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return Video{}, nil
+			return Video{}, ErrNotFound
 		}
 		return Video{}, err
 	}
@@ -121,35 +219,171 @@ func (c Client) GetVideo(id uuid.UUID) (Video, error) {
 	return video, nil
 }
 
-func (c Client) UpdateVideo(video Video) error {
+func (c Client) UpdateVideo(ctx context.Context, video Video) error {
 	query := `
 	UPDATE videos
 	SET
 		title = ?,
 		description = ?,
-		thumbnail_url = ?,
-		video_url = ?,
+		thumbnail_key = ?,
+		video_key = ?,
+		hls_key = ?,
+		dash_key = ?,
+		preview_vtt_key = ?,
+		original_key = ?,
+		streaming_formats = ?,
+		processing_status = ?,
+		processing_error = ?,
+		duration = ?,
+		width = ?,
+		height = ?,
+		video_codec = ?,
+		audio_codec = ?,
+		bitrate = ?,
+		frame_rate = ?,
+		audio_channels = ?,
+		rotation = ?,
+		file_size = ?,
+		video_bytes = ?,
+		thumbnail_bytes = ?,
 		user_id = ?
 	WHERE id = ?
 	`
 
-	_, err := c.db.Exec(
+	_, err := c.exec(
+		ctx,
 		query,
 		video.Title,
 		video.Description,
-		&video.ThumbnailURL,
-		&video.VideoURL,
+		video.ThumbnailKey,
+		video.VideoKey,
+		video.HLSKey,
+		video.DASHKey,
+		video.PreviewVTTKey,
+		video.OriginalKey,
+		joinList(video.StreamingFormats),
+		video.ProcessingStatus,
+		video.ProcessingError,
+		video.Metadata.Duration,
+		video.Metadata.Width,
+		video.Metadata.Height,
+		video.Metadata.VideoCodec,
+		video.Metadata.AudioCodec,
+		video.Metadata.Bitrate,
+		video.Metadata.FrameRate,
+		video.Metadata.AudioChannels,
+		video.Metadata.Rotation,
+		video.Metadata.FileSize,
+		video.VideoBytes,
+		video.ThumbnailBytes,
 		video.UserID,
 		video.ID,
 	)
 	return err
 }
 
-func (c Client) DeleteVideo(id uuid.UUID) error {
+// ProcessedVideo is what processing an upload produces. It is written
+// with SetVideoProcessed, which leaves every other column alone, so edits
+// made while a video was processing aren't lost.
+type ProcessedVideo struct {
+	VideoKey         *string
+	OriginalKey      *string
+	HLSKey           *string
+	DASHKey          *string
+	PreviewVTTKey    *string
+	StreamingFormats []string
+	Metadata         VideoMetadata
+}
+
+func (c Client) SetVideoProcessed(ctx context.Context, id uuid.UUID, processed ProcessedVideo) error {
+	query := `
+	UPDATE videos
+	SET
+		video_key = ?,
+		original_key = ?,
+		hls_key = ?,
+		dash_key = ?,
+		preview_vtt_key = ?,
+		streaming_formats = ?,
+		duration = ?,
+		width = ?,
+		height = ?,
+		video_codec = ?,
+		audio_codec = ?,
+		bitrate = ?,
+		frame_rate = ?,
+		audio_channels = ?,
+		rotation = ?,
+		file_size = ?,
+		updated_at = CURRENT_TIMESTAMP
+	WHERE id = ?
+	`
+	_, err := c.exec(
+		ctx,
+		query,
+		processed.VideoKey,
+		processed.OriginalKey,
+		processed.HLSKey,
+		processed.DASHKey,
+		processed.PreviewVTTKey,
+		joinList(processed.StreamingFormats),
+		processed.Metadata.Duration,
+		processed.Metadata.Width,
+		processed.Metadata.Height,
+		processed.Metadata.VideoCodec,
+		processed.Metadata.AudioCodec,
+		processed.Metadata.Bitrate,
+		processed.Metadata.FrameRate,
+		processed.Metadata.AudioChannels,
+		processed.Metadata.Rotation,
+		processed.Metadata.FileSize,
+		id,
+	)
+	return err
+}
+
+// SetVideoProcessingStatus updates only the video's processing status.
+func (c Client) SetVideoProcessingStatus(ctx context.Context, id uuid.UUID, status string, processingErr *string) error {
+	query := `
+	UPDATE videos
+	SET processing_status = ?, processing_error = ?, updated_at = CURRENT_TIMESTAMP
+	WHERE id = ?
+	`
+	_, err := c.exec(ctx, query, status, processingErr, id)
+	return err
+}
+
+// SetVideoThumbnail updates only the video's thumbnail.
+func (c Client) SetVideoThumbnail(ctx context.Context, id uuid.UUID, key string) error {
+	query := `
+	UPDATE videos
+	SET thumbnail_key = ?, updated_at = CURRENT_TIMESTAMP
+	WHERE id = ?
+	`
+	_, err := c.exec(ctx, query, key, id)
+	return err
+}
+
+// SetDefaultVideoThumbnail sets the video's thumbnail unless it already has
+// one that doesn't start with replaceablePrefix, like one its owner
+// uploaded. The check and the update happen in one statement, so a
+// thumbnail uploaded at the same moment is never overwritten.
+func (c Client) SetDefaultVideoThumbnail(ctx context.Context, id uuid.UUID, key, replaceablePrefix string) error {
+	query := `
+	UPDATE videos
+	SET thumbnail_key = ?, updated_at = CURRENT_TIMESTAMP
+	WHERE id = ? AND (thumbnail_key IS NULL OR substr(thumbnail_key, 1, ?) = ?)
+	`
+	_, err := c.exec(ctx, query, key, id, len(replaceablePrefix), replaceablePrefix)
+	return err
+}
+
+// DeleteVideo also deletes the video's jobs and thumbnail candidates.
+func (c Client) DeleteVideo(ctx context.Context, id uuid.UUID) error {
 	query := `
 	DELETE FROM videos
 	WHERE id = ?
 	`
-	_, err := c.db.Exec(query, id)
+	_, err := c.exec(ctx, query, id)
 	return err
 }
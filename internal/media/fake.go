@@ -0,0 +1,219 @@
+package media
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Fake is a Processor that doesn't need ffmpeg installed. Probe returns
+// Metadata, and Run writes the files ffmpeg would have so later steps find
+// what they expect: a copy of the first input for plain outputs and the
+// first file of image sequences, and a playlist or manifest with one
+// segment per input for HLS and DASH.
+type Fake struct {
+	Metadata Metadata
+	ProbeErr error
+	RunErr   error
+
+	mu    sync.Mutex
+	calls []FakeCall
+}
+
+type FakeCall struct {
+	Op   Operation
+	Args []string
+}
+
+func (f *Fake) Probe(ctx context.Context, path string) (Metadata, error) {
+	f.record(OpProbe, []string{path})
+	if err := ctx.Err(); err != nil {
+		return Metadata{}, err
+	}
+	return f.Metadata, f.ProbeErr
+}
+
+func (f *Fake) Run(ctx context.Context, op Operation, args []string, progress *Progress) error {
+	f.record(op, args)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if f.RunErr != nil {
+		return f.RunErr
+	}
+
+	inputs := flagValues(args, "-i")
+	if len(inputs) == 0 || len(args) < 2 {
+		return nil
+	}
+	output := args[len(args)-1]
+	var err error
+	switch lastFlagValue(args, "-f", "") {
+	case "hls":
+		err = fakeHLS(args, inputs[0], output)
+	case "dash":
+		err = fakeDASH(args, inputs, output)
+	default:
+		err = copyFile(inputs[0], sequenceName(output, lastFlagValue(args, "-start_number", "1")))
+	}
+	if err != nil {
+		return err
+	}
+	if progress != nil {
+		progress.Report(100)
+	}
+	return nil
+}
+
+// Calls returns the operations and arguments Probe and Run were called with.
+func (f *Fake) Calls() []FakeCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.calls)
+}
+
+func (f *Fake) record(op Operation, args []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, FakeCall{Op: op, Args: slices.Clone(args)})
+}
+
+// fakeHLS writes a media playlist with a single segment.
+func fakeHLS(args []string, input, playlist string) error {
+	pattern := lastFlagValue(args, "-hls_segment_filename", strings.TrimSuffix(playlist, filepath.Ext(playlist))+"%d.ts")
+	segment := sequenceName(pattern, "0")
+	err := copyFile(input, segment)
+	if err != nil {
+		return err
+	}
+	duration := lastFlagValue(args, "-hls_time", "2")
+	return writeFile(playlist, fmt.Sprintf(
+		"#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:%s\n#EXT-X-MEDIA-SEQUENCE:0\n#EXT-X-PLAYLIST-TYPE:VOD\n#EXTINF:%s.000000,\n%s\n#EXT-X-ENDLIST\n",
+		duration, duration, filepath.Base(segment),
+	))
+}
+
+var (
+	dashRepresentationID = regexp.MustCompile(`\$RepresentationID\$`)
+	dashNumber           = regexp.MustCompile(`\$Number(%0\d+d)?\$`)
+)
+
+// fakeDASH writes an MPD listing an init segment and one media segment for
+// each input.
+func fakeDASH(args []string, inputs []string, manifest string) error {
+	initName := lastFlagValue(args, "-init_seg_name", "init-stream$RepresentationID$.m4s")
+	mediaName := lastFlagValue(args, "-media_seg_name", "chunk-stream$RepresentationID$-$Number%05d$.m4s")
+	dir := filepath.Dir(manifest)
+
+	var representations strings.Builder
+	for i, input := range inputs {
+		id := strconv.Itoa(i)
+		initSegment := dashSegmentName(initName, id)
+		mediaSegment := dashSegmentName(mediaName, id)
+		for _, segment := range []string{initSegment, mediaSegment} {
+			err := copyFile(input, filepath.Join(dir, segment))
+			if err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(&representations,
+			"      <Representation id=\"%s\" mimeType=\"video/mp4\">\n"+
+				"        <SegmentList timescale=\"1\" duration=\"%s\">\n"+
+				"          <Initialization sourceURL=\"%s\"/>\n"+
+				"          <SegmentURL media=\"%s\"/>\n"+
+				"        </SegmentList>\n"+
+				"      </Representation>\n",
+			id, lastFlagValue(args, "-seg_duration", "2"), initSegment, mediaSegment,
+		)
+	}
+	return writeFile(manifest, "<?xml version=\"1.0\" encoding=\"utf-8\"?>\n"+
+		"<MPD xmlns=\"urn:mpeg:dash:schema:mpd:2011\" type=\"static\">\n"+
+		"  <Period id=\"0\">\n"+
+		"    <AdaptationSet id=\"0\" contentType=\"video\">\n"+
+		representations.String()+
+		"    </AdaptationSet>\n"+
+		"  </Period>\n"+
+		"</MPD>\n")
+}
+
+func dashSegmentName(template, id string) string {
+	name := dashRepresentationID.ReplaceAllString(template, id)
+	return dashNumber.ReplaceAllStringFunc(name, func(match string) string {
+		format := dashNumber.FindStringSubmatch(match)[1]
+		if format == "" {
+			format = "%d"
+		}
+		return fmt.Sprintf(format, 1)
+	})
+}
+
+var sequencePattern = regexp.MustCompile(`%(0\d+)?d`)
+
+// sequenceName is the first file of an image sequence or segment pattern
+// such as sprite-%03d.jpg, or name itself if it isn't a pattern.
+func sequenceName(name, startNumber string) string {
+	start, err := strconv.Atoi(startNumber)
+	if err != nil {
+		start = 1
+	}
+	return sequencePattern.ReplaceAllStringFunc(name, func(format string) string {
+		return fmt.Sprintf(format, start)
+	})
+}
+
+// flagValues returns the value after every occurrence of flag.
+func flagValues(args []string, flag string) []string {
+	values := []string{}
+	for i := 0; i+1 < len(args); i++ {
+		if args[i] == flag {
+			values = append(values, args[i+1])
+			i++
+		}
+	}
+	return values
+}
+
+func lastFlagValue(args []string, flag, defaultValue string) string {
+	values := flagValues(args, flag)
+	if len(values) == 0 {
+		return defaultValue
+	}
+	return values[len(values)-1]
+}
+
+func writeFile(path, content string) error {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(content), 0644)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	err = os.MkdirAll(filepath.Dir(dst), 0755)
+	if err != nil {
+		return err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,168 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newFakeInput(t *testing.T) string {
+	t.Helper()
+	input := filepath.Join(t.TempDir(), "input.mp4")
+	err := os.WriteFile(input, []byte("video"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return input
+}
+
+func TestFakeRunOutputs(t *testing.T) {
+	tests := []struct {
+		name      string
+		op        Operation
+		args      func(input, out string) []string
+		wantFiles []string
+	}{
+		{
+			"plain output in a new directory",
+			OpRemux,
+			func(input, out string) []string {
+				return []string{"-y", "-i", input, "-c", "copy", "-f", "mp4", filepath.Join(out, "nested", "video.mp4")}
+			},
+			[]string{"nested/video.mp4"},
+		},
+		{
+			"image sequence",
+			OpFrames,
+			func(input, out string) []string {
+				return []string{"-y", "-i", input, "-start_number", "0", filepath.Join(out, "sprite-%03d.jpg")}
+			},
+			[]string{"sprite-000.jpg"},
+		},
+		{
+			"image sequence from ffmpeg's default start",
+			OpFrames,
+			func(input, out string) []string {
+				return []string{"-y", "-i", input, filepath.Join(out, "frame-%d.jpg")}
+			},
+			[]string{"frame-1.jpg"},
+		},
+		{
+			"hls",
+			OpPackage,
+			func(input, out string) []string {
+				return []string{"-y", "-i", input, "-c", "copy", "-f", "hls", "-hls_time", "6",
+					"-hls_segment_filename", filepath.Join(out, "hls", "720p_%04d.ts"), filepath.Join(out, "hls", "720p.m3u8")}
+			},
+			[]string{"hls/720p.m3u8", "hls/720p_0000.ts"},
+		},
+		{
+			"dash",
+			OpPackage,
+			func(input, out string) []string {
+				return []string{"-y", "-i", input, "-i", input, "-c", "copy", "-f", "dash",
+					"-init_seg_name", "init-$RepresentationID$.m4s",
+					"-media_seg_name", "chunk-$RepresentationID$-$Number%05d$.m4s",
+					filepath.Join(out, "dash", "manifest.mpd")}
+			},
+			[]string{"dash/manifest.mpd", "dash/init-0.m4s", "dash/chunk-0-00001.m4s", "dash/init-1.m4s", "dash/chunk-1-00001.m4s"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := newFakeInput(t)
+			out := t.TempDir()
+			reported := 0.0
+			err := (&Fake{}).Run(context.Background(), tt.op, tt.args(input, out), &Progress{Report: func(percent float64) { reported = percent }})
+			if err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+			for _, name := range tt.wantFiles {
+				if _, err := os.Stat(filepath.Join(out, name)); err != nil {
+					t.Errorf("%s wasn't written: %v", name, err)
+				}
+			}
+			if reported != 100 {
+				t.Errorf("progress reported %v, want 100", reported)
+			}
+		})
+	}
+}
+
+// TestFakeManifestsReferenceSegments checks the playlists and manifests
+// Fake writes only refer to files that exist next to them.
+func TestFakeManifestsReferenceSegments(t *testing.T) {
+	input := newFakeInput(t)
+	out := t.TempDir()
+	fake := &Fake{}
+
+	playlist := filepath.Join(out, "hls", "720p.m3u8")
+	err := fake.Run(context.Background(), OpPackage, []string{"-i", input, "-f", "hls",
+		"-hls_segment_filename", filepath.Join(out, "hls", "720p_%04d.ts"), playlist}, nil)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	data, err := os.ReadFile(playlist)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(out, "hls", line)); err != nil {
+			t.Errorf("playlist refers to %s: %v", line, err)
+		}
+	}
+	if !strings.Contains(string(data), "#EXT-X-ENDLIST") {
+		t.Errorf("playlist isn't a complete VOD playlist:\n%s", data)
+	}
+
+	manifest := filepath.Join(out, "dash", "manifest.mpd")
+	err = fake.Run(context.Background(), OpPackage, []string{"-i", input, "-f", "dash",
+		"-init_seg_name", "init-$RepresentationID$.m4s",
+		"-media_seg_name", "chunk-$RepresentationID$-$Number%05d$.m4s", manifest}, nil)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	data, err = os.ReadFile(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"init-0.m4s", "chunk-0-00001.m4s"} {
+		if !strings.Contains(string(data), `"`+name+`"`) {
+			t.Errorf("manifest doesn't refer to %s:\n%s", name, data)
+		}
+	}
+}
+
+func TestFakeErrors(t *testing.T) {
+	input := newFakeInput(t)
+	output := filepath.Join(t.TempDir(), "out.mp4")
+	errBoom := errors.New("boom")
+
+	fake := &Fake{RunErr: errBoom, ProbeErr: errBoom}
+	if err := fake.Run(context.Background(), OpRemux, []string{"-i", input, output}, nil); !errors.Is(err, errBoom) {
+		t.Errorf("Run = %v, want RunErr", err)
+	}
+	if _, err := fake.Probe(context.Background(), input); !errors.Is(err, errBoom) {
+		t.Errorf("Probe = %v, want ProbeErr", err)
+	}
+	if _, err := os.Stat(output); !os.IsNotExist(err) {
+		t.Errorf("failed Run wrote its output: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := (&Fake{}).Run(ctx, OpRemux, []string{"-i", input, output}, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("Run with a canceled context = %v, want context.Canceled", err)
+	}
+
+	calls := fake.Calls()
+	if len(calls) != 2 || calls[0].Op != OpRemux || calls[1].Op != OpProbe {
+		t.Errorf("Calls() = %v, want the remux and the probe", calls)
+	}
+}
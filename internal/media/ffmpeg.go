@@ -0,0 +1,202 @@
+package media
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// stderrLimit is how much of the end of a command's stderr is kept for
+// its CommandError.
+const stderrLimit = 16 << 10
+
+// CommandError describes an ffmpeg or ffprobe run that failed. Err is the
+// context's error if the command was killed for taking too long or being
+// canceled.
+type CommandError struct {
+	Op       Operation
+	Command  string
+	Args     []string
+	ExitCode int
+	Stderr   string
+	Err      error
+}
+
+func (e *CommandError) Error() string {
+	msg := fmt.Sprintf("%s %s failed", e.Command, e.Op)
+	switch {
+	case errors.Is(e.Err, context.DeadlineExceeded):
+		msg += ": timed out"
+	case errors.Is(e.Err, context.Canceled):
+		msg += ": canceled"
+	case e.ExitCode > 0:
+		msg += fmt.Sprintf(" with exit code %d", e.ExitCode)
+	default:
+		msg += fmt.Sprintf(": %v", e.Err)
+	}
+	if line := lastLine(e.Stderr); line != "" {
+		msg += ": " + line
+	}
+	return msg
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+// FFmpeg runs the ffmpeg and ffprobe binaries.
+type FFmpeg struct {
+	ffmpegPath  string
+	ffprobePath string
+	timeouts    Timeouts
+}
+
+// NewFFmpeg looks ffmpeg and ffprobe up in PATH.
+func NewFFmpeg(timeouts Timeouts) *FFmpeg {
+	return &FFmpeg{
+		ffmpegPath:  "ffmpeg",
+		ffprobePath: "ffprobe",
+		timeouts:    timeouts,
+	}
+}
+
+func (f *FFmpeg) Probe(ctx context.Context, path string) (Metadata, error) {
+	var stdout bytes.Buffer
+	err := f.run(ctx, OpProbe, f.ffprobePath, []string{
+		"-v", "error",
+		"-print_format", "json",
+		"-show_streams",
+		"-show_format",
+		path,
+	}, func(cmd *exec.Cmd) (func(), error) {
+		cmd.Stdout = &stdout
+		return nil, nil
+	})
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	metadata := Metadata{}
+	err = json.Unmarshal(stdout.Bytes(), &metadata)
+	if err != nil {
+		return Metadata{}, fmt.Errorf("couldn't parse ffprobe output: %w", err)
+	}
+	return metadata, nil
+}
+
+func (f *FFmpeg) Run(ctx context.Context, op Operation, args []string, progress *Progress) error {
+	args = append([]string{"-hide_banner", "-nostdin"}, args...)
+	if progress == nil {
+		return f.run(ctx, op, f.ffmpegPath, args, nil)
+	}
+
+	args = append([]string{"-progress", "pipe:1", "-nostats"}, args...)
+	return f.run(ctx, op, f.ffmpegPath, args, func(cmd *exec.Cmd) (func(), error) {
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return nil, err
+		}
+		return func() { readProgress(stdout, progress) }, nil
+	})
+}
+
+// run starts the command with the operation's timeout. setup can attach
+// stdout and return a function that consumes it before the command is
+// waited for.
+func (f *FFmpeg) run(ctx context.Context, op Operation, name string, args []string, setup func(*exec.Cmd) (func(), error)) error {
+	if timeout := f.timeouts[op]; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, name, args...)
+	// don't hang on pipes a killed process left to its children
+	cmd.WaitDelay = 5 * time.Second
+	stderr := &tailBuffer{limit: stderrLimit}
+	cmd.Stderr = stderr
+
+	var consume func()
+	if setup != nil {
+		var err error
+		consume, err = setup(cmd)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := cmd.Start()
+	if err != nil {
+		return &CommandError{Op: op, Command: name, Args: args, ExitCode: -1, Err: err}
+	}
+	if consume != nil {
+		consume()
+	}
+	err = cmd.Wait()
+	if err == nil {
+		return nil
+	}
+
+	cmdErr := &CommandError{Op: op, Command: name, Args: args, ExitCode: -1, Stderr: stderr.String(), Err: err}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		cmdErr.ExitCode = exitErr.ExitCode()
+	}
+	if ctx.Err() != nil {
+		cmdErr.Err = ctx.Err()
+	}
+	return cmdErr
+}
+
+// readProgress parses ffmpeg's -progress output until ffmpeg closes it.
+func readProgress(r io.Reader, progress *Progress) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, value, _ := strings.Cut(scanner.Text(), "=")
+		switch key {
+		case "out_time_us":
+			us, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || progress.Duration <= 0 {
+				continue
+			}
+			progress.Report(min(float64(us)/1e6/progress.Duration*100, 100))
+		case "progress":
+			if value == "end" {
+				progress.Report(100)
+			}
+		}
+	}
+	// drain whatever is left so ffmpeg doesn't block on a full pipe
+	io.Copy(io.Discard, r)
+}
+
+// tailBuffer keeps the last limit bytes written to it.
+type tailBuffer struct {
+	buf   []byte
+	limit int
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > t.limit {
+		t.buf = t.buf[len(t.buf)-t.limit:]
+	}
+	return len(p), nil
+}
+
+func (t *tailBuffer) String() string {
+	return string(t.buf)
+}
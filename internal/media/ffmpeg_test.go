@@ -0,0 +1,105 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCommandErrorMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		err  *CommandError
+		want string
+	}{
+		{
+			"timed out",
+			&CommandError{Op: OpTranscode, Command: "ffmpeg", ExitCode: -1, Err: context.DeadlineExceeded},
+			"ffmpeg transcode failed: timed out",
+		},
+		{
+			"canceled",
+			&CommandError{Op: OpProbe, Command: "ffprobe", ExitCode: -1, Err: context.Canceled},
+			"ffprobe probe failed: canceled",
+		},
+		{
+			"exit code with stderr",
+			&CommandError{Op: OpRemux, Command: "ffmpeg", ExitCode: 1, Stderr: "first\nInvalid data found\n", Err: errors.New("exit status 1")},
+			"ffmpeg remux failed with exit code 1: Invalid data found",
+		},
+		{
+			"not started",
+			&CommandError{Op: OpFrames, Command: "ffmpeg", ExitCode: -1, Err: exec.ErrNotFound},
+			"ffmpeg frames failed: " + exec.ErrNotFound.Error(),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.err.Error(); got != tt.want {
+				t.Errorf("Error() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRunErrors checks how the ways a command can fail end up in its
+// CommandError, using sh in place of ffmpeg.
+func TestRunErrors(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh isn't installed")
+	}
+
+	tests := []struct {
+		name         string
+		command      string
+		script       string
+		timeout      time.Duration
+		cancelAfter  time.Duration
+		wantErr      error
+		wantExitCode int
+		wantStderr   string
+	}{
+		{name: "timed out", command: "sh", script: "exec sleep 10", timeout: 50 * time.Millisecond, wantErr: context.DeadlineExceeded, wantExitCode: -1},
+		{name: "canceled", command: "sh", script: "exec sleep 10", cancelAfter: 50 * time.Millisecond, wantErr: context.Canceled, wantExitCode: -1},
+		{name: "exit code", command: "sh", script: "echo 'Invalid data found' >&2; exit 3", wantExitCode: 3, wantStderr: "Invalid data found"},
+		{name: "missing binary", command: "tubely-no-such-ffmpeg", wantErr: exec.ErrNotFound, wantExitCode: -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &FFmpeg{timeouts: Timeouts{OpTranscode: tt.timeout}}
+			ctx := context.Background()
+			if tt.cancelAfter > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithCancel(ctx)
+				defer cancel()
+				time.AfterFunc(tt.cancelAfter, cancel)
+			}
+
+			start := time.Now()
+			err := f.run(ctx, OpTranscode, tt.command, []string{"-c", tt.script}, nil)
+			if elapsed := time.Since(start); elapsed > 3*time.Second {
+				t.Errorf("command wasn't stopped, ran for %s", elapsed)
+			}
+
+			var cmdErr *CommandError
+			if !errors.As(err, &cmdErr) {
+				t.Fatalf("run = %v, want a CommandError", err)
+			}
+			if cmdErr.Op != OpTranscode || cmdErr.Command != tt.command {
+				t.Errorf("CommandError is for %s %s, want %s %s", cmdErr.Command, cmdErr.Op, tt.command, OpTranscode)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("run = %v, want it to wrap %v", err, tt.wantErr)
+			}
+			if cmdErr.ExitCode != tt.wantExitCode {
+				t.Errorf("ExitCode = %d, want %d", cmdErr.ExitCode, tt.wantExitCode)
+			}
+			if !strings.Contains(cmdErr.Stderr, tt.wantStderr) {
+				t.Errorf("Stderr = %q, want it to contain %q", cmdErr.Stderr, tt.wantStderr)
+			}
+		})
+	}
+}
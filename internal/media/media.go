@@ -0,0 +1,89 @@
+package media
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Operation names a kind of ffmpeg/ffprobe work. Each operation has its own
+// timeout.
+type Operation string
+
+const (
+	OpProbe     Operation = "probe"
+	OpRemux     Operation = "remux"
+	OpTranscode Operation = "transcode"
+	OpPackage   Operation = "package"
+	OpFrames    Operation = "frames"
+)
+
+var operations = []Operation{OpProbe, OpRemux, OpTranscode, OpPackage, OpFrames}
+
+// Processor runs ffmpeg and ffprobe. Commands are killed when ctx is done
+// or the operation's timeout passes.
+type Processor interface {
+	// Probe returns the container and stream metadata of a file.
+	Probe(ctx context.Context, path string) (Metadata, error)
+	// Run runs ffmpeg with args. If progress isn't nil, it's called with
+	// the percentage of the input that has been processed so far.
+	Run(ctx context.Context, op Operation, args []string, progress *Progress) error
+}
+
+// Progress reports how far ffmpeg has got through an input of Duration
+// seconds.
+type Progress struct {
+	Duration float64
+	Report   func(percent float64)
+}
+
+// Timeouts limits how long each operation may run. Operations without an
+// entry, or with a zero duration, only stop when their context is done.
+type Timeouts map[Operation]time.Duration
+
+func DefaultTimeouts() Timeouts {
+	return Timeouts{
+		OpProbe:     time.Minute,
+		OpRemux:     15 * time.Minute,
+		OpTranscode: 2 * time.Hour,
+		OpPackage:   30 * time.Minute,
+		OpFrames:    15 * time.Minute,
+	}
+}
+
+// ParseTimeouts reads a comma-separated list of operation=duration pairs,
+// e.g. "probe=30s,transcode=3h", on top of the default timeouts.
+func ParseTimeouts(value string) (Timeouts, error) {
+	timeouts := DefaultTimeouts()
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return timeouts, nil
+	}
+
+	for _, pair := range strings.Split(value, ",") {
+		name, durationValue, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("expected operation=duration, got %q", pair)
+		}
+		op := Operation(strings.TrimSpace(name))
+		if !isOperation(op) {
+			return nil, fmt.Errorf("unknown operation %q", name)
+		}
+		duration, err := time.ParseDuration(strings.TrimSpace(durationValue))
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout for %s: %w", op, err)
+		}
+		timeouts[op] = duration
+	}
+	return timeouts, nil
+}
+
+func isOperation(op Operation) bool {
+	for _, known := range operations {
+		if op == known {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package media
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimeouts(t *testing.T) {
+	withDefaults := func(overrides Timeouts) Timeouts {
+		timeouts := DefaultTimeouts()
+		for op, timeout := range overrides {
+			timeouts[op] = timeout
+		}
+		return timeouts
+	}
+
+	tests := []struct {
+		name    string
+		value   string
+		want    Timeouts
+		wantErr bool
+	}{
+		{"empty", "", DefaultTimeouts(), false},
+		{"blank", "   ", DefaultTimeouts(), false},
+		{"one operation", "probe=30s", withDefaults(Timeouts{OpProbe: 30 * time.Second}), false},
+		{"several operations", "probe=30s,transcode=3h", withDefaults(Timeouts{OpProbe: 30 * time.Second, OpTranscode: 3 * time.Hour}), false},
+		{"spaces", " remux = 1m , frames=2m ", withDefaults(Timeouts{OpRemux: time.Minute, OpFrames: 2 * time.Minute}), false},
+		{"disabled", "package=0", withDefaults(Timeouts{OpPackage: 0}), false},
+		{"later wins", "probe=1s,probe=2s", withDefaults(Timeouts{OpProbe: 2 * time.Second}), false},
+		{"unknown operation", "encode=1m", nil, true},
+		{"missing duration", "probe", nil, true},
+		{"invalid duration", "probe=soon", nil, true},
+		{"trailing comma", "probe=1s,", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseTimeouts(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseTimeouts(%q) = %v, want an error", tt.value, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseTimeouts(%q): %v", tt.value, err)
+			}
+			if len(got) != len(tt.want) {
+				t.Errorf("ParseTimeouts(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+			for op, want := range tt.want {
+				if got[op] != want {
+					t.Errorf("ParseTimeouts(%q)[%s] = %s, want %s", tt.value, op, got[op], want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package media
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Metadata is the subset of ffprobe's -show_format -show_streams output
+// the pipeline uses.
+type Metadata struct {
+	Streams []Stream `json:"streams"`
+	Format  Format   `json:"format"`
+}
+
+type Format struct {
+	FormatName string `json:"format_name"`
+	Duration   string `json:"duration"`
+	Size       string `json:"size"`
+	BitRate    string `json:"bit_rate"`
+}
+
+type Stream struct {
+	CodecType    string `json:"codec_type"`
+	CodecName    string `json:"codec_name"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+	BitRate      string `json:"bit_rate"`
+	AvgFrameRate string `json:"avg_frame_rate"`
+	RFrameRate   string `json:"r_frame_rate"`
+	Channels     int    `json:"channels"`
+	Tags         struct {
+		Rotate string `json:"rotate"`
+	} `json:"tags"`
+	SideDataList []struct {
+		Rotation float64 `json:"rotation"`
+	} `json:"side_data_list"`
+}
+
+func (m Metadata) HasAudio() bool {
+	_, ok := m.AudioStream()
+	return ok
+}
+
+func (m Metadata) AudioStream() (Stream, bool) {
+	for _, stream := range m.Streams {
+		if stream.CodecType == "audio" {
+			return stream, true
+		}
+	}
+	return Stream{}, false
+}
+
+// VideoStream returns the first video stream, which isn't necessarily the
+// first stream in the file.
+func (m Metadata) VideoStream() (Stream, bool) {
+	for _, stream := range m.Streams {
+		if stream.CodecType == "video" {
+			return stream, true
+		}
+	}
+	return Stream{}, false
+}
+
+// Duration is the length of the file in seconds, or 0 if ffprobe couldn't
+// tell.
+func (m Metadata) Duration() float64 {
+	duration, err := strconv.ParseFloat(m.Format.Duration, 64)
+	if err != nil {
+		return 0
+	}
+	return duration
+}
+
+// FrameRate parses ffprobe's fractional frame rate, e.g. "30000/1001".
+func (s Stream) FrameRate() *float64 {
+	for _, rate := range []string{s.AvgFrameRate, s.RFrameRate} {
+		num, den, ok := strings.Cut(rate, "/")
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseFloat(num, 64)
+		if err != nil {
+			continue
+		}
+		d, err := strconv.ParseFloat(den, 64)
+		if err != nil || d == 0 || n == 0 {
+			continue
+		}
+		fps := math.Round(n/d*1000) / 1000
+		return &fps
+	}
+	return nil
+}
+
+// Rotation is how many degrees clockwise the video has to be rotated for
+// display, normalized to 0, 90, 180 or 270. Newer ffprobe versions report
+// it in the display matrix side data, older ones in the rotate tag.
+func (s Stream) Rotation() int {
+	degrees := 0
+	if rotate, err := strconv.Atoi(s.Tags.Rotate); err == nil {
+		degrees = rotate
+	}
+	for _, sideData := range s.SideDataList {
+		if sideData.Rotation != 0 {
+			// the display matrix rotates counterclockwise
+			degrees = -int(math.Round(sideData.Rotation))
+		}
+	}
+	return (degrees%360 + 360) % 360
+}
+
+// DisplaySize is the size the video is shown at, which has width and
+// height swapped when it's rotated by 90 degrees. ffmpeg applies the
+// rotation before any filters, so scaling works on this size too.
+func (s Stream) DisplaySize() (int, int) {
+	if rotation := s.Rotation(); rotation == 90 || rotation == 270 {
+		return s.Height, s.Width
+	}
+	return s.Width, s.Height
+}
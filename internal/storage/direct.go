@@ -0,0 +1,30 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+type CompletedPart struct {
+	PartNumber int32  `json:"part_number"`
+	ETag       string `json:"etag"`
+}
+
+// MultipartUpload is a multipart upload that was started and hasn't been
+// completed or aborted yet. Its parts are stored, and billed, until then.
+type MultipartUpload struct {
+	Key       string
+	UploadID  string
+	Initiated time.Time
+}
+
+// DirectUploader is implemented by stores that clients can upload to
+// directly with presigned URLs, bypassing the API server.
+type DirectUploader interface {
+	PresignPut(ctx context.Context, key, contentType string, expires time.Duration) (string, error)
+	CreateMultipartUpload(ctx context.Context, key, contentType string) (string, error)
+	PresignUploadPart(ctx context.Context, key, uploadID string, partNumber int32, expires time.Duration) (string, error)
+	CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []CompletedPart) error
+	AbortMultipartUpload(ctx context.Context, key, uploadID string) error
+	ListMultipartUploads(ctx context.Context, prefix string) ([]MultipartUpload, error)
+}
@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// NewHandler serves objects from a store over HTTP, for backends that
+// have no public endpoint of their own (local disk, memory).
+func NewHandler(store ObjectStore) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		key := strings.TrimPrefix(r.URL.Path, "/")
+		body, info, err := store.Get(r.Context(), key)
+		if errors.Is(err, ErrNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, "could not read object", http.StatusInternalServerError)
+			return
+		}
+		defer body.Close()
+
+		if info.ContentType != "" {
+			w.Header().Set("Content-Type", info.ContentType)
+		}
+		if rs, ok := body.(io.ReadSeeker); ok {
+			http.ServeContent(w, r, key, info.LastModified, rs)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+		if r.Method == http.MethodHead {
+			return
+		}
+		io.Copy(w, body)
+	})
+}
@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"strings"
+)
+
+// PrefixStore keeps its objects under a prefix of another store, so
+// several kinds of object can share one bucket. Keys passed in and
+// returned are relative to the prefix.
+type PrefixStore struct {
+	store  ObjectStore
+	prefix string
+}
+
+func NewPrefixStore(store ObjectStore, prefix string) *PrefixStore {
+	return &PrefixStore{
+		store:  store,
+		prefix: strings.TrimSuffix(prefix, "/") + "/",
+	}
+}
+
+// Key is the key the object has in the underlying store.
+func (s *PrefixStore) Key(key string) string {
+	return s.prefix + key
+}
+
+func (s *PrefixStore) Put(ctx context.Context, key string, body io.Reader, contentType string) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	return s.store.Put(ctx, s.Key(key), body, contentType)
+}
+
+func (s *PrefixStore) Get(ctx context.Context, key string) (io.ReadCloser, ObjectInfo, error) {
+	body, info, err := s.store.Get(ctx, s.Key(key))
+	info.Key = strings.TrimPrefix(info.Key, s.prefix)
+	return body, info, err
+}
+
+func (s *PrefixStore) Delete(ctx context.Context, key string) error {
+	return s.store.Delete(ctx, s.Key(key))
+}
+
+func (s *PrefixStore) Head(ctx context.Context, key string) (ObjectInfo, error) {
+	info, err := s.store.Head(ctx, s.Key(key))
+	info.Key = strings.TrimPrefix(info.Key, s.prefix)
+	return info, err
+}
+
+func (s *PrefixStore) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	objects, err := s.store.List(ctx, s.Key(prefix))
+	if err != nil {
+		return nil, err
+	}
+	for i := range objects {
+		objects[i].Key = strings.TrimPrefix(objects[i].Key, s.prefix)
+	}
+	return objects, nil
+}
+
+func (s *PrefixStore) URL(key string) string {
+	return s.store.URL(s.Key(key))
+}
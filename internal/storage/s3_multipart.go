@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const (
+	minPartSize  = 5 << 20
+	maxPartCount = 10000
+)
+
+type MultipartOptions struct {
+	// Threshold is the object size from which Put switches to a multipart
+	// upload. Zero disables multipart uploads.
+	Threshold   int64
+	PartSize    int64
+	Concurrency int
+	MaxRetries  int
+}
+
+func DefaultMultipartOptions() MultipartOptions {
+	return MultipartOptions{
+		Threshold:   100 << 20,
+		PartSize:    16 << 20,
+		Concurrency: 4,
+		MaxRetries:  3,
+	}
+}
+
+// sizedReaderAt returns a ReaderAt over the unread part of body and its
+// size, if body supports random access.
+func sizedReaderAt(body io.Reader) (io.ReaderAt, int64, bool) {
+	ra, ok := body.(io.ReaderAt)
+	if !ok {
+		return nil, 0, false
+	}
+	seeker, ok := body.(io.Seeker)
+	if !ok {
+		return nil, 0, false
+	}
+	cur, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, 0, false
+	}
+	end, err := seeker.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, 0, false
+	}
+	_, err = seeker.Seek(cur, io.SeekStart)
+	if err != nil {
+		return nil, 0, false
+	}
+	return io.NewSectionReader(ra, cur, end-cur), end - cur, true
+}
+
+func (s *S3Store) partSize(size int64) int64 {
+	partSize := max(s.multipart.PartSize, minPartSize)
+	for (size+partSize-1)/partSize > maxPartCount {
+		partSize *= 2
+	}
+	return partSize
+}
+
+// putMultipart uploads body in parts, several at a time. If any part
+// can't be uploaded the multipart upload is aborted so no incomplete
+// parts are left behind in the bucket.
+func (s *S3Store) putMultipart(ctx context.Context, key string, body io.ReaderAt, size int64, contentType string) (err error) {
+	uploadID, err := s.CreateMultipartUpload(ctx, key, contentType)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err == nil {
+			return
+		}
+		abortErr := s.AbortMultipartUpload(context.WithoutCancel(ctx), key, uploadID)
+		if abortErr != nil {
+			err = errors.Join(err, fmt.Errorf("couldn't abort multipart upload: %w", abortErr))
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	partSize := s.partSize(size)
+	partCount := int32((size + partSize - 1) / partSize)
+	parts := make([]CompletedPart, partCount)
+
+	var (
+		wg       sync.WaitGroup
+		errMu    sync.Mutex
+		firstErr error
+	)
+	partNumbers := make(chan int32)
+	for range max(s.multipart.Concurrency, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for partNumber := range partNumbers {
+				offset := int64(partNumber-1) * partSize
+				section := io.NewSectionReader(body, offset, min(partSize, size-offset))
+				etag, err := s.uploadPart(ctx, key, uploadID, partNumber, section)
+				if err != nil {
+					errMu.Lock()
+					if firstErr == nil {
+						firstErr = fmt.Errorf("part %d: %w", partNumber, err)
+					}
+					errMu.Unlock()
+					cancel()
+					continue
+				}
+				parts[partNumber-1] = CompletedPart{PartNumber: partNumber, ETag: etag}
+			}
+		}()
+	}
+
+feed:
+	for partNumber := int32(1); partNumber <= partCount; partNumber++ {
+		select {
+		case partNumbers <- partNumber:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(partNumbers)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return s.CompleteMultipartUpload(ctx, key, uploadID, parts)
+}
+
+func (s *S3Store) uploadPart(ctx context.Context, key, uploadID string, partNumber int32, section *io.SectionReader) (string, error) {
+	var err error
+	backoff := 500 * time.Millisecond
+	for attempt := 0; attempt <= s.multipart.MaxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return "", ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+
+		_, err = section.Seek(0, io.SeekStart)
+		if err != nil {
+			return "", err
+		}
+		var out *s3.UploadPartOutput
+		out, err = s.client.UploadPart(ctx, &s3.UploadPartInput{
+			Bucket:     aws.String(s.bucket),
+			Key:        aws.String(key),
+			UploadId:   aws.String(uploadID),
+			PartNumber: aws.Int32(partNumber),
+			Body:       section,
+		})
+		if err == nil {
+			return aws.ToString(out.ETag), nil
+		}
+		if ctx.Err() != nil {
+			return "", err
+		}
+	}
+	return "", err
+}
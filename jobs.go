@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/google/uuid"
+)
+
+var errVideoDeleted = errors.New("video was deleted")
+
+const (
+	jobPollInterval = 5 * time.Second
+	// a worker renews its lease on a job well before it runs out, so a
+	// few failed renewals in a row are needed to lose it
+	jobLeaseDuration      = time.Minute
+	jobLeaseRenewInterval = jobLeaseDuration / 4
+	// a job whose lease keeps running out is likely taking its server
+	// down with it, so it's failed rather than claimed again
+	jobMaxAttempts = 3
+)
+
+// newJobWorkerID names this server as the owner of the jobs it claims.
+func newJobWorkerID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "tubely"
+	}
+	return hostname + "-" + uuid.NewString()[:8]
+}
+
+// enqueueVideoJob queues an uploaded video for processing and marks the
+// video as queued.
+func (cfg *apiConfig) enqueueVideoJob(ctx context.Context, video database.Video, params database.CreateJobParams) (database.Job, error) {
+	job, err := cfg.db.CreateJob(ctx, params)
+	if err != nil {
+		return database.Job{}, err
+	}
+
+	err = cfg.db.SetVideoProcessingStatus(ctx, video.ID, database.StatusQueued, nil)
+	if err != nil {
+		return database.Job{}, err
+	}
+
+	cfg.progress.publish(video.ID, progressEvent{Stage: progressStageQueued, JobID: &job.ID})
+
+	select {
+	case cfg.jobWake <- struct{}{}:
+	default:
+	}
+	return job, nil
+}
+
+// createSpoolFile creates a file in the spool directory, where uploads are
+// received and jobs download their source to.
+func (cfg *apiConfig) createSpoolFile(pattern string) (*os.File, error) {
+	return os.CreateTemp(cfg.jobSpoolDir, pattern)
+}
+
+// createSpoolDir creates a working directory in the spool directory, for
+// the renditions and frames a job generates, so they go on the same disk
+// as the uploads rather than in the system's temporary directory.
+func (cfg *apiConfig) createSpoolDir(pattern string) (string, error) {
+	return os.MkdirTemp(cfg.jobSpoolDir, pattern)
+}
+
+// stageJobSource stores a received upload in video storage, where any
+// server's workers can get it.
+func (cfg *apiConfig) stageJobSource(ctx context.Context, videoID uuid.UUID, path, mediaType string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	key := generateDirectUploadKey(videoID, videoContainers[mediaType].ext)
+	err = cfg.videoStorage.Put(ctx, key, f, mediaType)
+	if err != nil {
+		return "", fmt.Errorf("couldn't stage upload: %w", err)
+	}
+	return key, nil
+}
+
+// startJobWorkers claims queued jobs one at a time and hands them to a pool
+// of workers. Jobs whose lease ran out, because the server processing
+// them stopped, are queued again.
+func (cfg *apiConfig) startJobWorkers(ctx context.Context, workers int) error {
+	err := cfg.requeueExpiredJobs(ctx)
+	if err != nil {
+		return err
+	}
+
+	jobs := make(chan database.Job)
+	for range max(workers, 1) {
+		go func() {
+			for job := range jobs {
+				cfg.runJob(ctx, job)
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		ticker := time.NewTicker(jobPollInterval)
+		defer ticker.Stop()
+		for {
+			job, err := cfg.db.ClaimNextJob(ctx, cfg.jobWorkerID, jobLeaseDuration)
+			if err != nil {
+				log.Printf("Couldn't claim processing job: %v", err)
+			}
+			if job != nil {
+				select {
+				case jobs <- *job:
+				case <-ctx.Done():
+					return
+				}
+				continue
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-cfg.jobWake:
+			case <-ticker.C:
+				if err := cfg.requeueExpiredJobs(ctx); err != nil {
+					log.Printf("Couldn't requeue expired processing jobs: %v", err)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+func (cfg *apiConfig) requeueExpiredJobs(ctx context.Context) error {
+	errMsg := fmt.Sprintf("processing stopped without finishing %d times", jobMaxAttempts)
+	failed, err := cfg.db.FailExhaustedJobs(ctx, jobMaxAttempts, errMsg)
+	if err != nil {
+		return err
+	}
+	for _, job := range failed {
+		log.Printf("Failed job %s for video %s after %d attempts", job.ID, job.VideoID, job.Attempts)
+		cfg.setVideoProcessingStatus(ctx, job, database.StatusFailed, &errMsg)
+		cfg.progress.publish(job.VideoID, progressEvent{Stage: progressStageFailed, JobID: &job.ID, Error: errMsg})
+		cfg.deleteJobSource(ctx, job)
+	}
+
+	requeued, err := cfg.db.RequeueExpiredJobs(ctx, jobMaxAttempts)
+	if err != nil {
+		return err
+	}
+	if requeued > 0 {
+		log.Printf("Requeued %d processing jobs whose lease expired", requeued)
+	}
+	return nil
+}
+
+// keepJobLease renews the lease on a job until stop is called. If the
+// lease is lost the job's context is canceled, since another server may
+// be processing it by then.
+func (cfg *apiConfig) keepJobLease(ctx context.Context, job database.Job) (jobCtx context.Context, stop func() (lost bool)) {
+	jobCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	lost := make(chan bool, 1)
+
+	go func() {
+		ticker := time.NewTicker(jobLeaseRenewInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				lost <- false
+				return
+			case <-ticker.C:
+			}
+			err := cfg.db.RenewJobLease(ctx, job.ID, cfg.jobWorkerID, jobLeaseDuration)
+			if errors.Is(err, database.ErrLeaseLost) {
+				log.Printf("Lost the lease on job %s, stopping it", job.ID)
+				cancel()
+				<-done
+				lost <- true
+				return
+			}
+			if err != nil {
+				log.Printf("Couldn't renew the lease on job %s: %v", job.ID, err)
+			}
+		}
+	}()
+
+	return jobCtx, func() bool {
+		close(done)
+		defer cancel()
+		return <-lost
+	}
+}
+
+func (cfg *apiConfig) runJob(ctx context.Context, job database.Job) {
+	start := time.Now()
+	jobCtx, stopLease := cfg.keepJobLease(ctx, job)
+	err := cfg.processJob(jobCtx, job)
+	if stopLease() {
+		// the job is someone else's now, including its source
+		log.Printf("Abandoned job %s for video %s after %s", job.ID, job.VideoID, time.Since(start).Round(time.Millisecond))
+		return
+	}
+
+	if err != nil {
+		log.Printf("Processing job %s for video %s failed after %s: %v", job.ID, job.VideoID, time.Since(start).Round(time.Millisecond), err)
+		errMsg := err.Error()
+		err = cfg.db.FinishJob(ctx, job.ID, cfg.jobWorkerID, database.StatusFailed, &errMsg)
+		if errors.Is(err, database.ErrLeaseLost) {
+			log.Printf("Job %s was requeued before it could be marked as failed", job.ID)
+			return
+		}
+		if err != nil {
+			log.Printf("Couldn't mark job %s as failed: %v", job.ID, err)
+		}
+		cfg.setVideoProcessingStatus(ctx, job, database.StatusFailed, &errMsg)
+		cfg.progress.publish(job.VideoID, progressEvent{Stage: progressStageFailed, JobID: &job.ID, Error: errMsg})
+	} else {
+		log.Printf("Processing job %s for video %s finished in %s", job.ID, job.VideoID, time.Since(start).Round(time.Millisecond))
+		err = cfg.db.FinishJob(ctx, job.ID, cfg.jobWorkerID, database.StatusReady, nil)
+		if err != nil {
+			log.Printf("Couldn't mark job %s as ready: %v", job.ID, err)
+		}
+		cfg.progress.publish(job.VideoID, progressEvent{Stage: progressStageReady, JobID: &job.ID, Percent: 100})
+	}
+
+	cfg.deleteJobSource(ctx, job)
+}
+
+func (cfg *apiConfig) processJob(ctx context.Context, job database.Job) error {
+	video := cfg.setVideoProcessingStatus(ctx, job, database.StatusProcessing, nil)
+	if video == nil {
+		return fmt.Errorf("video %s not found", job.VideoID)
+	}
+
+	sourcePath := job.SourcePath
+	if sourcePath == "" {
+		downloaded, err := cfg.downloadJobSource(ctx, job)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(downloaded)
+		sourcePath = downloaded
+	}
+
+	_, err := cfg.processVideoUpload(ctx, *video, sourcePath, job.MediaType, job.Size, func(event progressEvent) {
+		event.JobID = &job.ID
+		cfg.progress.publish(job.VideoID, event)
+	})
+	if err != nil {
+		return err
+	}
+	return cfg.db.SetVideoProcessingStatus(ctx, video.ID, database.StatusReady, nil)
+}
+
+// deleteJobSource deletes the upload a job was queued with, once no
+// worker will process it any more.
+func (cfg *apiConfig) deleteJobSource(ctx context.Context, job database.Job) {
+	if job.SourcePath != "" {
+		os.Remove(job.SourcePath)
+	}
+	if job.SourceKey != "" {
+		cfg.deleteObject(ctx, storageNameVideo, job.SourceKey)
+	}
+}
+
+// checkVideoExists returns errVideoDeleted if the video was deleted while
+// its job was processing, so the job stops instead of storing outputs
+// nothing refers to.
+func (cfg *apiConfig) checkVideoExists(ctx context.Context, videoID uuid.UUID) error {
+	_, err := cfg.db.GetVideo(ctx, videoID)
+	if errors.Is(err, database.ErrNotFound) {
+		return errVideoDeleted
+	}
+	return err
+}
+
+// downloadJobSource copies a directly uploaded object into the spool
+// directory so it can go through the processing pipeline.
+func (cfg *apiConfig) downloadJobSource(ctx context.Context, job database.Job) (string, error) {
+	body, _, err := cfg.videoStorage.Get(ctx, job.SourceKey)
+	if err != nil {
+		return "", fmt.Errorf("couldn't download uploaded object: %w", err)
+	}
+	defer body.Close()
+
+	spoolFile, err := cfg.createSpoolFile(filepath.Base(job.SourceKey) + "-*")
+	if err != nil {
+		return "", err
+	}
+	defer spoolFile.Close()
+
+	_, err = io.Copy(spoolFile, body)
+	if err != nil {
+		os.Remove(spoolFile.Name())
+		return "", fmt.Errorf("couldn't download uploaded object: %w", err)
+	}
+	return spoolFile.Name(), nil
+}
+
+// setVideoProcessingStatus updates the job's video and returns it, or nil
+// if the video no longer exists.
+func (cfg *apiConfig) setVideoProcessingStatus(ctx context.Context, job database.Job, status string, errMsg *string) *database.Video {
+	err := cfg.db.SetVideoProcessingStatus(ctx, job.VideoID, status, errMsg)
+	if err != nil {
+		log.Printf("Couldn't update processing status of video %s: %v", job.VideoID, err)
+	}
+
+	video, err := cfg.db.GetVideo(ctx, job.VideoID)
+	if errors.Is(err, database.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		log.Printf("Couldn't get video %s for job %s: %v", job.VideoID, job.ID, err)
+		return nil
+	}
+	return &video
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/media"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+)
+
+// uploadAndClaimJob uploads testMP4 through handlerUploadVideo and claims
+// the job it queued, the way a worker would.
+func uploadAndClaimJob(t *testing.T, cfg *apiConfig) (database.Video, database.Job) {
+	t.Helper()
+	user, token := createTestUser(t, cfg, "user@example.com")
+	video := createTestVideo(t, cfg, user.ID)
+
+	w := httptest.NewRecorder()
+	cfg.handlerUploadVideo(w, newVideoUploadRequest(t, video.ID, token, "video/mp4", testMP4()))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("upload status = %d, want %d: %s", w.Code, http.StatusAccepted, w.Body)
+	}
+
+	job, err := cfg.db.ClaimNextJob(context.Background(), cfg.jobWorkerID, jobLeaseDuration)
+	if err != nil || job == nil {
+		t.Fatalf("ClaimNextJob = %v, %v", job, err)
+	}
+	return video, *job
+}
+
+func readTestObject(t *testing.T, store storage.ObjectStore, key string) string {
+	t.Helper()
+	body, _, err := store.Get(context.Background(), key)
+	if err != nil {
+		t.Fatalf("object %s: %v", key, err)
+	}
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// checkHLSPlaylist checks every playlist and segment a playlist refers to
+// was stored, following the master playlist into the media playlists.
+func checkHLSPlaylist(t *testing.T, store storage.ObjectStore, key string) {
+	t.Helper()
+	for _, line := range strings.Split(readTestObject(t, store, key), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		ref := path.Join(path.Dir(key), line)
+		if path.Ext(ref) == ".m3u8" {
+			checkHLSPlaylist(t, store, ref)
+			continue
+		}
+		if _, err := store.Head(context.Background(), ref); err != nil {
+			t.Errorf("%s refers to %s, which wasn't stored: %v", key, line, err)
+		}
+	}
+}
+
+func TestRunJobProcessesUpload(t *testing.T) {
+	cfg, db, fake := newTestConfig(t)
+	cfg.streamingFormats = []string{streamingFormatHLS, streamingFormatDASH}
+	video, job := uploadAndClaimJob(t, cfg)
+	ctx := context.Background()
+
+	cfg.runJob(ctx, job)
+
+	finished, err := db.GetJob(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("GetJob: %v", err)
+	}
+	if finished.Status != database.StatusReady {
+		t.Fatalf("job status = %s, want ready: %v", finished.Status, finished.Error)
+	}
+
+	processed, err := db.GetVideo(ctx, video.ID)
+	if err != nil {
+		t.Fatalf("GetVideo: %v", err)
+	}
+	if processed.ProcessingStatus == nil || *processed.ProcessingStatus != database.StatusReady {
+		t.Errorf("video processing status = %v, want ready", processed.ProcessingStatus)
+	}
+	if processed.VideoKey == nil || !strings.HasPrefix(*processed.VideoKey, aspectRatio16x9.keyPrefix()+"/") {
+		t.Fatalf("video key = %v, want a 16:9 video", processed.VideoKey)
+	}
+	if _, err := cfg.videoStorage.Head(ctx, *processed.VideoKey); err != nil {
+		t.Errorf("processed video wasn't stored: %v", err)
+	}
+
+	if processed.HLSKey == nil {
+		t.Fatal("video has no HLS playlist")
+	}
+	checkHLSPlaylist(t, cfg.videoStorage, *processed.HLSKey)
+	master := readTestObject(t, cfg.videoStorage, *processed.HLSKey)
+	if !strings.Contains(master, `RESOLUTION=1920x1080,CODECS="avc1.4D4028,mp4a.40.2"`) {
+		t.Errorf("master playlist doesn't declare the 1080p rendition's codecs:\n%s", master)
+	}
+
+	if processed.DASHKey == nil {
+		t.Fatal("video has no DASH manifest")
+	}
+	mpd := readTestObject(t, cfg.videoStorage, *processed.DASHKey)
+	for _, match := range dashURLAttribute.FindAllStringSubmatch(mpd, -1) {
+		ref := path.Join(path.Dir(*processed.DASHKey), match[1])
+		if _, err := cfg.videoStorage.Head(ctx, ref); err != nil {
+			t.Errorf("DASH manifest refers to %s, which wasn't stored: %v", match[1], err)
+		}
+	}
+
+	if processed.PreviewVTTKey == nil {
+		t.Fatal("video has no preview track")
+	}
+	if _, err := cfg.videoStorage.Head(ctx, path.Join(path.Dir(*processed.PreviewVTTKey), "sprite-000.jpg")); err != nil {
+		t.Errorf("preview sprite wasn't stored: %v", err)
+	}
+
+	candidates, err := db.GetThumbnailCandidates(ctx, video.ID)
+	if err != nil {
+		t.Fatalf("GetThumbnailCandidates: %v", err)
+	}
+	if len(candidates) == 0 || processed.ThumbnailKey == nil {
+		t.Errorf("%d thumbnail candidates and thumbnail %v, want a default thumbnail picked from candidates", len(candidates), processed.ThumbnailKey)
+	}
+
+	if _, err := cfg.videoStorage.Head(ctx, job.SourceKey); err == nil {
+		t.Errorf("staged source %s wasn't deleted", job.SourceKey)
+	}
+
+	ops := map[media.Operation]bool{}
+	for _, call := range fake.Calls() {
+		ops[call.Op] = true
+		// intermediate files are written in the spool directory
+		if call.Op != media.OpProbe && !strings.HasPrefix(call.Args[len(call.Args)-1], cfg.jobSpoolDir+string(filepath.Separator)) {
+			t.Errorf("%s wrote %s outside the spool directory", call.Op, call.Args[len(call.Args)-1])
+		}
+	}
+	spooled, _ := os.ReadDir(cfg.jobSpoolDir)
+	if len(spooled) != 0 {
+		t.Errorf("spool directory still has %d entries", len(spooled))
+	}
+	for _, op := range []media.Operation{media.OpProbe, media.OpRemux, media.OpTranscode, media.OpPackage, media.OpFrames} {
+		if !ops[op] {
+			t.Errorf("no %s operation was run", op)
+		}
+	}
+}
+
+func TestRunJobFailure(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		wantError string
+	}{
+		{"timed out", &media.CommandError{Op: media.OpRemux, Command: "ffmpeg", ExitCode: -1, Err: context.DeadlineExceeded}, "timed out"},
+		{"ffmpeg failed", &media.CommandError{Op: media.OpRemux, Command: "ffmpeg", ExitCode: 1, Stderr: "Invalid data found", Err: errors.New("exit status 1")}, "Invalid data found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, db, fake := newTestConfig(t)
+			video, job := uploadAndClaimJob(t, cfg)
+			fake.RunErr = tt.err
+			ctx := context.Background()
+
+			cfg.runJob(ctx, job)
+
+			failed, err := db.GetJob(ctx, job.ID)
+			if err != nil {
+				t.Fatalf("GetJob: %v", err)
+			}
+			if failed.Status != database.StatusFailed || failed.Error == nil || !strings.Contains(*failed.Error, tt.wantError) {
+				t.Errorf("job = %s, %v, want it failed with %q", failed.Status, failed.Error, tt.wantError)
+			}
+			updated, err := db.GetVideo(ctx, video.ID)
+			if err != nil {
+				t.Fatalf("GetVideo: %v", err)
+			}
+			if updated.ProcessingStatus == nil || *updated.ProcessingStatus != database.StatusFailed || updated.VideoKey != nil {
+				t.Errorf("video = %v, %v, want it failed without a video", updated.ProcessingStatus, updated.VideoKey)
+			}
+			if _, err := cfg.videoStorage.Head(ctx, job.SourceKey); err == nil {
+				t.Errorf("staged source %s wasn't deleted", job.SourceKey)
+			}
+		})
+	}
+}
+
+// deletingProcessor deletes the video once op runs, as if its owner
+// deleted it while it was being processed.
+type deletingProcessor struct {
+	*media.Fake
+	op     media.Operation
+	delete func()
+}
+
+func (p deletingProcessor) Run(ctx context.Context, op media.Operation, args []string, progress *media.Progress) error {
+	if op == p.op {
+		p.delete()
+	}
+	return p.Fake.Run(ctx, op, args, progress)
+}
+
+// TestRunJobVideoDeleted checks a job whose video is deleted while it's
+// processing doesn't leave its outputs in storage.
+func TestRunJobVideoDeleted(t *testing.T) {
+	tests := []struct {
+		name string
+		op   media.Operation
+	}{
+		{"before storing", media.OpRemux},
+		{"while storing", media.OpFrames},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, db, fake := newTestConfig(t)
+			video, job := uploadAndClaimJob(t, cfg)
+			ctx := context.Background()
+			cfg.mediaProcessor = deletingProcessor{Fake: fake, op: tt.op, delete: func() {
+				if err := db.DeleteVideo(ctx, video.ID); err != nil {
+					t.Errorf("DeleteVideo: %v", err)
+				}
+			}}
+
+			err := cfg.processJob(ctx, job)
+			if !errors.Is(err, errVideoDeleted) {
+				t.Errorf("processJob = %v, want errVideoDeleted", err)
+			}
+
+			objects, err := cfg.videoStorage.List(ctx, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, obj := range objects {
+				if obj.Key != job.SourceKey {
+					t.Errorf("%s was stored for the deleted video", obj.Key)
+				}
+			}
+		})
+	}
+}
+
+func TestRequeueExpiredJobsFailsExhaustedJob(t *testing.T) {
+	cfg, db, _ := newTestConfig(t)
+	video, job := uploadAndClaimJob(t, cfg)
+	ctx := context.Background()
+
+	// the server processing the job keeps dying before its lease runs out
+	for attempt := 1; attempt <= jobMaxAttempts; attempt++ {
+		if attempt > 1 {
+			claimed, err := db.ClaimNextJob(ctx, cfg.jobWorkerID, -time.Minute)
+			if err != nil || claimed == nil {
+				t.Fatalf("claim %d: ClaimNextJob = %v, %v", attempt, claimed, err)
+			}
+		} else if err := db.RenewJobLease(ctx, job.ID, cfg.jobWorkerID, -time.Minute); err != nil {
+			t.Fatalf("RenewJobLease: %v", err)
+		}
+		if err := cfg.requeueExpiredJobs(ctx); err != nil {
+			t.Fatalf("requeueExpiredJobs: %v", err)
+		}
+	}
+
+	failed, err := db.GetJob(ctx, job.ID)
+	if err != nil {
+		t.Fatalf("GetJob: %v", err)
+	}
+	if failed.Status != database.StatusFailed {
+		t.Errorf("job status = %s after %d attempts, want failed", failed.Status, failed.Attempts)
+	}
+	updated, err := db.GetVideo(ctx, video.ID)
+	if err != nil {
+		t.Fatalf("GetVideo: %v", err)
+	}
+	if updated.ProcessingStatus == nil || *updated.ProcessingStatus != database.StatusFailed || updated.ProcessingError == nil {
+		t.Errorf("video = %v, %v, want it failed", updated.ProcessingStatus, updated.ProcessingError)
+	}
+	if _, err := cfg.videoStorage.Head(ctx, job.SourceKey); err == nil {
+		t.Errorf("staged source %s wasn't deleted", job.SourceKey)
+	}
+}
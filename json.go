@@ -2,14 +2,25 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
 )
 
 func respondWithError(w http.ResponseWriter, code int, msg string, err error) {
 	if err != nil {
 		log.Println(err)
 	}
+	switch {
+	case errors.Is(err, database.ErrCanceled):
+		// the client is gone, nobody is left to read a response
+		log.Printf("Request canceled: %s", msg)
+		return
+	case errors.Is(err, database.ErrTimeout):
+		code, msg = http.StatusServiceUnavailable, "Database is busy, try again later"
+	}
 	if code > 499 {
 		log.Printf("Responding with 5XX error: %s", msg)
 	}
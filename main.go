@@ -5,26 +5,44 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/media"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
 
 	"github.com/joho/godotenv"
-	_ "github.com/lib/pq"
 )
 
 type apiConfig struct {
-	db               database.Client
-	s3Client         *s3.Client
-	jwtSecret        string
-	platform         string
-	filepathRoot     string
-	assetsRoot       string
-	s3Bucket         string
-	s3Region         string
-	s3CfDistribution string
-	port             string
+	db                 database.Store
+	videoStorage       storage.ObjectStore
+	thumbnailStorage   storage.ObjectStore
+	assetStorage       storage.ObjectStore
+	tusUploads         *tusStore
+	mediaProcessor     media.Processor
+	videoURLSigner     storage.URLSigner
+	signedURLExpiry    time.Duration
+	streamingFormats   []string
+	acceptedVideoTypes []string
+	keepOriginals      bool
+	userQuotaBytes     int64
+	jobSpoolDir        string
+	jobWorkerID        string
+	jobWake            chan struct{}
+	progress           *progressHub
+	jwtSecret          string
+	platform           string
+	filepathRoot       string
+	assetsRoot         string
+	s3Bucket           string
+	s3Region           string
+	s3CfDistribution   string
+	port               string
 }
 
 func main() {
@@ -32,14 +50,31 @@ func main() {
 
 	pathToDB := os.Getenv("DB_PATH")
 	if pathToDB == "" {
-		log.Fatal("DB_URL must be set")
+		log.Fatal("DB_PATH must be set")
 	}
 
-	db, err := database.NewClient(pathToDB)
+	dbQueryTimeout := 5 * time.Second
+	if timeout := os.Getenv("DB_QUERY_TIMEOUT"); timeout != "" {
+		parsed, err := time.ParseDuration(timeout)
+		if err != nil {
+			log.Fatalf("Invalid DB_QUERY_TIMEOUT: %v", err)
+		}
+		dbQueryTimeout = parsed
+	}
+
+	db, err := database.NewClient(context.Background(), pathToDB, dbQueryTimeout)
 	if err != nil {
 		log.Fatalf("Couldn't connect to database: %v", err)
 	}
 
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		err = runMigrateCommand(db, os.Args[2:])
+		if err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		return
+	}
+
 	jwtSecret := os.Getenv("JWT_SECRET")
 	if jwtSecret == "" {
 		log.Fatal("JWT_SECRET environment variable is not set")
@@ -60,42 +95,178 @@ func main() {
 		log.Fatal("ASSETS_ROOT environment variable is not set")
 	}
 
-	s3Bucket := os.Getenv("S3_BUCKET")
-	if s3Bucket == "" {
-		log.Fatal("S3_BUCKET environment variable is not set")
+	port := os.Getenv("PORT")
+	if port == "" {
+		log.Fatal("PORT environment variable is not set")
 	}
 
-	s3Region := os.Getenv("S3_REGION")
-	if s3Region == "" {
-		log.Fatal("S3_REGION environment variable is not set")
+	storageBackend := os.Getenv("STORAGE_BACKEND")
+	if storageBackend == "" {
+		storageBackend = storageBackendS3
 	}
 
-	s3CfDistribution := os.Getenv("S3_CF_DISTRO")
-	if s3CfDistribution == "" {
-		log.Fatal("S3_CF_DISTRO environment variable is not set")
+	var s3Bucket, s3Region, s3CfDistribution string
+	var videoStorage storage.ObjectStore
+	switch storageBackend {
+	case storageBackendS3:
+		s3Bucket = os.Getenv("S3_BUCKET")
+		if s3Bucket == "" {
+			log.Fatal("S3_BUCKET environment variable is not set")
+		}
+
+		s3Region = os.Getenv("S3_REGION")
+		if s3Region == "" {
+			log.Fatal("S3_REGION environment variable is not set")
+		}
+
+		s3CfDistribution = os.Getenv("S3_CF_DISTRO")
+		if s3CfDistribution == "" {
+			log.Fatal("S3_CF_DISTRO environment variable is not set")
+		}
+
+		s3Conf, err := config.LoadDefaultConfig(context.Background(), config.WithRegion(s3Region))
+		if err != nil {
+			log.Fatal("Loading deafault S3 config failed")
+		}
+		multipart := storage.DefaultMultipartOptions()
+		multipart.Threshold = getEnvInt64("S3_MULTIPART_THRESHOLD_MB", multipart.Threshold>>20) << 20
+		multipart.PartSize = getEnvInt64("S3_MULTIPART_PART_SIZE_MB", multipart.PartSize>>20) << 20
+		multipart.Concurrency = int(getEnvInt64("S3_MULTIPART_CONCURRENCY", int64(multipart.Concurrency)))
+		videoStorage = storage.NewS3Store(s3.NewFromConfig(s3Conf), s3Bucket, "http://"+s3CfDistribution, multipart)
+	case storageBackendLocal:
+		localStorageRoot := os.Getenv("LOCAL_STORAGE_ROOT")
+		if localStorageRoot == "" {
+			log.Fatal("LOCAL_STORAGE_ROOT environment variable is not set")
+		}
+		videoStorage, err = storage.NewLocalStore(localStorageRoot, objectsBaseURL(port))
+		if err != nil {
+			log.Fatalf("Couldn't create local storage: %v", err)
+		}
+	case storageBackendMemory:
+		videoStorage = storage.NewMemoryStore(objectsBaseURL(port))
+	default:
+		log.Fatalf("Unknown STORAGE_BACKEND %q", storageBackend)
 	}
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		log.Fatal("PORT environment variable is not set")
+	videoURLMode := os.Getenv("VIDEO_URL_MODE")
+	if videoURLMode == "" {
+		videoURLMode = videoURLModePublic
 	}
 
-	s3Conf, err := config.LoadDefaultConfig(context.Background(), config.WithRegion(s3Region))
+	var videoURLSigner storage.URLSigner
+	switch videoURLMode {
+	case videoURLModePublic:
+	case videoURLModePresign:
+		s3Store, ok := videoStorage.(*storage.S3Store)
+		if !ok {
+			log.Fatal("VIDEO_URL_MODE=presign requires STORAGE_BACKEND=s3")
+		}
+		videoURLSigner = s3Store
+	case videoURLModeCloudFront:
+		if storageBackend != storageBackendS3 {
+			log.Fatal("VIDEO_URL_MODE=cloudfront requires STORAGE_BACKEND=s3")
+		}
+		keyPairID := os.Getenv("CLOUDFRONT_KEY_PAIR_ID")
+		if keyPairID == "" {
+			log.Fatal("CLOUDFRONT_KEY_PAIR_ID environment variable is not set")
+		}
+		privateKeyPath := os.Getenv("CLOUDFRONT_PRIVATE_KEY_PATH")
+		if privateKeyPath == "" {
+			log.Fatal("CLOUDFRONT_PRIVATE_KEY_PATH environment variable is not set")
+		}
+		privateKeyPEM, err := os.ReadFile(privateKeyPath)
+		if err != nil {
+			log.Fatalf("Couldn't read CloudFront private key: %v", err)
+		}
+		videoURLSigner, err = storage.NewCloudFrontSigner("http://"+s3CfDistribution, keyPairID, privateKeyPEM)
+		if err != nil {
+			log.Fatalf("Couldn't load CloudFront private key: %v", err)
+		}
+	default:
+		log.Fatalf("Unknown VIDEO_URL_MODE %q", videoURLMode)
+	}
+
+	signedURLExpiry := 15 * time.Minute
+	if expiry := os.Getenv("SIGNED_URL_EXPIRY"); expiry != "" {
+		signedURLExpiry, err = time.ParseDuration(expiry)
+		if err != nil {
+			log.Fatalf("Invalid SIGNED_URL_EXPIRY: %v", err)
+		}
+	}
+
+	streamingFormatsEnv := os.Getenv("STREAMING_FORMATS")
+	if hlsEnabled := os.Getenv("HLS_ENABLED"); hlsEnabled != "" {
+		log.Print("HLS_ENABLED is deprecated, set STREAMING_FORMATS instead")
+		if streamingFormatsEnv == "" && hlsEnabled == "false" {
+			streamingFormatsEnv = "none"
+		}
+	}
+	streamingFormats, err := parseStreamingFormats(streamingFormatsEnv)
 	if err != nil {
-		log.Fatal("Loading deafault S3 config failed")
+		log.Fatalf("Invalid STREAMING_FORMATS: %v", err)
+	}
+
+	mediaTimeouts, err := media.ParseTimeouts(os.Getenv("FFMPEG_TIMEOUTS"))
+	if err != nil {
+		log.Fatalf("Invalid FFMPEG_TIMEOUTS: %v", err)
+	}
+
+	acceptedVideoTypes, err := parseAcceptedVideoTypes(os.Getenv("ACCEPTED_VIDEO_TYPES"))
+	if err != nil {
+		log.Fatalf("Invalid ACCEPTED_VIDEO_TYPES: %v", err)
+	}
+
+	thumbnailStorage := storage.NewPrefixStore(videoStorage, thumbnailsPrefix)
+	// thumbnails uploaded before they were moved to thumbnailStorage are
+	// still in ASSETS_ROOT until migrate-thumbnails copies them over
+	assetStorage, err := storage.NewLocalStore(assetsRoot, "http://localhost:"+port+"/assets")
+	if err != nil {
+		log.Fatalf("Couldn't open assets directory: %v", err)
+	}
+
+	tusUploadDir := os.Getenv("TUS_UPLOAD_DIR")
+	if tusUploadDir == "" {
+		tusUploadDir = filepath.Join(os.TempDir(), "tubely-tus")
+	}
+	tusUploads, err := newTusStore(tusUploadDir)
+	if err != nil {
+		log.Fatalf("Couldn't create tus upload directory: %v", err)
+	}
+
+	jobSpoolDir := os.Getenv("JOB_SPOOL_DIR")
+	if jobSpoolDir == "" {
+		jobSpoolDir = filepath.Join(os.TempDir(), "tubely-jobs")
+	}
+	err = os.MkdirAll(jobSpoolDir, 0755)
+	if err != nil {
+		log.Fatalf("Couldn't create job spool directory: %v", err)
 	}
 
 	cfg := apiConfig{
-		db:               db,
-		s3Client:         s3.NewFromConfig(s3Conf),
-		jwtSecret:        jwtSecret,
-		platform:         platform,
-		filepathRoot:     filepathRoot,
-		assetsRoot:       assetsRoot,
-		s3Bucket:         s3Bucket,
-		s3Region:         s3Region,
-		s3CfDistribution: s3CfDistribution,
-		port:             port,
+		db:                 db,
+		videoStorage:       videoStorage,
+		thumbnailStorage:   thumbnailStorage,
+		assetStorage:       assetStorage,
+		tusUploads:         tusUploads,
+		mediaProcessor:     media.NewFFmpeg(mediaTimeouts),
+		videoURLSigner:     videoURLSigner,
+		signedURLExpiry:    signedURLExpiry,
+		streamingFormats:   streamingFormats,
+		acceptedVideoTypes: acceptedVideoTypes,
+		keepOriginals:      os.Getenv("KEEP_ORIGINALS") == "true",
+		userQuotaBytes:     getEnvInt64("USER_QUOTA_MB", 0) << 20,
+		jobSpoolDir:        jobSpoolDir,
+		jobWorkerID:        newJobWorkerID(),
+		jobWake:            make(chan struct{}, 1),
+		progress:           newProgressHub(),
+		jwtSecret:          jwtSecret,
+		platform:           platform,
+		filepathRoot:       filepathRoot,
+		assetsRoot:         assetsRoot,
+		s3Bucket:           s3Bucket,
+		s3Region:           s3Region,
+		s3CfDistribution:   s3CfDistribution,
+		port:               port,
 	}
 
 	err = cfg.ensureAssetsDir()
@@ -103,6 +274,47 @@ func main() {
 		log.Fatalf("Couldn't create assets directory: %v", err)
 	}
 
+	if len(os.Args) > 1 && os.Args[1] == "migrate-thumbnails" {
+		err = runMigrateThumbnailsCommand(&cfg, os.Args[2:])
+		if err != nil {
+			log.Fatalf("Migrating thumbnails failed: %v", err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "gc" {
+		err = runGCCommand(&cfg, os.Args[2:])
+		if err != nil {
+			log.Fatalf("Garbage collection failed: %v", err)
+		}
+		return
+	}
+
+	gcInterval := os.Getenv("GC_INTERVAL")
+	if gcInterval != "" {
+		interval, err := time.ParseDuration(gcInterval)
+		if err != nil {
+			log.Fatalf("Invalid GC_INTERVAL: %v", err)
+		}
+		gcOpts := gcOptions{
+			GracePeriod: defaultGCGracePeriod,
+			DryRun:      os.Getenv("GC_DRY_RUN") == "true",
+		}
+		if gcGracePeriod := os.Getenv("GC_GRACE_PERIOD"); gcGracePeriod != "" {
+			gcOpts.GracePeriod, err = time.ParseDuration(gcGracePeriod)
+			if err != nil {
+				log.Fatalf("Invalid GC_GRACE_PERIOD: %v", err)
+			}
+		}
+		cfg.startGarbageCollector(context.Background(), interval, gcOpts)
+	}
+
+	err = cfg.startJobWorkers(context.Background(), int(getEnvInt64("JOB_WORKERS", 2)))
+	if err != nil {
+		log.Fatalf("Couldn't start processing workers: %v", err)
+	}
+	go cfg.backfillStorageUsage(context.Background())
+
 	mux := http.NewServeMux()
 	appHandler := http.StripPrefix("/app", http.FileServer(http.Dir(filepathRoot)))
 	mux.Handle("/app/", appHandler)
@@ -110,17 +322,36 @@ func main() {
 	assetsHandler := http.StripPrefix("/assets", http.FileServer(http.Dir(assetsRoot)))
 	mux.Handle("/assets/", noCacheMiddleware(assetsHandler))
 
+	if storageBackend != storageBackendS3 {
+		objectsHandler := http.StripPrefix("/objects", storage.NewHandler(videoStorage))
+		mux.Handle("/objects/", objectsHandler)
+	}
+
 	mux.HandleFunc("POST /api/login", cfg.handlerLogin)
 	mux.HandleFunc("POST /api/refresh", cfg.handlerRefresh)
 	mux.HandleFunc("POST /api/revoke", cfg.handlerRevoke)
 
 	mux.HandleFunc("POST /api/users", cfg.handlerUsersCreate)
+	mux.HandleFunc("GET /api/users/me/usage", cfg.handlerUsageGet)
 
 	mux.HandleFunc("POST /api/videos", cfg.handlerVideoMetaCreate)
 	mux.HandleFunc("POST /api/thumbnail_upload/{videoID}", cfg.handlerUploadThumbnail)
 	mux.HandleFunc("POST /api/video_upload/{videoID}", cfg.handlerUploadVideo)
+	mux.HandleFunc("POST /api/video_upload/{videoID}/presign", cfg.handlerPresignVideoUpload)
+	mux.HandleFunc("POST /api/video_upload/{videoID}/complete", cfg.handlerCompleteVideoUpload)
+	mux.HandleFunc("OPTIONS /api/video_upload/{videoID}/tus", cfg.handlerTusOptions)
+	mux.HandleFunc("POST /api/video_upload/{videoID}/tus", cfg.handlerTusCreate)
+	mux.HandleFunc("HEAD /api/video_upload/{videoID}/tus/{uploadID}", cfg.handlerTusHead)
+	mux.HandleFunc("PATCH /api/video_upload/{videoID}/tus/{uploadID}", cfg.handlerTusPatch)
+	mux.HandleFunc("DELETE /api/video_upload/{videoID}/tus/{uploadID}", cfg.handlerTusDelete)
+	mux.HandleFunc("GET /api/jobs/{jobID}", cfg.handlerJobGet)
 	mux.HandleFunc("GET /api/videos", cfg.handlerVideosRetrieve)
 	mux.HandleFunc("GET /api/videos/{videoID}", cfg.handlerVideoGet)
+	mux.HandleFunc("GET /api/videos/{videoID}/events", cfg.handlerVideoEvents)
+	mux.HandleFunc("POST /api/videos/{videoID}/events/token", cfg.handlerVideoEventsToken)
+	mux.HandleFunc("GET /api/videos/{videoID}/playback/{name...}", cfg.handlerPlayback)
+	mux.HandleFunc("GET /api/videos/{videoID}/thumbnails", cfg.handlerThumbnailCandidatesGet)
+	mux.HandleFunc("PUT /api/videos/{videoID}/thumbnail", cfg.handlerThumbnailSelect)
 	mux.HandleFunc("DELETE /api/videos/{videoID}", cfg.handlerVideoMetaDelete)
 
 	mux.HandleFunc("POST /admin/reset", cfg.handlerReset)
@@ -133,3 +364,15 @@ func main() {
 	log.Printf("Serving on: http://localhost:%s/app/\n", port)
 	log.Fatal(srv.ListenAndServe())
 }
+
+func getEnvInt64(name string, defaultValue int64) int64 {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		log.Fatalf("Invalid %s: %v", name, err)
+	}
+	return n
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"testing"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/media"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+	"github.com/google/uuid"
+)
+
+const testJWTSecret = "test-secret"
+
+// newTestConfig returns a config that keeps everything in memory or in the
+// test's temporary directory, with media.Fake instead of ffmpeg.
+func newTestConfig(t *testing.T) (*apiConfig, *database.MemoryStore, *media.Fake) {
+	t.Helper()
+	db := database.NewMemoryStore()
+	videoStorage := storage.NewMemoryStore("http://localhost/objects")
+	fake := &media.Fake{Metadata: testVideoMetadata()}
+	acceptedVideoTypes, err := parseAcceptedVideoTypes("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assetsRoot := t.TempDir()
+	assetStorage, err := storage.NewLocalStore(assetsRoot, "http://localhost/assets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &apiConfig{
+		db:                 db,
+		videoStorage:       videoStorage,
+		thumbnailStorage:   storage.NewPrefixStore(videoStorage, thumbnailsPrefix),
+		assetStorage:       assetStorage,
+		mediaProcessor:     fake,
+		acceptedVideoTypes: acceptedVideoTypes,
+		jobSpoolDir:        t.TempDir(),
+		jobWorkerID:        "test-worker",
+		jobWake:            make(chan struct{}, 1),
+		progress:           newProgressHub(),
+		jwtSecret:          testJWTSecret,
+		platform:           "dev",
+		assetsRoot:         assetsRoot,
+		port:               "8091",
+	}
+	return cfg, db, fake
+}
+
+// testVideoMetadata is what ffprobe reports for a short 1080p MP4.
+func testVideoMetadata() media.Metadata {
+	return media.Metadata{
+		Streams: []media.Stream{
+			{CodecType: "video", CodecName: "h264", Width: 1920, Height: 1080, AvgFrameRate: "30/1"},
+			{CodecType: "audio", CodecName: "aac", Channels: 2},
+		},
+		Format: media.Format{FormatName: "mov,mp4,m4a,3gp,3g2,mj2", Duration: "10.0"},
+	}
+}
+
+// testMP4 is enough of an MP4 to get past sniffing. media.Fake doesn't
+// look at the rest.
+func testMP4() []byte {
+	return append([]byte("\x00\x00\x00\x18ftypisom\x00\x00\x02\x00isomiso2"), make([]byte, 4096)...)
+}
+
+// createTestUser creates a user with the password "password" and returns
+// them with an access token.
+func createTestUser(t *testing.T, cfg *apiConfig, email string) (*database.User, string) {
+	t.Helper()
+	hash, err := auth.HashPassword("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := cfg.db.CreateUser(context.Background(), database.CreateUserParams{Email: email, Password: hash})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	token, err := auth.MakeJWT(user.ID, cfg.jwtSecret, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user, token
+}
+
+func createTestVideo(t *testing.T, cfg *apiConfig, userID uuid.UUID) database.Video {
+	t.Helper()
+	video, err := cfg.db.CreateVideo(context.Background(), database.CreateVideoParams{Title: "video", UserID: userID})
+	if err != nil {
+		t.Fatalf("CreateVideo: %v", err)
+	}
+	return video
+}
+
+// newVideoUploadRequest builds the multipart request the web app sends to
+// handlerUploadVideo.
+func newVideoUploadRequest(t *testing.T, videoID uuid.UUID, token, contentType string, data []byte) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", `form-data; name="video"; filename="video.mp4"`)
+	header.Set("Content-Type", contentType)
+	part, err := form.CreatePart(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(data)
+	form.Close()
+
+	r := httptest.NewRequest(http.MethodPost, "/api/video_upload/"+videoID.String(), &body)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	r.SetPathValue("videoID", videoID.String())
+	return r
+}
+
+func decodeTestResponse(t *testing.T, w *httptest.ResponseRecorder, v any) {
+	t.Helper()
+	body, _ := io.ReadAll(w.Body)
+	err := json.Unmarshal(body, v)
+	if err != nil {
+		t.Fatalf("couldn't decode response %q: %v", body, err)
+	}
+}
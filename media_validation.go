@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/media"
+)
+
+var (
+	acceptedVideoCodecs = []string{"h264", "hevc", "av1", "mpeg4"}
+	acceptedImageTypes  = []string{"image/jpeg", "image/png"}
+)
+
+const mp4MediaType = "video/mp4"
+
+// videoContainers are the containers uploads may come in. Anything that
+// isn't MP4 is transcoded to H.264/AAC MP4 before it's stored.
+var videoContainers = map[string]struct {
+	// ffprobeFormat is one of the names ffprobe reports for the container
+	ffprobeFormat string
+	ext           string
+}{
+	mp4MediaType:       {"mp4", ".mp4"},
+	"video/quicktime":  {"mov", ".mov"},
+	"video/webm":       {"webm", ".webm"},
+	"video/x-matroska": {"matroska", ".mkv"},
+	"video/x-msvideo":  {"avi", ".avi"},
+}
+
+const defaultAcceptedVideoTypes = "video/mp4,video/quicktime,video/webm,video/x-matroska,video/x-msvideo"
+
+func parseAcceptedVideoTypes(value string) ([]string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		value = defaultAcceptedVideoTypes
+	}
+
+	types := []string{}
+	for _, mediaType := range strings.Split(value, ",") {
+		mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+		if _, ok := videoContainers[mediaType]; !ok {
+			return nil, fmt.Errorf("unknown video type %q", mediaType)
+		}
+		if !slices.Contains(types, mediaType) {
+			types = append(types, mediaType)
+		}
+	}
+	return types, nil
+}
+
+func (cfg *apiConfig) validateVideoMediaType(contentType string) (string, error) {
+	medType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", errUnsupportedMedia("invalid media type %q", contentType)
+	}
+	if !slices.Contains(cfg.acceptedVideoTypes, medType) {
+		return "", errUnsupportedMedia("unsupported media type %s", medType)
+	}
+	return medType, nil
+}
+
+// sniffLen is how much of a file the sniffers look at.
+const sniffLen = 512
+
+// unsupportedMediaError means a file isn't in an accepted format, whatever
+// its Content-Type claimed. Handlers turn it into a 415.
+type unsupportedMediaError struct {
+	reason string
+}
+
+func (e unsupportedMediaError) Error() string {
+	return e.reason
+}
+
+func errUnsupportedMedia(format string, args ...any) error {
+	return unsupportedMediaError{reason: fmt.Sprintf(format, args...)}
+}
+
+func respondWithUnsupportedMedia(w http.ResponseWriter, accepted []string, err error) {
+	log.Println(err)
+	type unsupportedResponse struct {
+		Error           string   `json:"error"`
+		AcceptedFormats []string `json:"accepted_formats"`
+	}
+	respondWithJSON(w, http.StatusUnsupportedMediaType, unsupportedResponse{
+		Error:           err.Error(),
+		AcceptedFormats: accepted,
+	})
+}
+
+// sniffVideoType identifies a video container from the first bytes of the
+// file.
+func sniffVideoType(head []byte) string {
+	if len(head) >= 12 && string(head[4:8]) == "ftyp" {
+		switch string(head[8:12]) {
+		case "qt  ":
+			return "video/quicktime"
+		case "avif", "avis", "heic", "heix", "mif1", "msf1":
+			return "image/heif"
+		}
+		return "video/mp4"
+	}
+	if bytes.HasPrefix(head, []byte{0x1a, 0x45, 0xdf, 0xa3}) {
+		// EBML, the DocType tells WebM apart from other Matroska files
+		if bytes.Contains(head, []byte("webm")) {
+			return "video/webm"
+		}
+		return "video/x-matroska"
+	}
+	if len(head) >= 12 && string(head[0:4]) == "RIFF" && string(head[8:12]) == "AVI " {
+		return "video/x-msvideo"
+	}
+	return http.DetectContentType(head)
+}
+
+// checkVideoContent makes sure the file starts like the media type the
+// client declared.
+func checkVideoContent(head []byte, mediaType string) error {
+	sniffed := sniffVideoType(head)
+	if sniffed != mediaType {
+		return errUnsupportedMedia("file content is %s, not %s", sniffed, mediaType)
+	}
+	return nil
+}
+
+// sniffVideo reads the start of a file and checks it with
+// checkVideoContent.
+func sniffVideo(r io.Reader, mediaType string) error {
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(r, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return checkVideoContent(head[:n], mediaType)
+}
+
+// checkVideoProbe makes sure ffprobe agrees the file is the declared
+// container and has a video stream we can process. MP4s are stored as they
+// are, so their codec has to be one we accept too.
+func checkVideoProbe(videoMeta media.Metadata, mediaType string) error {
+	container, ok := videoContainers[mediaType]
+	if !ok || !slices.Contains(strings.Split(videoMeta.Format.FormatName, ","), container.ffprobeFormat) {
+		return errUnsupportedMedia("file isn't a valid %s container", mediaType)
+	}
+	stream, ok := videoMeta.VideoStream()
+	if !ok {
+		return errUnsupportedMedia("file has no video stream")
+	}
+	if mediaType == mp4MediaType && !slices.Contains(acceptedVideoCodecs, stream.CodecName) {
+		return errUnsupportedMedia("video codec %q isn't supported, use one of %s", stream.CodecName, strings.Join(acceptedVideoCodecs, ", "))
+	}
+	return nil
+}
+
+// verifyVideoFile sniffs and probes a file and returns ffprobe's
+// metadata if it is a video we accept.
+func (cfg *apiConfig) verifyVideoFile(ctx context.Context, path, mediaType string) (media.Metadata, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return media.Metadata{}, err
+	}
+	err = sniffVideo(f, mediaType)
+	f.Close()
+	if err != nil {
+		return media.Metadata{}, err
+	}
+	videoMeta, err := cfg.mediaProcessor.Probe(ctx, path)
+	var cmdErr *media.CommandError
+	if errors.As(err, &cmdErr) && cmdErr.ExitCode > 0 {
+		return media.Metadata{}, errUnsupportedMedia("file couldn't be read as a video")
+	}
+	if err != nil {
+		return media.Metadata{}, err
+	}
+	return videoMeta, checkVideoProbe(videoMeta, mediaType)
+}
+
+// decodeImage fully decodes an image, so truncated or disguised files are
+// rejected, and returns its media type. The header is checked first so
+// images over maxPixels are rejected before anything is allocated for
+// them.
+func decodeImage(data []byte, maxPixels int) (string, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", errUnsupportedMedia("file couldn't be decoded as an image")
+	}
+	mediaType := "image/" + format
+	if !slices.Contains(acceptedImageTypes, mediaType) {
+		return "", errUnsupportedMedia("image format %s isn't supported", format)
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width > maxPixels/config.Height {
+		return "", errUnsupportedMedia("image is %dx%d, at most %d pixels are allowed", config.Width, config.Height, maxPixels)
+	}
+
+	_, _, err = image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return "", errUnsupportedMedia("file couldn't be decoded as an image")
+	}
+	return mediaType, nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/media"
+)
+
+func TestSniffVideoType(t *testing.T) {
+	ftyp := func(brand string) []byte {
+		return append([]byte("\x00\x00\x00\x18ftyp"+brand), make([]byte, 16)...)
+	}
+	ebml := func(docType string) []byte {
+		return append([]byte{0x1a, 0x45, 0xdf, 0xa3, 0x9f, 0x42, 0x82, 0x84}, docType...)
+	}
+
+	tests := []struct {
+		name string
+		head []byte
+		want string
+	}{
+		{"mp4 isom", ftyp("isom"), "video/mp4"},
+		{"mp4 mp42", ftyp("mp42"), "video/mp4"},
+		{"m4v", ftyp("M4V "), "video/mp4"},
+		{"quicktime", ftyp("qt  "), "video/quicktime"},
+		{"heic", ftyp("heic"), "image/heif"},
+		{"heif", ftyp("mif1"), "image/heif"},
+		{"avif", ftyp("avif"), "image/heif"},
+		{"webm", ebml("webm"), "video/webm"},
+		{"matroska", ebml("matroska"), "video/x-matroska"},
+		{"avi", []byte("RIFF\x00\x10\x00\x00AVI LIST"), "video/x-msvideo"},
+		{"wav", []byte("RIFF\x00\x10\x00\x00WAVEfmt "), "audio/wave"},
+		{"truncated ftyp", []byte("\x00\x00\x00\x18ftyp"), "application/octet-stream"},
+		{"text", []byte("just some text, not a video at all"), "text/plain; charset=utf-8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sniffVideoType(tt.head); got != tt.want {
+				t.Errorf("sniffVideoType = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckVideoProbe(t *testing.T) {
+	withCodec := func(codec string) media.Metadata {
+		meta := testVideoMetadata()
+		meta.Streams[0].CodecName = codec
+		return meta
+	}
+	withFormat := func(format string) media.Metadata {
+		meta := testVideoMetadata()
+		meta.Format.FormatName = format
+		return meta
+	}
+	audioOnly := testVideoMetadata()
+	audioOnly.Streams = audioOnly.Streams[1:]
+	webmVP9 := withFormat("matroska,webm")
+	webmVP9.Streams[0].CodecName = "vp9"
+
+	tests := []struct {
+		name      string
+		meta      media.Metadata
+		mediaType string
+		wantErr   bool
+	}{
+		{"mp4", testVideoMetadata(), "video/mp4", false},
+		{"mp4 with hevc", withCodec("hevc"), "video/mp4", false},
+		{"mp4 with vp9", withCodec("vp9"), "video/mp4", true},
+		{"quicktime", testVideoMetadata(), "video/quicktime", false},
+		{"webm", withFormat("matroska,webm"), "video/webm", false},
+		{"webm with vp9 is transcoded", webmVP9, "video/webm", false},
+		{"matroska", withFormat("matroska,webm"), "video/x-matroska", false},
+		{"avi", withFormat("avi"), "video/x-msvideo", false},
+		{"declared mp4 is webm", withFormat("matroska,webm"), "video/mp4", true},
+		{"format name is only a substring", withFormat("mp4a"), "video/mp4", true},
+		{"unknown media type", testVideoMetadata(), "video/ogg", true},
+		{"no video stream", audioOnly, "video/mp4", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkVideoProbe(tt.meta, tt.mediaType)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkVideoProbe = %v, want error: %t", err, tt.wantErr)
+			}
+			var unsupported unsupportedMediaError
+			if err != nil && !errors.As(err, &unsupported) {
+				t.Errorf("error %v isn't an unsupportedMediaError", err)
+			}
+		})
+	}
+}
+
+func TestDecodeImage(t *testing.T) {
+	encode := func(t *testing.T, encode func(*bytes.Buffer, image.Image) error, width, height int) []byte {
+		t.Helper()
+		var buf bytes.Buffer
+		err := encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	encodePNG := func(buf *bytes.Buffer, img image.Image) error { return png.Encode(buf, img) }
+	encodeJPEG := func(buf *bytes.Buffer, img image.Image) error { return jpeg.Encode(buf, img, nil) }
+	encodeGIF := func(buf *bytes.Buffer, img image.Image) error { return gif.Encode(buf, img, nil) }
+	const maxPixels = 100
+	fullPNG := encode(t, encodePNG, 10, 10)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    string
+		wantErr bool
+	}{
+		{"png", fullPNG, "image/png", false},
+		{"jpeg", encode(t, encodeJPEG, 10, 10), "image/jpeg", false},
+		{"wider than maxPixels allows", encode(t, encodePNG, 11, 10), "", true},
+		{"taller than maxPixels allows", encode(t, encodePNG, 1, 101), "", true},
+		{"gif", encode(t, encodeGIF, 10, 10), "", true},
+		{"truncated", fullPNG[:len(fullPNG)-20], "", true},
+		{"not an image", []byte("just some text, not an image"), "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeImage(tt.data, maxPixels)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeImage = %q, %v, want error: %t", got, err, tt.wantErr)
+			}
+			var unsupported unsupportedMediaError
+			if err != nil && !errors.As(err, &unsupported) {
+				t.Errorf("error %v isn't an unsupportedMediaError", err)
+			}
+			if got != tt.want {
+				t.Errorf("decodeImage = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+// runMigrateCommand implements the `migrate` admin command. Opening the
+// database has already applied every migration, so it's mostly useful
+// for rolling back with -to.
+func runMigrateCommand(db database.Client, args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	latest, err := db.LatestSchemaVersion()
+	if err != nil {
+		return err
+	}
+	to := flags.Int("to", latest, "schema version to migrate to")
+	err = flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	err = db.MigrateTo(context.Background(), *to)
+	if err != nil {
+		return err
+	}
+	version, err := db.SchemaVersion(context.Background())
+	if err != nil {
+		return err
+	}
+	log.Printf("Database schema is at version %d (latest %d)", version, latest)
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+)
+
+type thumbnailMigrationReport struct {
+	Copied  int
+	Skipped int
+}
+
+// migrateThumbnails copies thumbnails uploaded while they were kept in
+// ASSETS_ROOT into thumbnail storage, under the same keys, so videos
+// that still refer to them keep working. Thumbnails already in thumbnail
+// storage are left as they are, so it can be run again after a partial
+// copy.
+func (cfg *apiConfig) migrateThumbnails(ctx context.Context, dryRun bool) (thumbnailMigrationReport, error) {
+	report := thumbnailMigrationReport{}
+	objects, err := cfg.assetStorage.List(ctx, "")
+	if err != nil {
+		return report, fmt.Errorf("couldn't list %s: %w", cfg.assetsRoot, err)
+	}
+
+	for _, obj := range objects {
+		_, err := cfg.thumbnailStorage.Head(ctx, obj.Key)
+		if err == nil {
+			report.Skipped++
+			continue
+		}
+		if !errors.Is(err, storage.ErrNotFound) {
+			return report, err
+		}
+		if dryRun {
+			log.Printf("Would copy thumbnail %q (%d bytes)", obj.Key, obj.Size)
+			report.Copied++
+			continue
+		}
+
+		err = copyObject(ctx, cfg.assetStorage, cfg.thumbnailStorage, obj.Key)
+		if err != nil {
+			return report, fmt.Errorf("couldn't copy thumbnail %q: %w", obj.Key, err)
+		}
+		report.Copied++
+	}
+	return report, nil
+}
+
+func copyObject(ctx context.Context, from, to storage.ObjectStore, key string) error {
+	body, info, err := from.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	return to.Put(ctx, key, body, info.ContentType)
+}
+
+// runMigrateThumbnailsCommand implements the one-shot `migrate-thumbnails`
+// admin command.
+func runMigrateThumbnailsCommand(cfg *apiConfig, args []string) error {
+	flags := flag.NewFlagSet("migrate-thumbnails", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "only report thumbnails that would be copied")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	report, err := cfg.migrateThumbnails(context.Background(), *dryRun)
+	if err != nil {
+		return err
+	}
+	log.Printf("Copied %d thumbnails from %s, %d were already in thumbnail storage, dry run: %t",
+		report.Copied, cfg.assetsRoot, report.Skipped, *dryRun)
+	return nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestMigrateThumbnails(t *testing.T) {
+	cfg, _, _ := newTestConfig(t)
+	ctx := context.Background()
+	legacy := map[string]string{
+		"old.png":      "old thumbnail",
+		"copied.jpg":   "copied thumbnail",
+		"nested/a.png": "nested thumbnail",
+	}
+	for key, data := range legacy {
+		err := cfg.assetStorage.Put(ctx, key, strings.NewReader(data), "image/png")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// copied by an earlier run, and replaced since
+	err := cfg.thumbnailStorage.Put(ctx, "copied.jpg", strings.NewReader("newer thumbnail"), "image/jpeg")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := cfg.migrateThumbnails(ctx, true)
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if report.Copied != 2 || report.Skipped != 1 {
+		t.Errorf("dry run report = %+v, want 2 copied and 1 skipped", report)
+	}
+	if _, err := cfg.thumbnailStorage.Head(ctx, "old.png"); err == nil {
+		t.Error("dry run copied old.png")
+	}
+
+	report, err = cfg.migrateThumbnails(ctx, false)
+	if err != nil {
+		t.Fatalf("migrateThumbnails: %v", err)
+	}
+	if report.Copied != 2 || report.Skipped != 1 {
+		t.Errorf("report = %+v, want 2 copied and 1 skipped", report)
+	}
+	want := map[string]string{
+		"old.png":      "old thumbnail",
+		"copied.jpg":   "newer thumbnail",
+		"nested/a.png": "nested thumbnail",
+	}
+	for key, data := range want {
+		if got := readTestObject(t, cfg.thumbnailStorage, key); got != data {
+			t.Errorf("thumbnail %s = %q, want %q", key, got, data)
+		}
+	}
+
+	report, err = cfg.migrateThumbnails(ctx, false)
+	if err != nil {
+		t.Fatalf("second run: %v", err)
+	}
+	if report.Copied != 0 || report.Skipped != 3 {
+		t.Errorf("second run report = %+v, want everything skipped", report)
+	}
+}
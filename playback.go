@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/auth"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+	"github.com/google/uuid"
+)
+
+// Manifests and preview tracks refer to their segments and sprites by
+// relative URLs, which a signed URL for the manifest doesn't cover. With a
+// signed VIDEO_URL_MODE they are served by handlerPlayback instead, which
+// rewrites every reference to a signed URL.
+
+// playbackContentTypes are the files handlerPlayback serves.
+var playbackContentTypes = map[string]string{
+	".m3u8": "application/vnd.apple.mpegurl",
+	".mpd":  "application/dash+xml",
+	".vtt":  "text/vtt",
+}
+
+// maxPlaybackManifestSize bounds how much of a manifest is read into
+// memory to be rewritten.
+const maxPlaybackManifestSize = 8 << 20
+
+// manifestURL is the URL a client fetches one of the video's manifests
+// from. With signed URLs it points at handlerPlayback, authorized by a
+// token that lasts as long as the signed URLs would.
+func (cfg *apiConfig) manifestURL(ctx context.Context, video database.Video, key string) (string, error) {
+	if cfg.videoURLSigner == nil || video.VideoKey == nil {
+		return cfg.videoObjectURL(ctx, key)
+	}
+	name, ok := strings.CutPrefix(key, videoAssetPrefix(*video.VideoKey))
+	if !ok {
+		return cfg.videoObjectURL(ctx, key)
+	}
+
+	token, err := auth.MakeVideoPlaybackToken(video.UserID, video.ID, cfg.jwtSecret, cfg.signedURLExpiry)
+	if err != nil {
+		return "", err
+	}
+	return playbackPath(video.ID, name) + "?token=" + url.QueryEscape(token), nil
+}
+
+func playbackPath(videoID uuid.UUID, name string) string {
+	return "/api/videos/" + videoID.String() + "/playback/" + name
+}
+
+// handlerPlayback serves a manifest or preview track of a video with every
+// object it references replaced by a signed URL.
+func (cfg *apiConfig) handlerPlayback(w http.ResponseWriter, r *http.Request) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	token := r.URL.Query().Get("token")
+	_, err = auth.ValidateVideoPlaybackToken(token, videoID, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate token", err)
+		return
+	}
+
+	name := r.PathValue("name")
+	contentType, ok := playbackContentTypes[path.Ext(name)]
+	if !ok || cfg.videoURLSigner == nil || !isRelativeRef(name) || path.Clean(name) != name {
+		respondWithError(w, http.StatusNotFound, "Not found", nil)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(r.Context(), videoID)
+	if errors.Is(err, database.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.VideoKey == nil {
+		respondWithError(w, http.StatusNotFound, "Not found", nil)
+		return
+	}
+
+	prefix := videoAssetPrefix(*video.VideoKey)
+	body, _, err := cfg.videoStorage.Get(r.Context(), prefix+name)
+	if errors.Is(err, storage.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "Not found", nil)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get manifest", err)
+		return
+	}
+	defer body.Close()
+	data, err := io.ReadAll(io.LimitReader(body, maxPlaybackManifestSize))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't read manifest", err)
+		return
+	}
+
+	signer, err := cfg.playbackSigner(r.Context(), prefix)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't sign manifest", err)
+		return
+	}
+	refs := manifestRefs{
+		prefix: prefix,
+		dir:    path.Dir(name),
+		token:  token,
+		signer: signer,
+	}
+
+	var rewritten string
+	switch path.Ext(name) {
+	case ".m3u8":
+		rewritten, err = rewriteHLSManifest(string(data), refs)
+	case ".mpd":
+		rewritten, err = rewriteDASHManifest(string(data), refs)
+	case ".vtt":
+		rewritten, err = rewriteVTTTrack(string(data), refs)
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't sign manifest", err)
+		return
+	}
+
+	// the URLs in it expire, so it mustn't outlive them in a cache
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, rewritten)
+}
+
+// playbackSigner signs the URLs of objects under a video's asset prefix.
+// Signers that can cover the whole prefix with one signature do, which
+// also works for DASH segment templates; otherwise each object is signed
+// on its own.
+type playbackSigner struct {
+	sign      func(key string) (string, error)
+	templates bool
+}
+
+func (cfg *apiConfig) playbackSigner(ctx context.Context, prefix string) (playbackSigner, error) {
+	if prefixSigner, ok := cfg.videoURLSigner.(storage.PrefixSigner); ok {
+		signed, err := prefixSigner.SignPrefix(ctx, prefix, cfg.signedURLExpiry)
+		if err != nil {
+			return playbackSigner{}, err
+		}
+		return playbackSigner{
+			sign:      func(key string) (string, error) { return signed(key), nil },
+			templates: true,
+		}, nil
+	}
+	return playbackSigner{
+		sign: func(key string) (string, error) {
+			return cfg.videoURLSigner.SignedURL(ctx, key, cfg.signedURLExpiry)
+		},
+	}, nil
+}
+
+// manifestRefs resolves the references in a manifest stored at dir under
+// a video's asset prefix.
+type manifestRefs struct {
+	prefix string
+	dir    string
+	token  string
+	signer playbackSigner
+}
+
+// resolve returns what a reference should be replaced with. Other
+// manifests stay relative and carry the playback token, so they are
+// fetched through handlerPlayback too. Absolute URLs, and templates the
+// signer can't handle, are left as they are.
+func (m manifestRefs) resolve(ref string) (string, error) {
+	if ref == "" || !isRelativeRef(ref) {
+		return ref, nil
+	}
+	refPath, fragment, hasFragment := strings.Cut(ref, "#")
+	if _, ok := playbackContentTypes[path.Ext(refPath)]; ok {
+		return refPath + "?token=" + url.QueryEscape(m.token) + fragmentSuffix(fragment, hasFragment), nil
+	}
+	if strings.Contains(refPath, "$") && !m.signer.templates {
+		return ref, nil
+	}
+
+	key := m.prefix + path.Join(m.dir, refPath)
+	if !strings.HasPrefix(key, m.prefix) {
+		return ref, nil
+	}
+	signed, err := m.signer.sign(key)
+	if err != nil {
+		return "", err
+	}
+	return signed + fragmentSuffix(fragment, hasFragment), nil
+}
+
+func fragmentSuffix(fragment string, hasFragment bool) string {
+	if !hasFragment {
+		return ""
+	}
+	return "#" + fragment
+}
+
+// isRelativeRef reports whether ref is a path relative to the manifest
+// that doesn't leave the video's assets.
+func isRelativeRef(ref string) bool {
+	if strings.HasPrefix(ref, "/") || strings.Contains(ref, "://") {
+		return false
+	}
+	for _, part := range strings.Split(ref, "/") {
+		if part == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+var hlsURIAttribute = regexp.MustCompile(`URI="([^"]*)"`)
+
+// rewriteHLSManifest resolves the URI lines of a playlist and the URI
+// attributes of its tags.
+func rewriteHLSManifest(manifest string, refs manifestRefs) (string, error) {
+	var b strings.Builder
+	scanner := bufio.NewScanner(strings.NewReader(manifest))
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		var err error
+		switch {
+		case trimmed == "":
+		case strings.HasPrefix(trimmed, "#"):
+			line, err = replaceSubmatches(hlsURIAttribute, line, func(value string) (string, error) {
+				return refs.resolve(value)
+			})
+		default:
+			line, err = refs.resolve(trimmed)
+		}
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+	return b.String(), scanner.Err()
+}
+
+var (
+	dashURLAttribute = regexp.MustCompile(`\b(?:sourceURL|media|initialization)="([^"]*)"`)
+	dashBaseURL      = regexp.MustCompile(`<BaseURL>([^<]*)</BaseURL>`)
+)
+
+// rewriteDASHManifest resolves the segment URLs, segment templates and
+// base URLs of an MPD.
+func rewriteDASHManifest(manifest string, refs manifestRefs) (string, error) {
+	resolve := func(value string) (string, error) {
+		resolved, err := refs.resolve(html.UnescapeString(value))
+		if err != nil {
+			return "", err
+		}
+		return html.EscapeString(resolved), nil
+	}
+	manifest, err := replaceSubmatches(dashURLAttribute, manifest, resolve)
+	if err != nil {
+		return "", err
+	}
+	return replaceSubmatches(dashBaseURL, manifest, resolve)
+}
+
+// rewriteVTTTrack resolves the cue payloads of a preview track, which are
+// sprite URLs with an #xywh= fragment.
+func rewriteVTTTrack(track string, refs manifestRefs) (string, error) {
+	var b strings.Builder
+	inCue := false
+	scanner := bufio.NewScanner(strings.NewReader(track))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.Contains(line, "-->"):
+			inCue = true
+		case strings.TrimSpace(line) == "":
+			inCue = false
+		case inCue:
+			var err error
+			line, err = refs.resolve(strings.TrimSpace(line))
+			if err != nil {
+				return "", err
+			}
+		}
+		b.WriteString(line)
+		b.WriteString("\n")
+	}
+	return b.String(), scanner.Err()
+}
+
+// replaceSubmatches replaces the first group of every match of re in s.
+func replaceSubmatches(re *regexp.Regexp, s string, replace func(string) (string, error)) (string, error) {
+	var b strings.Builder
+	last := 0
+	for _, match := range re.FindAllStringSubmatchIndex(s, -1) {
+		replaced, err := replace(s[match[2]:match[3]])
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(s[last:match[2]])
+		b.WriteString(replaced)
+		last = match[3]
+	}
+	b.WriteString(s[last:])
+	return b.String(), nil
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+// testManifestRefs resolves references in a manifest stored at dir under
+// the asset prefix of a video, signing keys with a fake CDN signature.
+func testManifestRefs(dir string, templates bool) manifestRefs {
+	return manifestRefs{
+		prefix: "landscape/abc/",
+		dir:    dir,
+		token:  "tok",
+		signer: playbackSigner{
+			sign: func(key string) (string, error) {
+				return "https://cdn.example/" + key + "?sig=1", nil
+			},
+			templates: templates,
+		},
+	}
+}
+
+func TestIsRelativeRef(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want bool
+	}{
+		{"720p_0000.ts", true},
+		{"hls/720p.m3u8", true},
+		{"./init.mp4", true},
+		{"/landscape/abc/init.mp4", false},
+		{"https://cdn.example/init.mp4", false},
+		{"../other/init.mp4", false},
+		{"hls/../../other/init.mp4", false},
+		{"hls/..", false},
+	}
+	for _, tt := range tests {
+		if got := isRelativeRef(tt.ref); got != tt.want {
+			t.Errorf("isRelativeRef(%q) = %t, want %t", tt.ref, got, tt.want)
+		}
+	}
+}
+
+func TestManifestRefsResolve(t *testing.T) {
+	tests := []struct {
+		name      string
+		dir       string
+		templates bool
+		ref       string
+		want      string
+	}{
+		{"empty", "hls", false, "", ""},
+		{"segment", "hls", false, "720p_0000.ts", "https://cdn.example/landscape/abc/hls/720p_0000.ts?sig=1"},
+		{"manifest in the root", ".", false, "init.mp4", "https://cdn.example/landscape/abc/init.mp4?sig=1"},
+		{"subdirectory", "hls", false, "720p/0000.ts", "https://cdn.example/landscape/abc/hls/720p/0000.ts?sig=1"},
+		{"dot segment", "hls", false, "./720p_0000.ts", "https://cdn.example/landscape/abc/hls/720p_0000.ts?sig=1"},
+		{"playlist", "hls", false, "720p.m3u8", "720p.m3u8?token=tok"},
+		{"preview track", "previews", false, "previews.vtt", "previews.vtt?token=tok"},
+		{"fragment", "previews", false, "sprite-000.jpg#xywh=0,0,160,90", "https://cdn.example/landscape/abc/previews/sprite-000.jpg?sig=1#xywh=0,0,160,90"},
+		{"absolute URL", "hls", false, "https://other.example/0000.ts", "https://other.example/0000.ts"},
+		{"absolute path", "hls", false, "/landscape/abc/hls/0000.ts", "/landscape/abc/hls/0000.ts"},
+		{"parent directory", "hls", false, "../../other/0000.ts", "../../other/0000.ts"},
+		{"template without prefix signing", "dash", false, "chunk-$Number%05d$.m4s", "chunk-$Number%05d$.m4s"},
+		{"template with prefix signing", "dash", true, "chunk-$Number%05d$.m4s", "https://cdn.example/landscape/abc/dash/chunk-$Number%05d$.m4s?sig=1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := testManifestRefs(tt.dir, tt.templates).resolve(tt.ref)
+			if err != nil {
+				t.Fatalf("resolve(%q): %v", tt.ref, err)
+			}
+			if got != tt.want {
+				t.Errorf("resolve(%q) = %q, want %q", tt.ref, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRewriteHLSManifest(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+		want     string
+	}{
+		{
+			name: "master playlist",
+			manifest: `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-STREAM-INF:BANDWIDTH=2928000,RESOLUTION=1280x720,CODECS="avc1.4D401F,mp4a.40.2"
+720p.m3u8
+#EXT-X-I-FRAME-STREAM-INF:BANDWIDTH=280000,URI="720p_iframes.m3u8"
+`,
+			want: `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-STREAM-INF:BANDWIDTH=2928000,RESOLUTION=1280x720,CODECS="avc1.4D401F,mp4a.40.2"
+720p.m3u8?token=tok
+#EXT-X-I-FRAME-STREAM-INF:BANDWIDTH=280000,URI="720p_iframes.m3u8?token=tok"
+`,
+		},
+		{
+			name: "media playlist",
+			manifest: `#EXTM3U
+#EXT-X-TARGETDURATION:6
+#EXT-X-MAP:URI="init.mp4",BYTERANGE="720@0"
+
+#EXTINF:6.000000,
+  720p_0000.ts
+#EXTINF:4.000000,
+https://other.example/720p_0001.ts
+#EXT-X-ENDLIST
+`,
+			want: `#EXTM3U
+#EXT-X-TARGETDURATION:6
+#EXT-X-MAP:URI="https://cdn.example/landscape/abc/hls/init.mp4?sig=1",BYTERANGE="720@0"
+
+#EXTINF:6.000000,
+https://cdn.example/landscape/abc/hls/720p_0000.ts?sig=1
+#EXTINF:4.000000,
+https://other.example/720p_0001.ts
+#EXT-X-ENDLIST
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := rewriteHLSManifest(tt.manifest, testManifestRefs("hls", false))
+			if err != nil {
+				t.Fatalf("rewriteHLSManifest: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("rewriteHLSManifest =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRewriteDASHManifest(t *testing.T) {
+	const manifest = `<?xml version="1.0" encoding="utf-8"?>
+<MPD type="static">
+	<BaseURL>https://other.example/</BaseURL>
+	<Period>
+		<AdaptationSet contentType="video">
+			<Representation id="0">
+				<SegmentTemplate initialization="init-stream$RepresentationID$.m4s" media="chunk-stream$RepresentationID$-$Number%05d$.m4s" startNumber="1"/>
+			</Representation>
+			<Representation id="1">
+				<SegmentList>
+					<Initialization sourceURL="init.mp4"/>
+					<SegmentURL media="chunk&amp;1.m4s"/>
+				</SegmentList>
+			</Representation>
+		</AdaptationSet>
+	</Period>
+</MPD>
+`
+	tests := []struct {
+		name      string
+		templates bool
+		want      string
+	}{
+		{
+			name:      "signed per object",
+			templates: false,
+			want: `<?xml version="1.0" encoding="utf-8"?>
+<MPD type="static">
+	<BaseURL>https://other.example/</BaseURL>
+	<Period>
+		<AdaptationSet contentType="video">
+			<Representation id="0">
+				<SegmentTemplate initialization="init-stream$RepresentationID$.m4s" media="chunk-stream$RepresentationID$-$Number%05d$.m4s" startNumber="1"/>
+			</Representation>
+			<Representation id="1">
+				<SegmentList>
+					<Initialization sourceURL="https://cdn.example/landscape/abc/dash/init.mp4?sig=1"/>
+					<SegmentURL media="https://cdn.example/landscape/abc/dash/chunk&amp;1.m4s?sig=1"/>
+				</SegmentList>
+			</Representation>
+		</AdaptationSet>
+	</Period>
+</MPD>
+`,
+		},
+		{
+			name:      "signed by prefix",
+			templates: true,
+			want: `<?xml version="1.0" encoding="utf-8"?>
+<MPD type="static">
+	<BaseURL>https://other.example/</BaseURL>
+	<Period>
+		<AdaptationSet contentType="video">
+			<Representation id="0">
+				<SegmentTemplate initialization="https://cdn.example/landscape/abc/dash/init-stream$RepresentationID$.m4s?sig=1" media="https://cdn.example/landscape/abc/dash/chunk-stream$RepresentationID$-$Number%05d$.m4s?sig=1" startNumber="1"/>
+			</Representation>
+			<Representation id="1">
+				<SegmentList>
+					<Initialization sourceURL="https://cdn.example/landscape/abc/dash/init.mp4?sig=1"/>
+					<SegmentURL media="https://cdn.example/landscape/abc/dash/chunk&amp;1.m4s?sig=1"/>
+				</SegmentList>
+			</Representation>
+		</AdaptationSet>
+	</Period>
+</MPD>
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := rewriteDASHManifest(manifest, testManifestRefs("dash", tt.templates))
+			if err != nil {
+				t.Fatalf("rewriteDASHManifest: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("rewriteDASHManifest =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRewriteVTTTrack(t *testing.T) {
+	const track = `WEBVTT
+
+NOTE sprite-000.jpg isn't a cue
+
+00:00:00.000 --> 00:00:05.000
+sprite-000.jpg#xywh=0,0,160,90
+
+00:00:05.000 --> 00:00:10.000
+sprite-000.jpg#xywh=160,0,160,90
+`
+	const want = `WEBVTT
+
+NOTE sprite-000.jpg isn't a cue
+
+00:00:00.000 --> 00:00:05.000
+https://cdn.example/landscape/abc/previews/sprite-000.jpg?sig=1#xywh=0,0,160,90
+
+00:00:05.000 --> 00:00:10.000
+https://cdn.example/landscape/abc/previews/sprite-000.jpg?sig=1#xywh=160,0,160,90
+`
+	got, err := rewriteVTTTrack(track, testManifestRefs("previews", false))
+	if err != nil {
+		t.Fatalf("rewriteVTTTrack: %v", err)
+	}
+	if got != want {
+		t.Errorf("rewriteVTTTrack =\n%s\nwant\n%s", got, want)
+	}
+}
+
+// TestRewriteManifestSignError checks a reference that can't be signed
+// fails the whole manifest rather than leaving it unsigned.
+func TestRewriteManifestSignError(t *testing.T) {
+	refs := testManifestRefs("hls", false)
+	signErr := errors.New("no key")
+	refs.signer.sign = func(key string) (string, error) { return "", signErr }
+
+	rewrites := map[string]func(string, manifestRefs) (string, error){
+		"hls":  rewriteHLSManifest,
+		"dash": rewriteDASHManifest,
+		"vtt":  rewriteVTTTrack,
+	}
+	manifests := map[string]string{
+		"hls":  "#EXTM3U\n#EXTINF:6.0,\n720p_0000.ts\n",
+		"dash": `<SegmentURL media="chunk-1.m4s"/>`,
+		"vtt":  "WEBVTT\n\n00:00:00.000 --> 00:00:05.000\nsprite-000.jpg#xywh=0,0,160,90\n",
+	}
+	for format, rewrite := range rewrites {
+		if _, err := rewrite(manifests[format], refs); !errors.Is(err, signErr) {
+			t.Errorf("%s: err = %v, want %v", format, err, signErr)
+		}
+	}
+}
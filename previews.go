@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/media"
+)
+
+// Seek-bar previews are frames taken every previewIntervalSeconds, tiled
+// into sprite sheets of previewColumns x previewRows frames.
+const (
+	previewIntervalSeconds = 5
+	previewWidth           = 160
+	previewColumns         = 10
+	previewRows            = 10
+)
+
+// generatePreviews renders the preview sprite sheets and a WebVTT track
+// mapping time ranges to frames in them, stores both under keyPrefix and
+// returns the key of the track.
+func (cfg *apiConfig) generatePreviews(ctx context.Context, sourcePath string, videoMeta media.Metadata, keyPrefix string) (string, error) {
+	stream, ok := videoMeta.VideoStream()
+	if !ok || stream.Width == 0 || stream.Height == 0 {
+		return "", fmt.Errorf("no video stream found")
+	}
+	duration := videoMeta.Duration()
+	if duration <= 0 {
+		return "", fmt.Errorf("unknown video duration")
+	}
+
+	workDir, err := cfg.createSpoolDir("previews-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(workDir)
+
+	width, height := stream.DisplaySize()
+	height = scaledWidth(height, width, previewWidth)
+	err = cfg.mediaProcessor.Run(ctx, media.OpFrames, []string{
+		"-y",
+		"-i", sourcePath,
+		"-vf", fmt.Sprintf("fps=1/%d,scale=%d:%d,tile=%dx%d", previewIntervalSeconds, previewWidth, height, previewColumns, previewRows),
+		"-fps_mode", "passthrough",
+		"-q:v", "5",
+		"-start_number", "0",
+		filepath.Join(workDir, "sprite-%03d.jpg"),
+	}, nil)
+	if err != nil {
+		return "", fmt.Errorf("couldn't render preview sprites: %w", err)
+	}
+
+	vtt := previewTrack(duration, previewWidth, height)
+	err = os.WriteFile(filepath.Join(workDir, "previews.vtt"), []byte(vtt), 0644)
+	if err != nil {
+		return "", err
+	}
+
+	previewPrefix := keyPrefix + "preview/"
+	err = cfg.uploadDir(ctx, workDir, previewPrefix)
+	if err != nil {
+		return "", err
+	}
+	return previewPrefix + "previews.vtt", nil
+}
+
+// previewTrack builds the WebVTT track for sprites rendered by
+// generatePreviews. Sprite URLs are relative to the track.
+func previewTrack(duration float64, width, height int) string {
+	framesPerSheet := previewColumns * previewRows
+	frames := int(math.Ceil(duration / previewIntervalSeconds))
+
+	var b strings.Builder
+	b.WriteString("WEBVTT\n")
+	for i := range frames {
+		start := float64(i * previewIntervalSeconds)
+		end := min(float64((i+1)*previewIntervalSeconds), duration)
+		tile := i % framesPerSheet
+		fmt.Fprintf(&b, "\n%s --> %s\nsprite-%03d.jpg#xywh=%d,%d,%d,%d\n",
+			vttTimestamp(start),
+			vttTimestamp(end),
+			i/framesPerSheet,
+			tile%previewColumns*width,
+			tile/previewColumns*height,
+			width,
+			height,
+		)
+	}
+	return b.String()
+}
+
+func vttTimestamp(seconds float64) string {
+	d := time.Duration(math.Round(seconds*1000)) * time.Millisecond
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60, d.Milliseconds()%1000)
+}
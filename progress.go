@@ -0,0 +1,192 @@
+package main
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Stages a video goes through, in order, as reported to progress
+// subscribers. The processing stages carry a percentage.
+const (
+	progressStageReceiving  = "receiving"
+	progressStageQueued     = "queued"
+	progressStageProcessing = "processing"
+	progressStageStoring    = "storing"
+	progressStageEncoding   = "encoding"
+	progressStageReady      = "ready"
+	progressStageFailed     = "failed"
+)
+
+const progressInterval = 250 * time.Millisecond
+
+type progressEvent struct {
+	Stage   string     `json:"stage"`
+	JobID   *uuid.UUID `json:"job_id,omitempty"`
+	Percent float64    `json:"percent"`
+	Bytes   int64      `json:"bytes,omitempty"`
+	Total   int64      `json:"total,omitempty"`
+	Error   string     `json:"error,omitempty"`
+}
+
+func (e progressEvent) done() bool {
+	return e.Stage == progressStageReady || e.Stage == progressStageFailed
+}
+
+// progressHub fans progress events out to everyone watching a video. It
+// keeps the latest event of unfinished videos so new subscribers don't
+// have to wait for the next one.
+type progressHub struct {
+	mu          sync.Mutex
+	subscribers map[uuid.UUID]map[chan progressEvent]struct{}
+	latest      map[uuid.UUID]progressEvent
+}
+
+func newProgressHub() *progressHub {
+	return &progressHub{
+		subscribers: map[uuid.UUID]map[chan progressEvent]struct{}{},
+		latest:      map[uuid.UUID]progressEvent{},
+	}
+}
+
+// subscribe returns a channel of the video's events, the latest event if
+// there is one, and a function to stop the subscription.
+func (h *progressHub) subscribe(videoID uuid.UUID) (<-chan progressEvent, *progressEvent, func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ch := make(chan progressEvent, 8)
+	if h.subscribers[videoID] == nil {
+		h.subscribers[videoID] = map[chan progressEvent]struct{}{}
+	}
+	h.subscribers[videoID][ch] = struct{}{}
+
+	var latest *progressEvent
+	if event, ok := h.latest[videoID]; ok {
+		latest = &event
+	}
+
+	return ch, latest, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.subscribers[videoID], ch)
+		if len(h.subscribers[videoID]) == 0 {
+			delete(h.subscribers, videoID)
+		}
+	}
+}
+
+// publish never blocks: a subscriber that falls behind loses its oldest
+// events, which only matters for intermediate percentages.
+func (h *progressHub) publish(videoID uuid.UUID, event progressEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if event.done() {
+		delete(h.latest, videoID)
+	} else {
+		h.latest[videoID] = event
+	}
+
+	for ch := range h.subscribers[videoID] {
+		select {
+		case ch <- event:
+			continue
+		default:
+		}
+		select {
+		case <-ch:
+		default:
+		}
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+func percentOf(done, total int64) float64 {
+	if total <= 0 {
+		return 0
+	}
+	return min(float64(done)/float64(total)*100, 100)
+}
+
+// progressReader calls report with the number of bytes read so far, at
+// most once per progressInterval and once more at EOF.
+type progressReader struct {
+	r      io.Reader
+	read   int64
+	last   time.Time
+	report func(read int64)
+}
+
+func newProgressReader(r io.Reader, report func(read int64)) *progressReader {
+	return &progressReader{r: r, report: report}
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.read += int64(n)
+	if err == io.EOF || time.Since(p.last) >= progressInterval {
+		p.last = time.Now()
+		p.report(p.read)
+	}
+	return n, err
+}
+
+// progressFile counts the bytes an object store reads from a file. Stores
+// may read the file more than once, e.g. to checksum it before uploading,
+// so seeking back to the start resets the count. It keeps the file's
+// ReaderAt and Seeker so stores can still upload it in parallel parts.
+type progressFile struct {
+	f      io.ReadSeeker
+	ra     io.ReaderAt
+	mu     sync.Mutex
+	read   int64
+	last   time.Time
+	report func(read int64)
+}
+
+type readSeekerAt interface {
+	io.ReadSeeker
+	io.ReaderAt
+}
+
+func newProgressFile(f readSeekerAt, report func(read int64)) *progressFile {
+	return &progressFile{f: f, ra: f, report: report}
+}
+
+func (p *progressFile) Read(b []byte) (int, error) {
+	n, err := p.f.Read(b)
+	p.add(n)
+	return n, err
+}
+
+func (p *progressFile) ReadAt(b []byte, off int64) (int, error) {
+	n, err := p.ra.ReadAt(b, off)
+	p.add(n)
+	return n, err
+}
+
+func (p *progressFile) Seek(offset int64, whence int) (int64, error) {
+	pos, err := p.f.Seek(offset, whence)
+	if err == nil && pos == 0 {
+		p.mu.Lock()
+		p.read = 0
+		p.mu.Unlock()
+	}
+	return pos, err
+}
+
+func (p *progressFile) add(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.read += int64(n)
+	if time.Since(p.last) >= progressInterval {
+		p.last = time.Now()
+		p.report(p.read)
+	}
+}
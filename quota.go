@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+	"github.com/google/uuid"
+)
+
+type usageResponse struct {
+	database.Usage
+	UsedBytes      int64  `json:"used_bytes"`
+	QuotaBytes     *int64 `json:"quota_bytes"`
+	RemainingBytes *int64 `json:"remaining_bytes"`
+}
+
+func (cfg *apiConfig) userUsage(ctx context.Context, userID uuid.UUID) (usageResponse, error) {
+	usage, err := cfg.db.GetUsage(ctx, userID)
+	if err != nil {
+		return usageResponse{}, err
+	}
+	resp := usageResponse{
+		Usage:     usage,
+		UsedBytes: usage.TotalBytes(),
+	}
+	if cfg.userQuotaBytes > 0 {
+		quota := cfg.userQuotaBytes
+		remaining := max(quota-resp.UsedBytes, 0)
+		resp.QuotaBytes = &quota
+		resp.RemainingBytes = &remaining
+	}
+	return resp, nil
+}
+
+// checkQuota responds with 413 and returns false if storing size more bytes
+// would take the user over their quota. replacing is what the upload
+// replaces, it's freed once the upload has been processed.
+func (cfg *apiConfig) checkQuota(w http.ResponseWriter, r *http.Request, userID uuid.UUID, size, replacing int64) bool {
+	if cfg.userQuotaBytes <= 0 {
+		return true
+	}
+
+	usage, err := cfg.userUsage(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get storage usage", err)
+		return false
+	}
+	used := max(usage.UsedBytes-replacing, 0)
+	if used+size <= cfg.userQuotaBytes {
+		return true
+	}
+
+	type quotaExceededResponse struct {
+		Error          string `json:"error"`
+		RequestedBytes int64  `json:"requested_bytes"`
+		UsedBytes      int64  `json:"used_bytes"`
+		QuotaBytes     int64  `json:"quota_bytes"`
+		RemainingBytes int64  `json:"remaining_bytes"`
+	}
+	respondWithJSON(w, http.StatusRequestEntityTooLarge, quotaExceededResponse{
+		Error:          fmt.Sprintf("storage quota exceeded: %d of %d bytes used", used, cfg.userQuotaBytes),
+		RequestedBytes: size,
+		UsedBytes:      used,
+		QuotaBytes:     cfg.userQuotaBytes,
+		RemainingBytes: max(cfg.userQuotaBytes-used, 0),
+	})
+	return false
+}
+
+// checkProcessedQuota makes sure storing the processed video keeps the user
+// within their quota. The video's current assets are replaced and the
+// upload's reservation released, so neither counts against it.
+func (cfg *apiConfig) checkProcessedQuota(ctx context.Context, video database.Video, processed database.ProcessedVideo, reserved int64) error {
+	if cfg.userQuotaBytes <= 0 {
+		return nil
+	}
+
+	usage, err := cfg.db.GetUsage(ctx, video.UserID)
+	if err != nil {
+		return fmt.Errorf("couldn't get storage usage: %w", err)
+	}
+	replacement := video
+	replacement.VideoKey = processed.VideoKey
+	replacement.OriginalKey = processed.OriginalKey
+	replacement, err = cfg.measureVideoStorage(ctx, replacement)
+	if err != nil {
+		return fmt.Errorf("couldn't measure processed video: %w", err)
+	}
+
+	used := max(usage.TotalBytes()-video.VideoBytes-video.ThumbnailBytes-reserved, 0)
+	needed := replacement.VideoBytes + replacement.ThumbnailBytes
+	if used+needed > cfg.userQuotaBytes {
+		return fmt.Errorf("storage quota exceeded: processed video needs %d bytes, %d of %d bytes are used", needed, used, cfg.userQuotaBytes)
+	}
+	return nil
+}
+
+// measureVideoStorage sets how many bytes the video's objects take up in
+// each store: the video, its original and derived assets, and its
+// thumbnail and candidates.
+func (cfg *apiConfig) measureVideoStorage(ctx context.Context, video database.Video) (database.Video, error) {
+	var videoBytes, thumbnailBytes int64
+	var errs []error
+
+	add := func(total *int64, store storage.ObjectStore, key string) {
+		info, err := store.Head(ctx, key)
+		if errors.Is(err, storage.ErrNotFound) {
+			return
+		}
+		if err != nil {
+			errs = append(errs, err)
+			return
+		}
+		*total += info.Size
+	}
+	addPrefix := func(total *int64, store storage.ObjectStore, prefix string) {
+		objects, err := store.List(ctx, prefix)
+		if err != nil {
+			errs = append(errs, err)
+			return
+		}
+		for _, obj := range objects {
+			*total += obj.Size
+		}
+	}
+
+	if video.VideoKey != nil {
+		add(&videoBytes, cfg.videoStorage, *video.VideoKey)
+		addPrefix(&videoBytes, cfg.videoStorage, videoAssetPrefix(*video.VideoKey))
+	}
+	if video.OriginalKey != nil {
+		add(&videoBytes, cfg.videoStorage, *video.OriginalKey)
+	}
+	candidatePrefix := thumbnailCandidatePrefix(video.ID)
+	addPrefix(&thumbnailBytes, cfg.thumbnailStorage, candidatePrefix)
+	if video.ThumbnailKey != nil && !strings.HasPrefix(*video.ThumbnailKey, candidatePrefix) {
+		add(&thumbnailBytes, cfg.thumbnailStorage, *video.ThumbnailKey)
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return video, err
+	}
+	video.VideoBytes = videoBytes
+	video.ThumbnailBytes = thumbnailBytes
+	return video, nil
+}
+
+// deleteProcessedAssets removes what processing stored for a video that
+// won't point at it.
+func (cfg *apiConfig) deleteProcessedAssets(ctx context.Context, processed database.ProcessedVideo) {
+	ctx = context.WithoutCancel(ctx)
+	if processed.VideoKey != nil {
+		cfg.deleteObject(ctx, storageNameVideo, *processed.VideoKey)
+		cfg.deletePrefix(ctx, storageNameVideo, videoAssetPrefix(*processed.VideoKey))
+	}
+	if processed.OriginalKey != nil {
+		cfg.deleteObject(ctx, storageNameVideo, *processed.OriginalKey)
+	}
+}
+
+// updateVideoUsage measures the video's storage and saves it. Usage is
+// only informational until the next upload is checked, so failures are
+// logged and the video is returned as it was.
+func (cfg *apiConfig) updateVideoUsage(ctx context.Context, video database.Video) database.Video {
+	measured, err := cfg.measureVideoStorage(ctx, video)
+	if err == nil {
+		err = cfg.db.SetVideoUsage(ctx, video.ID, measured.VideoBytes, measured.ThumbnailBytes)
+	}
+	if err != nil {
+		log.Printf("Couldn't measure storage of video %s: %v", video.ID, err)
+		return video
+	}
+	return measured
+}
+
+// backfillStorageUsage measures videos stored before usage was tracked.
+func (cfg *apiConfig) backfillStorageUsage(ctx context.Context) {
+	videos, err := cfg.db.GetAllVideos(ctx)
+	if err != nil {
+		log.Printf("Couldn't backfill storage usage: %v", err)
+		return
+	}
+	for _, video := range videos {
+		if video.VideoBytes > 0 || video.ThumbnailBytes > 0 || (video.VideoKey == nil && video.ThumbnailKey == nil) {
+			continue
+		}
+		video, err = cfg.measureVideoStorage(ctx, video)
+		if err == nil {
+			err = cfg.db.SetVideoUsage(ctx, video.ID, video.VideoBytes, video.ThumbnailBytes)
+		}
+		if err != nil {
+			log.Printf("Couldn't backfill storage usage of video %s: %v", video.ID, err)
+		}
+	}
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"mime"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/media"
+)
+
+const segmentSeconds = 6
+
+const (
+	streamingFormatHLS  = "hls"
+	streamingFormatDASH = "dash"
+)
+
+// parseStreamingFormats reads a comma separated list of streaming formats.
+// HLS is produced by default, "none" disables adaptive streaming.
+func parseStreamingFormats(value string) ([]string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return []string{streamingFormatHLS}, nil
+	}
+	if value == "none" {
+		return []string{}, nil
+	}
+
+	formats := []string{}
+	for _, format := range strings.Split(value, ",") {
+		format = strings.ToLower(strings.TrimSpace(format))
+		if format != streamingFormatHLS && format != streamingFormatDASH {
+			return nil, fmt.Errorf("unknown streaming format %q", format)
+		}
+		if !slices.Contains(formats, format) {
+			formats = append(formats, format)
+		}
+	}
+	return formats, nil
+}
+
+type rendition struct {
+	Name string
+	// ShortSide is the height of landscape and the width of portrait
+	// renditions, so "1080p" means the same quality either way.
+	ShortSide    int
+	VideoBitrate int
+	AudioBitrate int
+}
+
+// renditionLadder is ordered from the highest to the lowest quality.
+var renditionLadder = []rendition{
+	{Name: "1080p", ShortSide: 1080, VideoBitrate: 5_000_000, AudioBitrate: 192_000},
+	{Name: "720p", ShortSide: 720, VideoBitrate: 2_800_000, AudioBitrate: 128_000},
+	{Name: "480p", ShortSide: 480, VideoBitrate: 1_400_000, AudioBitrate: 128_000},
+	{Name: "360p", ShortSide: 360, VideoBitrate: 800_000, AudioBitrate: 96_000},
+}
+
+type encodedRendition struct {
+	rendition
+	Width  int
+	Height int
+	// Level is the H.264 level_idc the rendition is encoded at, e.g. 31
+	// for level 3.1.
+	Level int
+	Path  string
+}
+
+func (r encodedRendition) bandwidth() int {
+	return r.VideoBitrate + r.AudioBitrate
+}
+
+// codecs is the RFC 6381 codecs string of the rendition: H.264 Main
+// profile as libx264 writes it (4D40) at the rendition's level, plus
+// AAC-LC audio if there is any.
+func (r encodedRendition) codecs(hasAudio bool) string {
+	codecs := fmt.Sprintf("avc1.4D40%02X", r.Level)
+	if hasAudio {
+		codecs += ",mp4a.40.2"
+	}
+	return codecs
+}
+
+// h264Levels are the levels renditions are encoded at, with the largest
+// frame, in 16x16 macroblocks, and macroblocks per second each allows.
+var h264Levels = []struct {
+	level          int
+	maxFrameBlocks int
+	maxBlockRate   int
+}{
+	{30, 1620, 40_500},
+	{31, 3600, 108_000},
+	{32, 5120, 216_000},
+	{40, 8192, 245_760},
+	{42, 8704, 522_240},
+	{50, 22_080, 589_824},
+	{51, 36_864, 983_040},
+	{52, 36_864, 2_073_600},
+}
+
+// h264Level picks the lowest level that fits the frame size and rate.
+// Sources whose frame rate isn't known are assumed to be 60fps, so the
+// level is never too low for them.
+func h264Level(width, height int, frameRate *float64) int {
+	fps := 60.0
+	if frameRate != nil && *frameRate > 0 {
+		fps = *frameRate
+	}
+	blocks := ((width + 15) / 16) * ((height + 15) / 16)
+	for _, l := range h264Levels {
+		if blocks <= l.maxFrameBlocks && float64(blocks)*fps <= float64(l.maxBlockRate) {
+			return l.level
+		}
+	}
+	return h264Levels[len(h264Levels)-1].level
+}
+
+// renditionsFor picks the renditions that don't upscale the source's
+// short side. A source smaller than every rung still gets a single
+// rendition at its own size.
+func renditionsFor(sourceWidth, sourceHeight int) []encodedRendition {
+	sourceShortSide := min(sourceWidth, sourceHeight)
+	renditions := []encodedRendition{}
+	for _, r := range renditionLadder {
+		if r.ShortSide > sourceShortSide {
+			continue
+		}
+		renditions = append(renditions, scaleRendition(r, sourceWidth, sourceHeight))
+	}
+	if len(renditions) == 0 {
+		lowest := renditionLadder[len(renditionLadder)-1]
+		lowest.Name = fmt.Sprintf("%dp", sourceShortSide)
+		lowest.ShortSide = sourceShortSide - sourceShortSide%2
+		renditions = append(renditions, scaleRendition(lowest, sourceWidth, sourceHeight))
+	}
+	return renditions
+}
+
+func scaleRendition(r rendition, sourceWidth, sourceHeight int) encodedRendition {
+	if sourceWidth < sourceHeight {
+		return encodedRendition{
+			rendition: r,
+			Width:     r.ShortSide,
+			Height:    scaledWidth(sourceHeight, sourceWidth, r.ShortSide),
+		}
+	}
+	return encodedRendition{
+		rendition: r,
+		Width:     scaledWidth(sourceWidth, sourceHeight, r.ShortSide),
+		Height:    r.ShortSide,
+	}
+}
+
+// scaledWidth keeps the aspect ratio and rounds to an even number, which
+// libx264 requires.
+func scaledWidth(sourceWidth, sourceHeight, height int) int {
+	width := int(math.Round(float64(sourceWidth) * float64(height) / float64(sourceHeight)))
+	return width + width%2
+}
+
+// encodeRenditions transcodes the source into one H.264/AAC MP4 per
+// rendition, with keyframes aligned to segment boundaries so every
+// rendition can be packaged for HLS and DASH without re-encoding.
+func (cfg *apiConfig) encodeRenditions(ctx context.Context, sourcePath string, stream media.Stream, duration float64, outDir string, report func(percent float64)) ([]encodedRendition, error) {
+	renditions := renditionsFor(stream.DisplaySize())
+	for i, r := range renditions {
+		r.Path = filepath.Join(outDir, r.Name+".mp4")
+		r.Level = h264Level(r.Width, r.Height, stream.FrameRate())
+		// each rendition is an equal share of the overall progress
+		progress := &media.Progress{
+			Duration: duration,
+			Report: func(percent float64) {
+				report((float64(i) + percent/100) / float64(len(renditions)) * 100)
+			},
+		}
+		err := cfg.mediaProcessor.Run(ctx, media.OpTranscode, []string{
+			"-y",
+			"-i", sourcePath,
+			"-map", "0:v:0",
+			"-map", "0:a:0?",
+			"-vf", fmt.Sprintf("scale=%d:%d", r.Width, r.Height),
+			"-c:v", "libx264",
+			"-preset", "veryfast",
+			"-profile:v", "main",
+			"-level:v", fmt.Sprintf("%d.%d", r.Level/10, r.Level%10),
+			"-b:v", fmt.Sprint(r.VideoBitrate),
+			"-maxrate", fmt.Sprint(r.VideoBitrate * 107 / 100),
+			"-bufsize", fmt.Sprint(r.VideoBitrate * 3 / 2),
+			"-force_key_frames", fmt.Sprintf("expr:gte(t,n_forced*%d)", segmentSeconds),
+			"-c:a", "aac",
+			"-b:a", fmt.Sprint(r.AudioBitrate),
+			"-ac", "2",
+			"-movflags", "faststart",
+			"-f", "mp4", r.Path,
+		}, progress)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't encode %s rendition: %w", r.Name, err)
+		}
+		renditions[i] = r
+	}
+	return renditions, nil
+}
+
+type streamingOutput struct {
+	HLSKey  *string
+	DASHKey *string
+	Formats []string
+}
+
+// generateStreaming transcodes the video into renditions and packages them
+// in each of the requested streaming formats under keyPrefix.
+func (cfg *apiConfig) generateStreaming(ctx context.Context, sourcePath string, videoMeta media.Metadata, keyPrefix string, formats []string, report func(percent float64)) (streamingOutput, error) {
+	output := streamingOutput{}
+	if len(formats) == 0 {
+		return output, nil
+	}
+
+	stream, ok := videoMeta.VideoStream()
+	if !ok || stream.Width == 0 || stream.Height == 0 {
+		return output, fmt.Errorf("no video stream found")
+	}
+
+	workDir, err := cfg.createSpoolDir("streaming-*")
+	if err != nil {
+		return output, err
+	}
+	defer os.RemoveAll(workDir)
+
+	renditions, err := cfg.encodeRenditions(ctx, sourcePath, stream, videoMeta.Duration(), workDir, report)
+	if err != nil {
+		return output, err
+	}
+
+	for _, format := range formats {
+		formatDir := filepath.Join(workDir, format)
+		var manifest string
+		switch format {
+		case streamingFormatHLS:
+			manifest = "master.m3u8"
+			err = cfg.packageHLS(ctx, renditions, videoMeta.HasAudio(), formatDir)
+		case streamingFormatDASH:
+			manifest = "manifest.mpd"
+			err = cfg.packageDASH(ctx, renditions, videoMeta.HasAudio(), formatDir)
+		default:
+			err = fmt.Errorf("unknown streaming format %q", format)
+		}
+		if err != nil {
+			return output, err
+		}
+
+		err = cfg.uploadDir(ctx, formatDir, keyPrefix+format+"/")
+		if err != nil {
+			return output, err
+		}
+
+		manifestKey := keyPrefix + format + "/" + manifest
+		switch format {
+		case streamingFormatHLS:
+			output.HLSKey = &manifestKey
+		case streamingFormatDASH:
+			output.DASHKey = &manifestKey
+		}
+		output.Formats = append(output.Formats, format)
+	}
+	return output, nil
+}
+
+// uploadDir stores every file in dir under keyPrefix.
+func (cfg *apiConfig) uploadDir(ctx context.Context, dir, keyPrefix string) error {
+	return filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		return cfg.videoStorage.Put(ctx, keyPrefix+filepath.ToSlash(rel), file, streamingContentType(path))
+	})
+}
+
+func streamingContentType(path string) string {
+	switch filepath.Ext(path) {
+	case ".m3u8":
+		return "application/vnd.apple.mpegurl"
+	case ".ts":
+		return "video/mp2t"
+	case ".mpd":
+		return "application/dash+xml"
+	case ".m4s":
+		return "video/iso.segment"
+	case ".vtt":
+		return "text/vtt"
+	}
+	if contentType := mime.TypeByExtension(filepath.Ext(path)); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseStreamingFormats(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    []string
+		wantErr bool
+	}{
+		{"", []string{streamingFormatHLS}, false},
+		{"  ", []string{streamingFormatHLS}, false},
+		{"none", []string{}, false},
+		{"hls", []string{streamingFormatHLS}, false},
+		{"dash", []string{streamingFormatDASH}, false},
+		{"hls,dash", []string{streamingFormatHLS, streamingFormatDASH}, false},
+		{" DASH , HLS ", []string{streamingFormatDASH, streamingFormatHLS}, false},
+		{"hls,hls", []string{streamingFormatHLS}, false},
+		{"smooth", nil, true},
+		{"hls,", nil, true},
+		{"hls,none", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := parseStreamingFormats(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseStreamingFormats(%q) error = %v, want error: %t", tt.value, err, tt.wantErr)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("parseStreamingFormats(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestH264Level(t *testing.T) {
+	fps := func(rate float64) *float64 { return &rate }
+	tests := []struct {
+		name      string
+		width     int
+		height    int
+		frameRate *float64
+		want      int
+	}{
+		{"360p30", 640, 360, fps(30), 30},
+		{"480p30", 854, 480, fps(30), 31},
+		{"720p30", 1280, 720, fps(30), 31},
+		{"720p60", 1280, 720, fps(60), 32},
+		{"1080p30", 1920, 1080, fps(30), 40},
+		{"portrait 1080p30", 1080, 1920, fps(30), 40},
+		{"1080p60", 1920, 1080, fps(60), 42},
+		{"unknown frame rate", 1920, 1080, nil, 42},
+		{"1080p120", 1920, 1080, fps(120), 51},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := h264Level(tt.width, tt.height, tt.frameRate)
+			if got != tt.want {
+				t.Errorf("h264Level(%d, %d) = %d, want %d", tt.width, tt.height, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncodedRenditionCodecs(t *testing.T) {
+	r := encodedRendition{Level: 31}
+	if got, want := r.codecs(true), "avc1.4D401F,mp4a.40.2"; got != want {
+		t.Errorf("codecs with audio = %q, want %q", got, want)
+	}
+	if got, want := r.codecs(false), "avc1.4D401F"; got != want {
+		t.Errorf("codecs without audio = %q, want %q", got, want)
+	}
+}
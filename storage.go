@@ -0,0 +1,18 @@
+package main
+
+import "fmt"
+
+const (
+	storageBackendS3     = "s3"
+	storageBackendLocal  = "local"
+	storageBackendMemory = "memory"
+)
+
+// thumbnailsPrefix is where thumbnails are kept in the video storage.
+const thumbnailsPrefix = "thumbnails/"
+
+// objectsBaseURL is where video objects are served from when they are
+// not kept in S3 and have to be proxied by this server.
+func objectsBaseURL(port string) string {
+	return fmt.Sprintf("http://localhost:%s/objects", port)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/media"
+	"github.com/google/uuid"
+)
+
+// thumbnailCandidatePositions are the points in a video, as fractions of its
+// duration, that candidate thumbnails are taken from. The middle one becomes
+// the default thumbnail.
+var thumbnailCandidatePositions = []float64{0.1, 0.5, 0.9}
+
+const thumbnailCandidateMaxWidth = 1280
+
+func thumbnailCandidatePrefix(videoID uuid.UUID) string {
+	return "candidates/" + videoID.String() + "/"
+}
+
+// generateThumbnailCandidates extracts candidate frames from the video and
+// replaces the video's earlier candidates with them. Unless the owner
+// uploaded their own thumbnail, the video's thumbnail becomes the default
+// candidate.
+func (cfg *apiConfig) generateThumbnailCandidates(ctx context.Context, videoID uuid.UUID, filePath string, duration float64) error {
+	workDir, err := cfg.createSpoolDir("thumbnails-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(workDir)
+
+	positions := []float64{0}
+	if duration > 0 {
+		positions = []float64{}
+		for _, fraction := range thumbnailCandidatePositions {
+			positions = append(positions, duration*fraction)
+		}
+	}
+
+	keys := make([]string, 0, len(positions))
+	for i, position := range positions {
+		framePath := filepath.Join(workDir, fmt.Sprintf("%d.jpg", i))
+		err := cfg.mediaProcessor.Run(ctx, media.OpFrames, []string{
+			"-y",
+			"-ss", fmt.Sprintf("%.3f", position),
+			"-i", filePath,
+			"-frames:v", "1",
+			"-vf", fmt.Sprintf("scale='min(%d,iw)':-2", thumbnailCandidateMaxWidth),
+			"-q:v", "2",
+			framePath,
+		}, nil)
+		if err != nil {
+			return fmt.Errorf("couldn't extract frame at %.3fs: %w", position, err)
+		}
+
+		key := thumbnailCandidatePrefix(videoID) + generateThumbnailKey("jpg")
+		frame, err := os.Open(framePath)
+		if err != nil {
+			return err
+		}
+		err = cfg.thumbnailStorage.Put(ctx, key, frame, "image/jpeg")
+		frame.Close()
+		if err != nil {
+			return fmt.Errorf("couldn't store thumbnail candidate: %w", err)
+		}
+		keys = append(keys, key)
+	}
+
+	previous, err := cfg.db.GetThumbnailCandidates(ctx, videoID)
+	if err != nil {
+		return err
+	}
+	err = cfg.db.DeleteThumbnailCandidates(ctx, videoID)
+	if err != nil {
+		return err
+	}
+	for i, key := range keys {
+		_, err := cfg.db.CreateThumbnailCandidate(ctx, database.CreateThumbnailCandidateParams{
+			VideoID:  videoID,
+			Key:      key,
+			Position: positions[i],
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	err = cfg.db.SetDefaultVideoThumbnail(ctx, videoID, keys[len(keys)/2], thumbnailCandidatePrefix(videoID))
+	if err != nil {
+		return err
+	}
+
+	for _, candidate := range previous {
+		err := cfg.deleteObject(ctx, storageNameThumbnail, candidate.Key)
+		if err != nil {
+			log.Printf("Couldn't delete old thumbnail candidate %s: %v", candidate.Key, err)
+		}
+	}
+	return nil
+}
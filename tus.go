@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,termination"
+	tusMaxSize    = maxVideoUploadSize
+)
+
+var errTusUploadNotFound = errors.New("upload not found")
+
+type tusUpload struct {
+	ID        uuid.UUID         `json:"id"`
+	VideoID   uuid.UUID         `json:"video_id"`
+	UserID    uuid.UUID         `json:"user_id"`
+	Length    int64             `json:"length"`
+	Offset    int64             `json:"-"`
+	Metadata  map[string]string `json:"metadata"`
+	CreatedAt time.Time         `json:"created_at"`
+	// UpdatedAt is when bytes were last received.
+	UpdatedAt time.Time `json:"-"`
+}
+
+// tusStore keeps partial tus uploads on disk: the received bytes in
+// <id>.bin and the upload's metadata in <id>.json.
+type tusStore struct {
+	dir   string
+	mu    sync.Mutex
+	locks map[uuid.UUID]*sync.Mutex
+}
+
+func newTusStore(dir string) (*tusStore, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	return &tusStore{
+		dir:   dir,
+		locks: map[uuid.UUID]*sync.Mutex{},
+	}, nil
+}
+
+func (s *tusStore) mutex(id uuid.UUID) *sync.Mutex {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.locks[id]
+	if !ok {
+		l = &sync.Mutex{}
+		s.locks[id] = l
+	}
+	return l
+}
+
+// lock serializes access to a single upload so concurrent PATCH requests
+// can't interleave their writes.
+func (s *tusStore) lock(id uuid.UUID) func() {
+	l := s.mutex(id)
+	l.Lock()
+	return l.Unlock
+}
+
+// tryLock is lock for callers that would rather skip an upload that is
+// being written to than wait for it.
+func (s *tusStore) tryLock(id uuid.UUID) (func(), bool) {
+	l := s.mutex(id)
+	if !l.TryLock() {
+		return nil, false
+	}
+	return l.Unlock, true
+}
+
+func (s *tusStore) infoPath(id uuid.UUID) string {
+	return filepath.Join(s.dir, id.String()+".json")
+}
+
+func (s *tusStore) dataPath(id uuid.UUID) string {
+	return filepath.Join(s.dir, id.String()+".bin")
+}
+
+func (s *tusStore) create(upload tusUpload) error {
+	dat, err := json.Marshal(upload)
+	if err != nil {
+		return err
+	}
+	dataFile, err := os.Create(s.dataPath(upload.ID))
+	if err != nil {
+		return err
+	}
+	dataFile.Close()
+	return os.WriteFile(s.infoPath(upload.ID), dat, 0644)
+}
+
+func (s *tusStore) get(id uuid.UUID) (tusUpload, error) {
+	dat, err := os.ReadFile(s.infoPath(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return tusUpload{}, errTusUploadNotFound
+	}
+	if err != nil {
+		return tusUpload{}, err
+	}
+
+	upload := tusUpload{}
+	err = json.Unmarshal(dat, &upload)
+	if err != nil {
+		return tusUpload{}, err
+	}
+
+	stat, err := os.Stat(s.dataPath(id))
+	if errors.Is(err, fs.ErrNotExist) {
+		return tusUpload{}, errTusUploadNotFound
+	}
+	if err != nil {
+		return tusUpload{}, err
+	}
+	upload.Offset = stat.Size()
+	upload.UpdatedAt = stat.ModTime()
+	if upload.UpdatedAt.Before(upload.CreatedAt) {
+		upload.UpdatedAt = upload.CreatedAt
+	}
+	return upload, nil
+}
+
+// write appends at most the remaining length of the upload from body and
+// returns the new offset. Bytes that were received before an error are
+// kept so the client can resume from them.
+func (s *tusStore) write(upload tusUpload, body io.Reader) (int64, error) {
+	dataFile, err := os.OpenFile(s.dataPath(upload.ID), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return upload.Offset, err
+	}
+	defer dataFile.Close()
+
+	n, err := io.Copy(dataFile, io.LimitReader(body, upload.Length-upload.Offset))
+	return upload.Offset + n, err
+}
+
+func (s *tusStore) remove(id uuid.UUID) error {
+	err := errors.Join(
+		os.Remove(s.dataPath(id)),
+		os.Remove(s.infoPath(id)),
+	)
+	if errors.Is(err, fs.ErrNotExist) {
+		return errTusUploadNotFound
+	}
+
+	s.mu.Lock()
+	delete(s.locks, id)
+	s.mu.Unlock()
+	return err
+}
+
+// removeExpired deletes uploads that haven't received any bytes since the
+// cutoff and returns how many were removed. Uploads that are being
+// written to are skipped.
+func (s *tusStore) removeExpired(cutoff time.Time) (int, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok {
+			continue
+		}
+		id, err := uuid.Parse(name)
+		if err != nil {
+			continue
+		}
+		upload, err := s.get(id)
+		if err != nil || upload.UpdatedAt.After(cutoff) {
+			continue
+		}
+		if s.removeIfIdle(id, cutoff) {
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+func (s *tusStore) removeIfIdle(id uuid.UUID, cutoff time.Time) bool {
+	unlock, ok := s.tryLock(id)
+	if !ok {
+		return false
+	}
+	defer unlock()
+
+	// a write may have finished between the first look and taking the lock
+	upload, err := s.get(id)
+	if err != nil || upload.UpdatedAt.After(cutoff) {
+		return false
+	}
+	return s.remove(id) == nil
+}
+
+// parseTusMetadata decodes an Upload-Metadata header: comma separated
+// pairs of a key and an optional base64 encoded value.
+func parseTusMetadata(header string) (map[string]string, error) {
+	metadata := map[string]string{}
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+	for _, pair := range strings.Split(header, ",") {
+		parts := strings.Fields(pair)
+		if len(parts) == 0 || len(parts) > 2 {
+			return nil, fmt.Errorf("malformed metadata pair %q", pair)
+		}
+		value := ""
+		if len(parts) == 2 {
+			decoded, err := base64.StdEncoding.DecodeString(parts[1])
+			if err != nil {
+				return nil, fmt.Errorf("malformed metadata value for %q: %w", parts[0], err)
+			}
+			value = string(decoded)
+		}
+		metadata[parts[0]] = value
+	}
+	return metadata, nil
+}
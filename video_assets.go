@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/storage"
+)
+
+const (
+	storageNameVideo     = "video"
+	storageNameThumbnail = "thumbnail"
+	storageNameAssets    = "assets"
+)
+
+const (
+	deleteMaxAttempts  = 3
+	deleteRetryBackoff = 250 * time.Millisecond
+)
+
+// videoAssetPrefix is the key prefix under which everything derived from
+// a video object (renditions, manifests, previews) is stored.
+func videoAssetPrefix(videoKey string) string {
+	return strings.TrimSuffix(videoKey, path.Ext(videoKey)) + "/"
+}
+
+func (cfg *apiConfig) storageByName(name string) (storage.ObjectStore, error) {
+	switch name {
+	case storageNameVideo:
+		return cfg.videoStorage, nil
+	case storageNameThumbnail:
+		return cfg.thumbnailStorage, nil
+	case storageNameAssets:
+		return cfg.assetStorage, nil
+	}
+	return nil, fmt.Errorf("unknown storage %q", name)
+}
+
+// deleteVideoAssets removes every stored object belonging to the video.
+// Objects that still can't be deleted after retrying are recorded in the
+// database so they can be cleaned up later.
+func (cfg *apiConfig) deleteVideoAssets(ctx context.Context, video database.Video) error {
+	var errs []error
+
+	if video.VideoKey != nil {
+		errs = append(errs, cfg.deleteObject(ctx, storageNameVideo, *video.VideoKey))
+		errs = append(errs, cfg.deletePrefix(ctx, storageNameVideo, videoAssetPrefix(*video.VideoKey)))
+	}
+	if video.OriginalKey != nil {
+		errs = append(errs, cfg.deleteObject(ctx, storageNameVideo, *video.OriginalKey))
+	}
+	if video.ThumbnailKey != nil {
+		errs = append(errs, cfg.deleteObject(ctx, storageNameThumbnail, *video.ThumbnailKey))
+	}
+	errs = append(errs, cfg.deletePrefix(ctx, storageNameThumbnail, thumbnailCandidatePrefix(video.ID)))
+
+	return errors.Join(errs...)
+}
+
+func (cfg *apiConfig) deleteObject(ctx context.Context, storageName, key string) error {
+	store, err := cfg.storageByName(storageName)
+	if err != nil {
+		return err
+	}
+
+	attempts, err := withRetry(ctx, func() error {
+		err := store.Delete(ctx, key)
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		cfg.recordFailedDeletion(ctx, storageName, key, false, attempts, err)
+	}
+	return err
+}
+
+func (cfg *apiConfig) deletePrefix(ctx context.Context, storageName, prefix string) error {
+	store, err := cfg.storageByName(storageName)
+	if err != nil {
+		return err
+	}
+
+	var objects []storage.ObjectInfo
+	attempts, err := withRetry(ctx, func() error {
+		var listErr error
+		objects, listErr = store.List(ctx, prefix)
+		return listErr
+	})
+	if err != nil {
+		cfg.recordFailedDeletion(ctx, storageName, prefix, true, attempts, err)
+		return err
+	}
+
+	var errs []error
+	for _, obj := range objects {
+		errs = append(errs, cfg.deleteObject(ctx, storageName, obj.Key))
+	}
+	return errors.Join(errs...)
+}
+
+func (cfg *apiConfig) recordFailedDeletion(ctx context.Context, storageName, key string, isPrefix bool, attempts int, deleteErr error) {
+	log.Printf("Couldn't delete %s object %q after %d attempts: %v", storageName, key, attempts, deleteErr)
+	_, err := cfg.db.CreateFailedDeletion(context.WithoutCancel(ctx), database.CreateFailedDeletionParams{
+		Storage:  storageName,
+		Key:      key,
+		IsPrefix: isPrefix,
+		Error:    deleteErr.Error(),
+		Attempts: attempts,
+	})
+	if err != nil {
+		log.Printf("Couldn't record failed deletion of %q: %v", key, err)
+	}
+}
+
+func withRetry(ctx context.Context, fn func() error) (int, error) {
+	var err error
+	backoff := deleteRetryBackoff
+	for attempt := 1; attempt <= deleteMaxAttempts; attempt++ {
+		err = fn()
+		if err == nil {
+			return attempt, nil
+		}
+		if attempt == deleteMaxAttempts {
+			return attempt, err
+		}
+		select {
+		case <-ctx.Done():
+			return attempt, errors.Join(err, ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+	return deleteMaxAttempts, err
+}
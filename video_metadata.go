@@ -0,0 +1,65 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/media"
+)
+
+// videoMetadata converts what ffprobe reported into what is stored on the
+// video. Values ffprobe didn't report are left nil.
+func videoMetadata(m media.Metadata) database.VideoMetadata {
+	md := database.VideoMetadata{
+		Duration: positiveFloat(m.Format.Duration),
+		FileSize: positiveInt(m.Format.Size),
+		Bitrate:  positiveInt(m.Format.BitRate),
+	}
+
+	if stream, ok := m.VideoStream(); ok {
+		md.Width = nonZero(stream.Width)
+		md.Height = nonZero(stream.Height)
+		md.VideoCodec = nonEmpty(stream.CodecName)
+		md.FrameRate = stream.FrameRate()
+		rotation := stream.Rotation()
+		md.Rotation = &rotation
+		if md.Bitrate == nil {
+			md.Bitrate = positiveInt(stream.BitRate)
+		}
+	}
+	if stream, ok := m.AudioStream(); ok {
+		md.AudioCodec = nonEmpty(stream.CodecName)
+		md.AudioChannels = nonZero(stream.Channels)
+	}
+	return md
+}
+
+func positiveFloat(value string) *float64 {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || f <= 0 {
+		return nil
+	}
+	return &f
+}
+
+func positiveInt(value string) *int64 {
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n <= 0 {
+		return nil
+	}
+	return &n
+}
+
+func nonZero(n int) *int {
+	if n == 0 {
+		return nil
+	}
+	return &n
+}
+
+func nonEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+
+	"github.com/bootdotdev/learn-file-storage-s3-golang-starter/internal/database"
+)
+
+const (
+	videoURLModePublic     = "public"
+	videoURLModePresign    = "presign"
+	videoURLModeCloudFront = "cloudfront"
+)
+
+// videoObjectURL is the URL a client fetches a video object from: a
+// short-lived signed URL for private buckets, the public URL otherwise.
+func (cfg *apiConfig) videoObjectURL(ctx context.Context, key string) (string, error) {
+	if cfg.videoURLSigner != nil {
+		return cfg.videoURLSigner.SignedURL(ctx, key, cfg.signedURLExpiry)
+	}
+	return cfg.videoStorage.URL(key), nil
+}
+
+// thumbnailObjectURL is videoObjectURL for thumbnails, which share the
+// video storage under thumbnailsPrefix.
+func (cfg *apiConfig) thumbnailObjectURL(ctx context.Context, key string) (string, error) {
+	if cfg.videoURLSigner != nil {
+		return cfg.videoURLSigner.SignedURL(ctx, thumbnailsPrefix+key, cfg.signedURLExpiry)
+	}
+	return cfg.thumbnailStorage.URL(key), nil
+}
+
+// videoWithURLs fills in the video's URLs from its stored keys. They are
+// computed on every response so a change of port, domain or CDN doesn't
+// break existing rows.
+func (cfg *apiConfig) videoWithURLs(ctx context.Context, video database.Video) (database.Video, error) {
+	video.VideoURL = nil
+	video.HLSURL = nil
+	video.DASHURL = nil
+	video.PreviewVTTURL = nil
+	video.ThumbnailURL = nil
+
+	if video.VideoKey != nil {
+		videoURL, err := cfg.videoObjectURL(ctx, *video.VideoKey)
+		if err != nil {
+			return video, err
+		}
+		video.VideoURL = &videoURL
+	}
+	if video.HLSKey != nil {
+		hlsURL, err := cfg.manifestURL(ctx, video, *video.HLSKey)
+		if err != nil {
+			return video, err
+		}
+		video.HLSURL = &hlsURL
+	}
+	if video.DASHKey != nil {
+		dashURL, err := cfg.manifestURL(ctx, video, *video.DASHKey)
+		if err != nil {
+			return video, err
+		}
+		video.DASHURL = &dashURL
+	}
+	if video.PreviewVTTKey != nil {
+		previewURL, err := cfg.manifestURL(ctx, video, *video.PreviewVTTKey)
+		if err != nil {
+			return video, err
+		}
+		video.PreviewVTTURL = &previewURL
+	}
+	if video.ThumbnailKey != nil {
+		thumbnailURL, err := cfg.thumbnailObjectURL(ctx, *video.ThumbnailKey)
+		if err != nil {
+			return video, err
+		}
+		video.ThumbnailURL = &thumbnailURL
+	}
+	return video, nil
+}
+
+func (cfg *apiConfig) videosWithURLs(ctx context.Context, videos []database.Video) ([]database.Video, error) {
+	withURLs := make([]database.Video, 0, len(videos))
+	for _, video := range videos {
+		video, err := cfg.videoWithURLs(ctx, video)
+		if err != nil {
+			return nil, err
+		}
+		withURLs = append(withURLs, video)
+	}
+	return withURLs, nil
+}